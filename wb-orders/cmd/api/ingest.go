@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"wb-orders/internal/decode"
+	"wb-orders/internal/ingest"
+	"wb-orders/internal/intake"
+	"wb-orders/internal/storage"
+)
+
+const (
+	// maxBulkBytes — предел тела /orders:bulk.
+	maxBulkBytes = 64 << 20
+	// maxIdempotencyKey — предел длины заголовка Idempotency-Key.
+	maxIdempotencyKey = 255
+)
+
+// registerIngest — приём заказов по HTTP для партнёров без Kafka:
+//
+//	POST /orders       — один заказ (JSON); 200 stored/skipped, 422 rejected, 503 failed
+//	POST /orders:bulk  — NDJSON, заказ на строку; 200 с итогом по каждой строке
+//
+// Заголовки — как у сообщений Kafka: schema-version, traceparent, producer.
+// Idempotency-Key: повтор запроса с тем же ключом и телом получает
+// сохранённый ответ (Idempotent-Replayed: true), а не применяется снова.
+func registerIngest(mux *http.ServeMux, svc *intake.Service) {
+	mux.HandleFunc("POST /orders", func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); !ingest.IsJSON(ct) {
+			http.Error(w, "unsupported content-type "+ct, http.StatusUnsupportedMediaType)
+			return
+		}
+		body, ok := readBody(w, r, decode.DefaultMaxSize)
+		if !ok {
+			return
+		}
+
+		idempotent(w, r, svc, body, func(ctx context.Context) (int, any, bool) {
+			ctx, cancel := context.WithTimeout(ctx, intake.OrderTimeout)
+			defer cancel()
+			res := svc.Apply(ctx, body, requestMeta(r))
+			switch res.Status {
+			case intake.StatusStored, intake.StatusSkipped:
+				return http.StatusOK, res, false
+			case intake.StatusRejected:
+				return http.StatusUnprocessableEntity, res, false
+			}
+			return http.StatusServiceUnavailable, res, true
+		})
+	})
+
+	mux.HandleFunc("POST /orders:bulk", func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); !isNDJSON(ct) {
+			http.Error(w, "unsupported content-type "+ct+" (want application/x-ndjson)", http.StatusUnsupportedMediaType)
+			return
+		}
+		body, ok := readBody(w, r, maxBulkBytes)
+		if !ok {
+			return
+		}
+
+		// Сроки — внутри Bulk (OrderTimeout на строку, BulkTimeout на пакет)
+		idempotent(w, r, svc, body, func(ctx context.Context) (int, any, bool) {
+			res, err := svc.Bulk(ctx, bytes.NewReader(body), requestMeta(r))
+			switch {
+			case errors.Is(err, intake.ErrTooManyOrders), errors.Is(err, decode.ErrTooLarge):
+				return http.StatusRequestEntityTooLarge, map[string]string{"error": err.Error()}, false
+			case err != nil:
+				return http.StatusBadRequest, map[string]string{"error": err.Error()}, false
+			case len(res.Results) == 0:
+				return http.StatusBadRequest, map[string]string{"error": "no orders in request"}, false
+			}
+			// Упавшие по вине БД строки можно прислать повторно с тем же ключом
+			return http.StatusOK, res, res.Failed > 0
+		})
+	})
+}
+
+// idempotent выполняет run с учётом Idempotency-Key (если он есть).
+// run возвращает код, тело ответа и retryable — ответ не сохранять,
+// повтор с тем же ключом выполнится заново.
+func idempotent(w http.ResponseWriter, r *http.Request, svc *intake.Service, body []byte,
+	run func(ctx context.Context) (int, any, bool)) {
+	ctx := r.Context()
+	key := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+	if key == "" {
+		code, v, _ := run(ctx)
+		writeJSON(w, code, v)
+		return
+	}
+	if len(key) > maxIdempotencyKey {
+		http.Error(w, "Idempotency-Key is too long", http.StatusBadRequest)
+		return
+	}
+
+	cctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	stored, err := svc.Claim(cctx, key, intake.RequestHash(r.Method, r.URL.Path, body))
+	cancel()
+	switch {
+	case errors.Is(err, storage.ErrIdempotencyMismatch):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	case errors.Is(err, storage.ErrIdempotencyInProgress):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "db error: "+err.Error(), http.StatusServiceUnavailable)
+		return
+	case stored != nil:
+		log.Printf("[http] idempotent replay key=%q status=%d", key, stored.StatusCode)
+		w.Header().Set("Idempotent-Replayed", "true")
+		writeRawJSON(w, stored.StatusCode, stored.Body)
+		return
+	}
+
+	code, v, retryable := run(ctx)
+	data, err := json.Marshal(v)
+
+	// Ответ сохраняем, даже если клиент уже отключился: заказы применены
+	fctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 3*time.Second)
+	defer cancel()
+	if err != nil {
+		svc.Finish(fctx, key, storage.StoredResponse{}, true)
+		http.Error(w, "encode response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	svc.Finish(fctx, key, storage.StoredResponse{StatusCode: code, Body: data}, retryable)
+	writeRawJSON(w, code, data)
+}
+
+func writeRawJSON(w http.ResponseWriter, code int, data []byte) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	_, _ = w.Write(append(data, '\n'))
+}
+
+// readBody читает тело не длиннее limit; иначе отвечает 413 и false.
+func readBody(w http.ResponseWriter, r *http.Request, limit int) ([]byte, bool) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, int64(limit)+1))
+	if err != nil {
+		http.Error(w, "read body: "+err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	if len(body) > limit {
+		http.Error(w, "body too large", http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
+	return body, true
+}
+
+// requestMeta — метаданные приёма из заголовков запроса (для аудита и логов).
+func requestMeta(r *http.Request) ingest.Meta {
+	meta := ingest.Meta{
+		MessageID:     strings.TrimSpace(r.Header.Get("Idempotency-Key")),
+		Producer:      r.Header.Get("Producer"),
+		ContentType:   r.Header.Get("Content-Type"),
+		SchemaVersion: r.Header.Get(decode.VersionHeader),
+		Topic:         "http",
+		Time:          time.Now(),
+	}
+	if meta.Producer == "" {
+		meta.Producer = "http"
+	}
+	meta.TraceID, meta.SpanID = ingest.ParseTraceParent(r.Header.Get("Traceparent"))
+	if meta.TraceID == "" {
+		meta.TraceID = strings.TrimSpace(r.Header.Get("X-Request-Id"))
+	}
+	return meta
+}
+
+// isNDJSON — application/x-ndjson или application/ndjson; пустой — тоже.
+func isNDJSON(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mt, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mt == "application/x-ndjson" || mt == "application/ndjson")
+}
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -18,7 +19,13 @@ import (
 	"github.com/joho/godotenv"
 
 	"wb-orders/internal/cache"
+	"wb-orders/internal/decode"
+	"wb-orders/internal/intake"
 	ikafka "wb-orders/internal/kafka"
+	"wb-orders/internal/models"
+	"wb-orders/internal/normalize"
+	"wb-orders/internal/pipeline"
+	"wb-orders/internal/quarantine"
 	"wb-orders/internal/storage"
 )
 
@@ -28,6 +35,32 @@ func writeJSON(w http.ResponseWriter, code int, v any) {
 	_ = json.NewEncoder(w).Encode(v)
 }
 
+// orderView — заказ в ответе API: поля как в сообщении + состояние
+// жизненного цикла и суммы оплаты, отформатированные по локали заказа.
+type orderView struct {
+	models.Order
+	State     models.OrderState `json:"state"`
+	Formatted paymentView       `json:"formatted"`
+}
+
+// paymentView — суммы оплаты строками для показа (Money.Format).
+type paymentView struct {
+	GoodsTotal   string `json:"goods_total"`
+	DeliveryCost string `json:"delivery_cost"`
+	CustomFee    string `json:"custom_fee"`
+	Amount       string `json:"amount"`
+}
+
+func newOrderView(o models.Order) orderView {
+	p := o.Payment
+	return orderView{Order: o, State: o.State(), Formatted: paymentView{
+		GoodsTotal:   p.GoodsTotal.Format(o.Locale),
+		DeliveryCost: p.DeliveryCost.Format(o.Locale),
+		CustomFee:    p.CustomFee.Format(o.Locale),
+		Amount:       p.Amount.Format(o.Locale),
+	}}
+}
+
 func mustOpenDB() *sql.DB {
 	const dsn = "host=127.0.0.1 port=5433 dbname=wb_orders user=wb_user password=wb_pass sslmode=disable"
 
@@ -56,12 +89,29 @@ func mustOpenDB() *sql.DB {
 	}
 }
 
+// mustDecoder: KAFKA_DECODE_MODE=strict|lenient, KAFKA_MAX_MESSAGE_BYTES — лимит размера.
+func mustDecoder() *decode.Decoder {
+	mode, err := decode.ParseMode(os.Getenv("KAFKA_DECODE_MODE"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	maxSize := decode.DefaultMaxSize
+	if v := os.Getenv("KAFKA_MAX_MESSAGE_BYTES"); v != "" {
+		if maxSize, err = strconv.Atoi(v); err != nil {
+			log.Fatalf("KAFKA_MAX_MESSAGE_BYTES: %v", err)
+		}
+	}
+	log.Printf("decoder: mode=%s max_size=%d", mode, maxSize)
+	return decode.New(mode, maxSize)
+}
+
 func main() {
 	if err := godotenv.Load(".env"); err != nil {
 		log.Printf(".env not loaded: %v (ok if vars set by shell/docker)", err)
 	}
 
-	// 1) Подключение к БД и репозиторий
+	// 1) Подключение к БД и репозиторий; закрывается последней — после
+	// того как консьюмеры дообработали взятые сообщения
 	db := mustOpenDB()
 	defer db.Close()
 	fmt.Println("Connected to Postgres")
@@ -79,16 +129,66 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	// 4) Kafka consumer
-	cons := ikafka.NewConsumer(repo, orderCache)
-	defer cons.Close()
+	// 4) Kafka consumer (+ нормализация входящих заказов)
+	norm := normalize.New()
+	dec := mustDecoder()
+	// Цепочка обработки заказа — общая для Kafka, HTTP и карантина.
+	// Свои звенья (обогащение, фильтры, приёмники) регистрируются здесь:
+	// chain.Use / InsertBefore / InsertAfter.
+	chain := pipeline.Default(dec, norm, orderCache)
+	kcfg, err := ikafka.LoadConfig()
+	if err != nil {
+		log.Fatalf("kafka config: %v", err)
+	}
+	// Обогащённый заказ (pipeline.Enrich) — в выходной топик, только после
+	// записи в БД: звено publish стоит в AfterStore, за кэшем
+	output, err := ikafka.NewOutput(kcfg)
+	if err != nil {
+		log.Fatalf("kafka output: %v", err)
+	}
+	if output != nil {
+		if err := chain.InsertAfter(pipeline.StageCache, pipeline.Publish(output)); err != nil {
+			log.Fatalf("pipeline: %v", err)
+		}
+		log.Printf("publishing enriched orders to %s", output.Topic())
+	}
+	// Supervisor держит консьюмер и умеет перезапускать его (replay)
+	cons, err := ikafka.NewSupervisor(kcfg, repo, chain)
+	if err != nil {
+		log.Fatalf("kafka consumer: %v", err)
+	}
 
+	// Consumer остановился с ошибкой (например, БД недоступна дольше
+	// политики повторов) — гасим процесс целиком: незакоммиченное сообщение
+	// перечитается после рестарта, а не потеряется.
+	consDone := make(chan struct{})
 	go func() {
+		defer close(consDone)
 		if err := cons.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
 			log.Printf("kafka consumer stopped: %v", err)
+			stop()
 		}
 	}()
 
+	// 4.1) Консьюмер событий смены статуса товаров (если задан топик)
+	var statusCons *ikafka.StatusConsumer
+	statusDone := make(chan struct{})
+	if kcfg.StatusTopic == "" {
+		close(statusDone)
+	} else {
+		if statusCons, err = ikafka.NewStatusConsumer(kcfg, repo, orderCache, output); err != nil {
+			log.Fatalf("kafka status consumer: %v", err)
+		}
+
+		go func() {
+			defer close(statusDone)
+			if err := statusCons.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				log.Printf("kafka status consumer stopped: %v", err)
+				stop()
+			}
+		}()
+	}
+
 	// 5) Роутер
 	mux := http.NewServeMux()
 
@@ -113,6 +213,96 @@ func main() {
 		})
 	})
 
+	// debug: сколько раз сработало каждое правило нормализации
+	mux.HandleFunc("/debug/normalize", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, norm.Stats())
+	})
+
+	// debug: режим декодера и счётчики неизвестных полей / дублей ключей
+	mux.HandleFunc("/debug/decode", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, dec.Stats())
+	})
+
+	// debug: звенья цепочки обработки по порядку ("store" — запись в БД)
+	mux.HandleFunc("/debug/pipeline", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"stages": chain.Stages()})
+	})
+
+	// debug: консьюмер — обработано/сохранено/пропущено, лаг по партициям, задержки
+	mux.HandleFunc("/debug/consumer", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, cons.Stats())
+	})
+
+	// debug: события статусов — применено / устарело / отклонено
+	mux.HandleFunc("/debug/status-consumer", func(w http.ResponseWriter, r *http.Request) {
+		if statusCons == nil {
+			http.Error(w, "status consumer is disabled (KAFKA_TOPIC_STATUS is empty)", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, statusCons.Stats())
+	})
+
+	// метрики консьюмера в формате Prometheus
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		cons.Stats().WritePrometheus(w)
+	})
+
+	// admin: сброс офсетов группы на момент времени / явные офсеты и повтор
+	// сообщений. Тело: {"since":"24h"} | {"time":"2025-01-31T00:00:00Z"} |
+	// {"topic":"orders","offsets":{"0":120}}; "dry_run":true — только посчитать.
+	mux.HandleFunc("/admin/consumer/replay", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req ikafka.ReplayRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), time.Minute)
+		defer cancel()
+
+		plan, err := cons.Replay(ctx, req)
+		switch {
+		case errors.Is(err, ikafka.ErrBadReplay):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ikafka.ErrNotRunning), errors.Is(err, ikafka.ErrGroupActive):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case err != nil:
+			writeJSON(w, http.StatusInternalServerError, map[string]any{"error": err.Error(), "plan": plan})
+		default:
+			writeJSON(w, http.StatusOK, plan)
+		}
+	})
+
+	// admin: пауза чтения без выхода из группы (например, на время работ с БД)
+	mux.HandleFunc("/admin/consumer/pause", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		cons.Pause()
+		writeJSON(w, http.StatusOK, cons.State())
+	})
+
+	mux.HandleFunc("/admin/consumer/resume", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		cons.Resume()
+		writeJSON(w, http.StatusOK, cons.State())
+	})
+
+	// admin: карантин отклонённых сообщений (просмотр, правка и повтор, отброс)
+	registerQuarantine(mux, quarantine.New(repo, chain))
+
+	// приём заказов по HTTP (один и NDJSON-пакетом), с Idempotency-Key
+	registerIngest(mux, intake.New(repo, chain))
+
 	// GET /order/{id}
 	mux.HandleFunc("/order/", func(w http.ResponseWriter, r *http.Request) {
 		id := strings.TrimPrefix(r.URL.Path, "/order/")
@@ -124,7 +314,7 @@ func main() {
 		// 1) Кэш
 		if o, ok := orderCache.Get(id); ok {
 			log.Printf("cache HIT id=%s len=%d", id, orderCache.Len())
-			writeJSON(w, http.StatusOK, o)
+			writeJSON(w, http.StatusOK, newOrderView(o))
 			return
 		}
 		log.Printf("cache MISS id=%s", id)
@@ -141,7 +331,7 @@ func main() {
 
 		// 3) Кладём в кэш и отдаём
 		orderCache.Set(id, o)
-		writeJSON(w, http.StatusOK, o)
+		writeJSON(w, http.StatusOK, newOrderView(o))
 	})
 
 	// HTTP сервер с graceful shutdown
@@ -161,14 +351,53 @@ func main() {
 	<-ctx.Done()
 	log.Println("shutdown signal received")
 
-	shCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	// Порядок остановки, всё — в один срок KAFKA_DRAIN_TIMEOUT +
+	// ShutdownMargin от сигнала (он должен быть меньше grace period):
+	// 1) HTTP: новые запросы не принимаем, текущие дорабатывают.
+	// 2) Консьюмеры: чтение остановлено отменой ctx ещё при сигнале —
+	//    drain идёт параллельно с HTTP; взятые сообщения дообрабатываются
+	//    или откатываются, офсеты коммитятся — Run сам укладывается в
+	//    KAFKA_DRAIN_TIMEOUT.
+	// 3) Выход из группы и закрытие DLQ; БД — последней (defer db.Close).
+	deadline := time.Now().Add(kcfg.DrainTimeout + ikafka.ShutdownMargin)
+	shCtx, cancel := context.WithDeadline(context.Background(), deadline)
 	defer cancel()
 	if err := srv.Shutdown(shCtx); err != nil {
 		log.Printf("http shutdown error: %v", err)
 	}
+
+	if !waitDone(time.Until(deadline), consDone, statusDone) {
+		log.Printf("consumers did not stop in time, closing anyway")
+	}
+	if err := cons.Close(); err != nil {
+		log.Printf("kafka consumer close: %v", err)
+	}
+	if statusCons != nil {
+		if err := statusCons.Close(); err != nil {
+			log.Printf("kafka status consumer close: %v", err)
+		}
+	}
+	if output != nil {
+		if err := output.Close(); err != nil {
+			log.Printf("kafka output close: %v", err)
+		}
+	}
 	log.Println("bye")
 }
 
+// waitDone ждёт, пока закроются все done, но не дольше timeout.
+func waitDone(timeout time.Duration, done ...<-chan struct{}) bool {
+	deadline := time.After(timeout)
+	for _, d := range done {
+		select {
+		case <-d:
+		case <-deadline:
+			return false
+		}
+	}
+	return true
+}
+
 // Прогрев кэша: загружаем последние N заказов
 func warmUpCache(ctx context.Context, repo *storage.Repo, c *cache.LRU, n int) error {
 	const q = `SELECT order_uid FROM orders ORDER BY date_created DESC LIMIT $1`
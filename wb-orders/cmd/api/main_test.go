@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"wb-orders/internal/models"
+)
+
+func TestOrderViewFormatsPayment(t *testing.T) {
+	o := models.Order{Locale: "en", Payment: models.Payment{
+		Currency:     "USD",
+		Amount:       models.Money{Minor: 1817},
+		DeliveryCost: models.Money{Minor: 1500},
+		GoodsTotal:   models.Money{Minor: 317},
+	}}
+	o.BindCurrency()
+	b, err := json.Marshal(newOrderView(o))
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var got struct {
+		Payment   map[string]any    `json:"payment"`
+		Formatted map[string]string `json:"formatted"`
+	}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	want := map[string]string{"amount": "$18.17", "delivery_cost": "$15.00", "goods_total": "$3.17", "custom_fee": "$0.00"}
+	for k, v := range want {
+		if got.Formatted[k] != v {
+			t.Errorf("formatted.%s = %q, want %q", k, got.Formatted[k], v)
+		}
+	}
+	// суммы в payment остаются минорными единицами
+	if got.Payment["amount"] != float64(1817) {
+		t.Errorf("payment.amount = %v, want 1817", got.Payment["amount"])
+	}
+}
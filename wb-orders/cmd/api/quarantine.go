@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"wb-orders/internal/decode"
+	"wb-orders/internal/quarantine"
+	"wb-orders/internal/storage"
+)
+
+// quarantineView — запись карантина с сообщением: JSON как есть, если
+// он валиден, иначе строкой.
+type quarantineView struct {
+	storage.QuarantineEntry
+	Raw    any `json:"raw"`
+	Edited any `json:"edited,omitempty"`
+}
+
+func newQuarantineView(e storage.QuarantineEntry) quarantineView {
+	return quarantineView{QuarantineEntry: e, Raw: payloadView(e.Raw), Edited: payloadView(e.Edited)}
+}
+
+func payloadView(b []byte) any {
+	switch {
+	case b == nil:
+		return nil
+	case json.Valid(b):
+		return json.RawMessage(b)
+	}
+	return string(b)
+}
+
+// registerQuarantine — эндпоинты поддержки для карантина:
+//
+//	GET  /admin/quarantine?status=pending&limit=50&offset=0 — список
+//	GET  /admin/quarantine/{id}                             — запись с сообщением
+//	POST /admin/quarantine/{id}/retry                       — повтор; тело (если есть) — исправленный заказ
+//	POST /admin/quarantine/{id}/discard                     — отбросить
+func registerQuarantine(mux *http.ServeMux, q *quarantine.Service) {
+	mux.HandleFunc("GET /admin/quarantine", func(w http.ResponseWriter, r *http.Request) {
+		limit, offset := 50, 0
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 || n > 500 {
+				http.Error(w, "limit must be 1..500", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		if v := r.URL.Query().Get("offset"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "bad offset", http.StatusBadRequest)
+				return
+			}
+			offset = n
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		defer cancel()
+		list, err := q.List(ctx, r.URL.Query().Get("status"), limit, offset)
+		if err != nil {
+			http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, list)
+	})
+
+	mux.HandleFunc("GET /admin/quarantine/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, ok := quarantineID(w, r)
+		if !ok {
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		defer cancel()
+		e, err := q.Get(ctx, id)
+		if err != nil {
+			writeQuarantineError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, newQuarantineView(e))
+	})
+
+	mux.HandleFunc("POST /admin/quarantine/{id}/retry", func(w http.ResponseWriter, r *http.Request) {
+		id, ok := quarantineID(w, r)
+		if !ok {
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, decode.DefaultMaxSize+1))
+		if err != nil {
+			http.Error(w, "read body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(body) > decode.DefaultMaxSize {
+			http.Error(w, "body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		var edited []byte
+		if len(body) > 0 {
+			edited = body
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+		o, err := q.Retry(ctx, id, edited)
+		if err != nil {
+			writeQuarantineError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, newOrderView(o))
+	})
+
+	mux.HandleFunc("POST /admin/quarantine/{id}/discard", func(w http.ResponseWriter, r *http.Request) {
+		id, ok := quarantineID(w, r)
+		if !ok {
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+		defer cancel()
+		if err := q.Discard(ctx, id); err != nil {
+			writeQuarantineError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func quarantineID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "bad quarantine id", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+func writeQuarantineError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, storage.ErrQuarantineNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, storage.ErrNotPending):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, quarantine.ErrRetryFailed):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		http.Error(w, "db error: "+err.Error(), http.StatusInternalServerError)
+	}
+}
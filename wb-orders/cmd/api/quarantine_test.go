@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"wb-orders/internal/storage"
+)
+
+func TestPayloadView(t *testing.T) {
+	if v := payloadView(nil); v != nil {
+		t.Errorf("nil: got %#v, want nil", v)
+	}
+	if v, ok := payloadView([]byte(`{"a":1}`)).(json.RawMessage); !ok || string(v) != `{"a":1}` {
+		t.Errorf("valid JSON: got %#v, want json.RawMessage", v)
+	}
+	if v, ok := payloadView([]byte(`{"a":`)).(string); !ok || v != `{"a":` {
+		t.Errorf("broken JSON: got %#v, want string", v)
+	}
+}
+
+func TestQuarantineViewJSON(t *testing.T) {
+	e := storage.QuarantineEntry{ID: 7, Stage: "decode", Raw: []byte(`not json`), Edited: []byte(`{"order_uid":"x"}`)}
+	b, err := json.Marshal(newQuarantineView(e))
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var got map[string]any
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if got["raw"] != "not json" {
+		t.Errorf("raw = %#v, want string", got["raw"])
+	}
+	if ed, ok := got["edited"].(map[string]any); !ok || ed["order_uid"] != "x" {
+		t.Errorf("edited = %#v, want object", got["edited"])
+	}
+
+	// Без правки поле edited не выводится
+	e.Edited = nil
+	b, _ = json.Marshal(newQuarantineView(e))
+	got = nil
+	_ = json.Unmarshal(b, &got)
+	if _, ok := got["edited"]; ok {
+		t.Errorf("edited present without edit: %s", b)
+	}
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"wb-orders/internal/models"
+)
+
+// profile — «страна» заказа: локаль, валюта, диапазоны цен и справочники
+// для адреса. Цены и доставка — в основных единицах валюты.
+type profile struct {
+	locale   string
+	currency string
+	phone    string // префикс телефона
+	zipLen   int
+	priceMin int64
+	priceMax int64
+	delivery []int64
+	names    []string
+	cities   []string
+	regions  []string
+	streets  []string
+	services []string
+	banks    []string
+}
+
+var profiles = []profile{
+	{
+		locale: "ru", currency: "RUB", phone: "+7", zipLen: 6,
+		priceMin: 150, priceMax: 12000, delivery: []int64{0, 0, 99, 199, 299},
+		names:    []string{"Иван Петров", "Анна Смирнова", "Дмитрий Козлов", "Ольга Новикова", "Сергей Морозов"},
+		cities:   []string{"Москва", "Санкт-Петербург", "Казань", "Новосибирск", "Екатеринбург"},
+		regions:  []string{"Московская область", "Ленинградская область", "Татарстан", "Новосибирская область", "Свердловская область"},
+		streets:  []string{"ул. Ленина", "пр. Мира", "ул. Гагарина", "ул. Садовая", "Невский пр."},
+		services: []string{"wb", "cdek", "boxberry", "pochta"},
+		banks:    []string{"sber", "tinkoff", "alpha", "vtb"},
+	},
+	{
+		locale: "ru", currency: "BYN", phone: "+375", zipLen: 6,
+		priceMin: 5, priceMax: 400, delivery: []int64{0, 3, 5},
+		names:    []string{"Алесь Ковалёв", "Наталья Шевчук", "Павел Гринько"},
+		cities:   []string{"Минск", "Гомель", "Брест"},
+		regions:  []string{"Минская область", "Гомельская область", "Брестская область"},
+		streets:  []string{"пр. Независимости", "ул. Советская", "ул. Кирова"},
+		services: []string{"wb", "belpost"},
+		banks:    []string{"belarusbank", "priorbank"},
+	},
+	{
+		locale: "kk", currency: "KZT", phone: "+7", zipLen: 6,
+		priceMin: 900, priceMax: 60000, delivery: []int64{0, 500, 990},
+		names:    []string{"Айгерим Садыкова", "Нурлан Абенов", "Дана Касымова"},
+		cities:   []string{"Алматы", "Астана", "Шымкент"},
+		regions:  []string{"Алматинская область", "Акмолинская область", "Туркестанская область"},
+		streets:  []string{"пр. Абая", "ул. Толе би", "пр. Достык"},
+		services: []string{"wb", "kazpost"},
+		banks:    []string{"kaspi", "halyk", "jusan"},
+	},
+	{
+		locale: "en", currency: "USD", phone: "+1", zipLen: 5,
+		priceMin: 3, priceMax: 250, delivery: []int64{0, 5, 10, 15},
+		names:    []string{"John Smith", "Emily Johnson", "Michael Brown", "Sarah Davis"},
+		cities:   []string{"New York", "Los Angeles", "Chicago", "Houston"},
+		regions:  []string{"New York", "California", "Illinois", "Texas"},
+		streets:  []string{"Main St 12", "Oak Ave 7", "Maple Dr 301", "Broadway 1500"},
+		services: []string{"ups", "fedex", "usps"},
+		banks:    []string{"chase", "citi", "wellsfargo"},
+	},
+	{
+		locale: "en", currency: "GBP", phone: "+44", zipLen: 6,
+		priceMin: 3, priceMax: 200, delivery: []int64{0, 4, 8},
+		names:    []string{"Oliver Taylor", "Amelia Wilson", "Harry Evans"},
+		cities:   []string{"London", "Manchester", "Bristol"},
+		regions:  []string{"Greater London", "Greater Manchester", "Bristol"},
+		streets:  []string{"Baker St 221", "High St 5", "King's Rd 40"},
+		services: []string{"royalmail", "dpd"},
+		banks:    []string{"barclays", "hsbc", "monzo"},
+	},
+	{
+		locale: "de", currency: "EUR", phone: "+49", zipLen: 5,
+		priceMin: 3, priceMax: 220, delivery: []int64{0, 5, 7},
+		names:    []string{"Lukas Müller", "Mia Schmidt", "Jonas Weber"},
+		cities:   []string{"Berlin", "München", "Hamburg"},
+		regions:  []string{"Berlin", "Bayern", "Hamburg"},
+		streets:  []string{"Hauptstraße 3", "Bahnhofstraße 17", "Gartenweg 9"},
+		services: []string{"dhl", "hermes"},
+		banks:    []string{"sparkasse", "commerzbank", "n26"},
+	},
+	{
+		locale: "fr", currency: "EUR", phone: "+33", zipLen: 5,
+		priceMin: 3, priceMax: 220, delivery: []int64{0, 5, 9},
+		names:    []string{"Louis Martin", "Chloé Bernard", "Hugo Dubois"},
+		cities:   []string{"Paris", "Lyon", "Marseille"},
+		regions:  []string{"Île-de-France", "Auvergne-Rhône-Alpes", "Provence-Alpes-Côte d'Azur"},
+		streets:  []string{"Rue de Rivoli 10", "Avenue Foch 4", "Rue Victor Hugo 22"},
+		services: []string{"colissimo", "chronopost"},
+		banks:    []string{"bnp", "societegenerale", "creditagricole"},
+	},
+	{
+		locale: "he", currency: "ILS", phone: "+972", zipLen: 7,
+		priceMin: 10, priceMax: 800, delivery: []int64{0, 15, 30},
+		names:    []string{"Test Testov", "Noa Levi", "Yosef Cohen"},
+		cities:   []string{"Kiryat Mozkin", "Tel Aviv", "Haifa"},
+		regions:  []string{"Kraiot", "Tel Aviv District", "Haifa District"},
+		streets:  []string{"Ploshad Mira 15", "Dizengoff St 50", "Herzl St 8"},
+		services: []string{"meest", "israelpost"},
+		banks:    []string{"alpha", "leumi", "hapoalim"},
+	},
+	{
+		locale: "en", currency: "JPY", phone: "+81", zipLen: 7,
+		priceMin: 300, priceMax: 30000, delivery: []int64{0, 500, 800},
+		names:    []string{"Haruto Sato", "Yui Suzuki", "Ren Takahashi"},
+		cities:   []string{"Tokyo", "Osaka", "Sapporo"},
+		regions:  []string{"Tokyo", "Osaka", "Hokkaido"},
+		streets:  []string{"Chuo-dori 1-2-3", "Midosuji 4-5", "Odori 7"},
+		services: []string{"yamato", "sagawa"},
+		banks:    []string{"mufg", "mizuho", "smbc"},
+	},
+}
+
+type product struct {
+	name  string
+	brand string
+	sizes []string
+}
+
+var products = []product{
+	{"Mascaras", "Vivienne Sabo", []string{"0"}},
+	{"Футболка", "Gloria Jeans", []string{"S", "M", "L", "XL"}},
+	{"Кроссовки", "Nike", []string{"40", "41", "42", "43", "44"}},
+	{"Джинсы", "Levi's", []string{"30", "32", "34"}},
+	{"Наушники", "Xiaomi", []string{"0"}},
+	{"Рюкзак", "Xiaomi", []string{"0"}},
+	{"Крем для рук", "Nivea", []string{"0"}},
+	{"Платье", "Zarina", []string{"42", "44", "46", "48"}},
+	{"Чехол для телефона", "Spigen", []string{"0"}},
+	{"Book", "Penguin", []string{"0"}},
+	{"Socks", "Uniqlo", []string{"S", "M", "L"}},
+	{"Power bank", "Anker", []string{"0"}},
+}
+
+// Коды статусов новых заказов (см. models/status.go); чаще всего — «собирается».
+var itemStatuses = []models.ItemStatus{100, 200, 201, 202, 202, 202, 300, 301}
+
+// Виды намеренно испорченных сообщений: каждое должно отсечься на своей
+// стадии консьюмера (decode / validate) и уйти в DLQ.
+const (
+	brokenJSON       = "broken_json"
+	brokenMoneyType  = "money_as_string"
+	brokenGoodsTotal = "goods_total_mismatch"
+	brokenAmount     = "amount_mismatch"
+	brokenNegative   = "negative_delivery"
+	brokenStatus     = "unknown_status"
+	brokenCurrency   = "bad_currency"
+	brokenTrack      = "empty_track_number"
+	brokenKey        = "key_mismatch" // тело целое, но ключ — чужой order_uid
+)
+
+var brokenKinds = []string{
+	brokenJSON, brokenMoneyType, brokenGoodsTotal, brokenAmount,
+	brokenNegative, brokenStatus, brokenCurrency, brokenTrack, brokenKey,
+}
+
+// generator выдаёт заказы детерминированно для заданного seed.
+type generator struct {
+	rnd     *rand.Rand
+	invalid float64   // доля испорченных, 0..1
+	base    time.Time // от неё отсчитываются date_created — тоже часть seed
+}
+
+func newGenerator(seed int64, invalidPct float64, base time.Time) *generator {
+	return &generator{
+		rnd:     rand.New(rand.NewSource(seed)),
+		invalid: invalidPct / 100,
+		base:    base.UTC(),
+	}
+}
+
+// Next возвращает ключ, тело сообщения и вид порчи ("" — валидный заказ).
+func (g *generator) Next() (key string, value []byte, broken string, err error) {
+	o := g.order()
+	if g.rnd.Float64() >= g.invalid {
+		value, err = json.Marshal(o)
+		return o.OrderUID, value, "", err
+	}
+
+	broken = brokenKinds[g.rnd.Intn(len(brokenKinds))]
+	value, err = g.corrupt(o, broken)
+	key = o.OrderUID
+	if broken == brokenKey {
+		key = g.hex(16) + "test"
+	}
+	return key, value, broken, err
+}
+
+// TraceParent — случайный W3C traceparent для заголовка сообщения.
+func (g *generator) TraceParent() string {
+	return "00-" + g.hex(32) + "-" + g.hex(16) + "-01"
+}
+
+func (g *generator) order() models.Order {
+	p := profiles[g.rnd.Intn(len(profiles))]
+	cur, _ := models.LookupCurrency(p.currency)
+	scale := pow10(cur.Exponent)
+
+	uid := g.hex(16) + "test"
+	track := "WBIL" + strings.ToUpper(g.letters(10))
+	created := g.base.Add(-time.Duration(g.rnd.Int63n(int64(30 * 24 * time.Hour)))).Truncate(time.Second)
+
+	n := 1 + g.rnd.Intn(5)
+	items := make([]models.Item, 0, n)
+	for i := 0; i < n; i++ {
+		pr := products[g.rnd.Intn(len(products))]
+		price := (p.priceMin + g.rnd.Int63n(p.priceMax-p.priceMin+1)) * scale
+		if scale > 1 && g.rnd.Intn(2) == 0 {
+			price -= scale / 100 // «…,99»
+		}
+		sale := []int{0, 0, 5, 10, 15, 30, 50}[g.rnd.Intn(7)]
+		items = append(items, models.Item{
+			ChrtID:      1_000_000 + g.rnd.Intn(9_000_000),
+			TrackNumber: track,
+			Price:       models.NewMoney(price, p.currency),
+			RID:         g.hex(17) + "test",
+			Name:        pr.name,
+			Sale:        sale,
+			Size:        pr.sizes[g.rnd.Intn(len(pr.sizes))],
+			TotalPrice:  models.NewMoney(price*int64(100-sale)/100, p.currency),
+			NmID:        1_000_000 + g.rnd.Intn(9_000_000),
+			Brand:       pr.brand,
+			Status:      itemStatuses[g.rnd.Intn(len(itemStatuses))],
+		})
+	}
+
+	city := g.rnd.Intn(len(p.cities)) // регион — парный городу
+	o := models.Order{
+		OrderUID:    uid,
+		TrackNumber: track,
+		Entry:       "WBIL",
+		Delivery: models.Delivery{
+			Name:    pick(g.rnd, p.names),
+			Phone:   p.phone + g.digits(10),
+			Zip:     g.digits(p.zipLen),
+			City:    p.cities[city],
+			Address: pick(g.rnd, p.streets),
+			Region:  p.regions[city],
+			Email:   g.letters(6) + "@" + pick(g.rnd, []string{"gmail.com", "mail.ru", "yandex.ru", "outlook.com"}),
+		},
+		Payment: models.Payment{
+			Transaction: uid,
+			Currency:    p.currency,
+			Provider:    "wbpay",
+			PaymentDT:   created.Add(time.Duration(g.rnd.Intn(600)) * time.Second).Unix(),
+			Bank:        pick(g.rnd, p.banks),
+			CustomFee:   models.NewMoney(0, p.currency),
+		},
+		Items:           items,
+		Locale:          p.locale,
+		CustomerID:      g.letters(8),
+		DeliveryService: pick(g.rnd, p.services),
+		ShardKey:        strconv.Itoa(g.rnd.Intn(10)),
+		SmID:            g.rnd.Intn(100),
+		DateCreated:     created,
+		OofShard:        strconv.Itoa(1 + g.rnd.Intn(2)),
+	}
+
+	// Итоги считаем тем же кодом, которым их проверяет storage.ValidateOrder.
+	pay := &o.Payment
+	pay.GoodsTotal, _ = o.ItemsTotal()
+	pay.DeliveryCost = models.NewMoney(pick(g.rnd, p.delivery)*scale, p.currency)
+	if g.rnd.Intn(10) == 0 {
+		pay.CustomFee = models.NewMoney(pay.GoodsTotal.Minor/20, p.currency) // пошлина 5%
+	}
+	pay.Amount, _ = pay.ExpectedAmount()
+	return o
+}
+
+// corrupt портит заказ так, чтобы консьюмер его отклонил.
+func (g *generator) corrupt(o models.Order, kind string) ([]byte, error) {
+	switch kind {
+	case brokenGoodsTotal:
+		o.Payment.GoodsTotal.Minor++
+	case brokenAmount:
+		o.Payment.Amount.Minor += 100
+	case brokenNegative:
+		o.Payment.DeliveryCost.Minor = -o.Payment.DeliveryCost.Minor - 1
+	case brokenStatus:
+		o.Items[0].Status = 999
+	case brokenCurrency:
+		o.Payment.Currency = "rubles"
+	case brokenTrack:
+		o.TrackNumber = ""
+	}
+
+	data, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case brokenJSON:
+		return data[:len(data)/2], nil
+	case brokenMoneyType:
+		s := fmt.Sprintf(`"amount":%d`, o.Payment.Amount.Minor)
+		return []byte(strings.Replace(string(data), s, `"amount":"`+o.Payment.Amount.Major()+`"`, 1)), nil
+	}
+	return data, nil
+}
+
+const hexDigits = "0123456789abcdef"
+
+func (g *generator) hex(n int) string     { return g.str(n, hexDigits) }
+func (g *generator) digits(n int) string  { return g.str(n, "0123456789") }
+func (g *generator) letters(n int) string { return g.str(n, "abcdefghijklmnopqrstuvwxyz") }
+
+func (g *generator) str(n int, alphabet string) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = alphabet[g.rnd.Intn(len(alphabet))]
+	}
+	return string(b)
+}
+
+func pick[T any](r *rand.Rand, xs []T) T { return xs[r.Intn(len(xs))] }
+
+func pow10(n int) int64 {
+	p := int64(1)
+	for i := 0; i < n; i++ {
+		p *= 10
+	}
+	return p
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"wb-orders/internal/cache"
+	"wb-orders/internal/decode"
+	"wb-orders/internal/ingest"
+	"wb-orders/internal/models"
+	"wb-orders/internal/normalize"
+	"wb-orders/internal/pipeline"
+	"wb-orders/internal/storage"
+)
+
+var testBase = time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+// prepare — путь сообщения в консьюмере до записи в БД.
+func prepare(key string, value []byte) error {
+	chain := pipeline.Default(decode.New(decode.ModeStrict, 0), normalize.New(), cache.NewLRU(1))
+	return chain.Prepare(context.Background(), &pipeline.Item{Raw: value, Meta: ingest.Meta{Key: key}})
+}
+
+func TestGeneratedOrdersAreValid(t *testing.T) {
+	g := newGenerator(1, 0, testBase)
+	for i := 0; i < 500; i++ {
+		key, value, broken, err := g.Next()
+		if err != nil || broken != "" {
+			t.Fatalf("#%d: broken=%q err=%v", i, broken, err)
+		}
+		var o models.Order
+		if err := json.Unmarshal(value, &o); err != nil {
+			t.Fatalf("#%d: unmarshal: %v", i, err)
+		}
+		if err := storage.ValidateOrder(o); err != nil {
+			t.Fatalf("#%d: ValidateOrder: %v\n%s", i, err, value)
+		}
+		if key != o.OrderUID {
+			t.Fatalf("#%d: key %q != order_uid %q", i, key, o.OrderUID)
+		}
+		if err := prepare(key, value); err != nil {
+			t.Fatalf("#%d: consumer chain: %v\n%s", i, err, value)
+		}
+	}
+}
+
+func TestCorruptedOrdersAreRejected(t *testing.T) {
+	g := newGenerator(2, 0, testBase)
+	for _, kind := range brokenKinds {
+		for i := 0; i < 20; i++ {
+			o := g.order()
+			value, err := g.corrupt(o, kind)
+			if err != nil {
+				t.Fatalf("%s: %v", kind, err)
+			}
+			key := o.OrderUID
+			if kind == brokenKey {
+				key = "other" + key
+			}
+
+			// Тело, которое вообще разбирается, должно не пройти
+			// ValidateOrder — кроме чужого ключа: там тело целое.
+			var parsed models.Order
+			if json.Unmarshal(value, &parsed) == nil {
+				verr := storage.ValidateOrder(parsed)
+				if kind == brokenKey && verr != nil {
+					t.Fatalf("%s: body must stay valid: %v", kind, verr)
+				}
+				if kind != brokenKey && verr == nil {
+					t.Fatalf("%s: ValidateOrder accepted\n%s", kind, value)
+				}
+			}
+
+			err = prepare(key, value)
+			if _, ok := pipeline.IsReject(err); !ok {
+				t.Fatalf("%s: consumer chain = %v, want reject\n%s", kind, err, value)
+			}
+		}
+	}
+}
+
+func TestGeneratorIsDeterministic(t *testing.T) {
+	a, b := newGenerator(42, 30, testBase), newGenerator(42, 30, testBase)
+	kinds := map[string]bool{}
+	for i := 0; i < 200; i++ {
+		ka, va, ba, _ := a.Next()
+		kb, vb, bb, _ := b.Next()
+		if ka != kb || ba != bb || !bytes.Equal(va, vb) {
+			t.Fatalf("#%d: same seed, different output", i)
+		}
+		kinds[ba] = true
+	}
+	if !kinds[""] || len(kinds) < 2 {
+		t.Errorf("invalid share 30%% gave kinds %v", kinds)
+	}
+}
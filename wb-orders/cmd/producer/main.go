@@ -0,0 +1,184 @@
+// cmd/producer — генератор тестовых заказов в Kafka.
+//
+//	go run ./cmd/producer -count 1000 -rate 50 -invalid 5 -seed 42
+//
+// Брокеры, TLS/SASL и топик берутся из .env (как у API), топик можно
+// переопределить флагом. Ключ сообщения — order_uid.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/segmentio/kafka-go"
+
+	"wb-orders/internal/decode"
+	ikafka "wb-orders/internal/kafka"
+)
+
+// Сколько сообщений максимум уходит одним WriteMessages.
+const maxChunk = 100
+
+// Значение заголовка producer у сгенерированных сообщений.
+const producerName = "wb-orders-producer"
+
+func main() {
+	var (
+		seed    = flag.Int64("seed", 0, "seed генератора (0 — случайный, печатается в лог)")
+		count   = flag.Int("count", 100, "сколько заказов отправить")
+		rate    = flag.Float64("rate", 0, "заказов в секунду (0 — без ограничения)")
+		invalid = flag.Float64("invalid", 0, "процент намеренно испорченных сообщений, 0..100")
+		topic   = flag.String("topic", "", "топик (по умолчанию первый из KAFKA_TOPIC_ORDERS)")
+		base    = flag.String("base", "", "от какого момента (RFC3339) отсчитывать date_created; по умолчанию начало текущих суток UTC")
+		dryRun  = flag.Bool("dry-run", false, "печатать сообщения в stdout вместо отправки")
+	)
+	flag.Parse()
+
+	if *invalid < 0 || *invalid > 100 {
+		log.Fatalf("-invalid must be in 0..100, got %v", *invalid)
+	}
+	if *count <= 0 || *rate < 0 {
+		log.Fatal("-count must be positive, -rate non-negative")
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	baseTime := time.Now().UTC().Truncate(24 * time.Hour)
+	if *base != "" {
+		t, err := time.Parse(time.RFC3339, *base)
+		if err != nil {
+			log.Fatalf("-base: %v", err)
+		}
+		baseTime = t
+	}
+	gen := newGenerator(*seed, *invalid, baseTime)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *dryRun {
+		for i := 0; i < *count; i++ {
+			_, value, _, err := gen.Next()
+			if err != nil {
+				log.Fatalf("generate: %v", err)
+			}
+			fmt.Println(string(value))
+		}
+		return
+	}
+
+	if err := godotenv.Load(".env"); err != nil {
+		log.Printf(".env not loaded: %v (ok if vars set by shell/docker)", err)
+	}
+	cfg, err := ikafka.LoadConfig()
+	if err != nil {
+		log.Fatalf("kafka config: %v", err)
+	}
+	if *topic == "" {
+		*topic = cfg.Topics[0]
+	}
+	transport, err := cfg.Transport()
+	if err != nil {
+		log.Fatalf("kafka transport: %v", err)
+	}
+	w := &kafka.Writer{
+		Addr:                   kafka.TCP(cfg.Brokers...),
+		Transport:              transport,
+		Topic:                  *topic,
+		Balancer:               &kafka.Hash{}, // один order_uid — одна партиция
+		RequiredAcks:           kafka.RequireAll,
+		AllowAutoTopicCreation: true,
+		BatchSize:              maxChunk,
+		BatchTimeout:           10 * time.Millisecond,
+	}
+	defer w.Close()
+
+	log.Printf("producer: topic=%s count=%d rate=%v invalid=%v%% seed=%d", *topic, *count, *rate, *invalid, *seed)
+	st, err := produce(ctx, w, gen, *count, *rate)
+	log.Printf("producer: sent=%d valid=%d invalid=%d in %v %v",
+		st.sent, st.sent-st.invalid(), st.invalid(), st.elapsed.Round(time.Millisecond), st.broken)
+	if err != nil {
+		log.Fatalf("producer: %v", err)
+	}
+}
+
+type produceStats struct {
+	sent    int
+	broken  map[string]int // вид порчи → сколько
+	elapsed time.Duration
+}
+
+func (s produceStats) invalid() int {
+	n := 0
+	for _, c := range s.broken {
+		n += c
+	}
+	return n
+}
+
+// produce отправляет count сообщений, держа среднюю скорость rate в секунду.
+func produce(ctx context.Context, w *kafka.Writer, gen *generator, count int, rate float64) (produceStats, error) {
+	st := produceStats{broken: map[string]int{}}
+	start := time.Now()
+	defer func() { st.elapsed = time.Since(start) }()
+
+	tick := time.NewTicker(10 * time.Millisecond)
+	defer tick.Stop()
+	lastLog := start
+
+	for st.sent < count {
+		n := min(maxChunk, count-st.sent)
+		if rate > 0 {
+			// сколько должно быть отправлено к этому моменту
+			due := int(rate*time.Since(start).Seconds()) + 1 - st.sent
+			if due <= 0 {
+				select {
+				case <-tick.C:
+					continue
+				case <-ctx.Done():
+					return st, ctx.Err()
+				}
+			}
+			n = min(n, due)
+		}
+
+		msgs := make([]kafka.Message, 0, n)
+		for i := 0; i < n; i++ {
+			key, value, broken, err := gen.Next()
+			if err != nil {
+				return st, fmt.Errorf("generate: %w", err)
+			}
+			msgs = append(msgs, kafka.Message{
+				Key:   []byte(key),
+				Value: value,
+				Headers: []kafka.Header{
+					{Key: ikafka.HeaderTraceParent, Value: []byte(gen.TraceParent())},
+					{Key: ikafka.HeaderProducer, Value: []byte(producerName)},
+					{Key: ikafka.HeaderContentType, Value: []byte("application/json")},
+					{Key: decode.VersionHeader, Value: []byte(strconv.Itoa(decode.CurrentVersion))},
+				},
+			})
+			if broken != "" {
+				st.broken[broken]++
+			}
+		}
+		if err := w.WriteMessages(ctx, msgs...); err != nil {
+			return st, fmt.Errorf("write: %w", err)
+		}
+		st.sent += n
+
+		if time.Since(lastLog) >= 5*time.Second {
+			lastLog = time.Now()
+			log.Printf("producer: %d/%d sent", st.sent, count)
+		}
+	}
+	return st, nil
+}
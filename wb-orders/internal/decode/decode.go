@@ -0,0 +1,183 @@
+// internal/decode/decode.go
+package decode
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"wb-orders/internal/models"
+)
+
+type Mode string
+
+const (
+	// ModeStrict — неизвестные поля, дубли ключей и лишние данные после JSON
+	// считаются ошибкой, сообщение отклоняется.
+	ModeStrict Mode = "strict"
+	// ModeLenient — сообщение принимается, но неизвестные поля, дубли и
+	// лишние данные после JSON учитываются в счётчиках.
+	ModeLenient Mode = "lenient"
+)
+
+// DefaultMaxSize — предельный размер сообщения по умолчанию (1 МиБ).
+const DefaultMaxSize = 1 << 20
+
+var (
+	ErrTooLarge     = errors.New("payload too large")
+	ErrUnknownField = errors.New("unknown field")
+	ErrDuplicateKey = errors.New("duplicate key")
+	ErrTrailingData = errors.New("unexpected data after top-level value")
+)
+
+// ParseMode разбирает значение из env; пустое — lenient.
+func ParseMode(s string) (Mode, error) {
+	switch Mode(strings.ToLower(strings.TrimSpace(s))) {
+	case "", ModeLenient:
+		return ModeLenient, nil
+	case ModeStrict:
+		return ModeStrict, nil
+	}
+	return "", fmt.Errorf("unknown decode mode %q (want strict|lenient)", s)
+}
+
+// Decoder разбирает JSON заказа и ведёт счётчики по полям.
+type Decoder struct {
+	mode    Mode
+	maxSize int
+
+	mu       sync.Mutex
+	unknown  map[string]uint64 // путь поля → сколько раз встретилось
+	dups     map[string]uint64 // путь ключа → сколько раз продублирован
+	trailing uint64            // сообщений с данными после JSON
+	rejected map[string]uint64 // причина → сколько сообщений отклонено
+}
+
+func New(mode Mode, maxSize int) *Decoder {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	return &Decoder{
+		mode:     mode,
+		maxSize:  maxSize,
+		unknown:  make(map[string]uint64),
+		dups:     make(map[string]uint64),
+		rejected: make(map[string]uint64),
+	}
+}
+
+// Decode разбирает сообщение с заказом. version — версия схемы из заголовка
+// сообщения; если пусто, берётся поле schema_version из тела, иначе v1.
+// Декодер нужной версии поднимает payload до текущей models.Order.
+func (d *Decoder) Decode(data []byte, version string) (models.Order, error) {
+	if len(data) > d.maxSize {
+		d.reject("too_large")
+		return models.Order{}, fmt.Errorf("%w: %d > %d bytes", ErrTooLarge, len(data), d.maxSize)
+	}
+
+	v, err := resolveVersion(data, version)
+	if err != nil {
+		d.reject("version")
+		return models.Order{}, err
+	}
+	up, ok := lookupVersion(v)
+	if !ok {
+		d.reject("version")
+		return models.Order{}, fmt.Errorf("%w: %d", ErrUnknownVersion, v)
+	}
+	return up(d, data)
+}
+
+// Into разбирает data в *out с проверками текущего режима.
+// Используется декодерами версий для своих структур.
+func (d *Decoder) Into(data []byte, out any) error {
+	rep, err := inspect(data, reflect.TypeOf(out).Elem())
+	if err != nil {
+		d.reject("syntax")
+		return err
+	}
+	d.record(rep)
+
+	if d.mode == ModeStrict {
+		if rep.trailing {
+			d.reject("trailing_data")
+			return ErrTrailingData
+		}
+		if len(rep.duplicates) > 0 {
+			d.reject("duplicate_key")
+			return fmt.Errorf("%w: %s", ErrDuplicateKey, strings.Join(rep.duplicates, ", "))
+		}
+		if len(rep.unknown) > 0 {
+			d.reject("unknown_field")
+			return fmt.Errorf("%w: %s", ErrUnknownField, strings.Join(rep.unknown, ", "))
+		}
+	}
+
+	// Неизвестные поля уже проверены inspect (с учётом служебного
+	// schema_version), поэтому DisallowUnknownFields здесь не нужен.
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(out); err != nil {
+		d.reject("type")
+		return err
+	}
+	return nil
+}
+
+// Stats — снимок счётчиков для /debug/decode.
+type Stats struct {
+	Mode          Mode              `json:"mode"`
+	MaxSize       int               `json:"max_size"`
+	Versions      []int             `json:"versions"`
+	UnknownFields map[string]uint64 `json:"unknown_fields"`
+	DuplicateKeys map[string]uint64 `json:"duplicate_keys"`
+	TrailingData  uint64            `json:"trailing_data"`
+	Rejected      map[string]uint64 `json:"rejected"`
+}
+
+func (d *Decoder) Stats() Stats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return Stats{
+		Mode:          d.mode,
+		MaxSize:       d.maxSize,
+		Versions:      Versions(),
+		UnknownFields: copyCounts(d.unknown),
+		DuplicateKeys: copyCounts(d.dups),
+		TrailingData:  d.trailing,
+		Rejected:      copyCounts(d.rejected),
+	}
+}
+
+func (d *Decoder) record(rep report) {
+	if len(rep.unknown) == 0 && len(rep.duplicates) == 0 && !rep.trailing {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if rep.trailing {
+		d.trailing++
+	}
+	for _, p := range rep.unknown {
+		d.unknown[p]++
+	}
+	for _, p := range rep.duplicates {
+		d.dups[p]++
+	}
+}
+
+func (d *Decoder) reject(reason string) {
+	d.mu.Lock()
+	d.rejected[reason]++
+	d.mu.Unlock()
+}
+
+func copyCounts(m map[string]uint64) map[string]uint64 {
+	out := make(map[string]uint64, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,187 @@
+// internal/decode/inspect.go
+package decode
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// report — что нашли при обходе JSON: пути неизвестных полей
+// ("order_uuid", "items[].colour"), продублированных ключей и есть ли
+// что-то после самого JSON.
+type report struct {
+	unknown    []string
+	duplicates []string
+	trailing   bool
+}
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// inspect обходит JSON потоково (Token) параллельно с типом t.
+// encoding/json молча берёт последний из дублей и пропускает лишние поля,
+// поэтому их приходится искать отдельно.
+func inspect(data []byte, t reflect.Type) (report, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	w := walker{dec: dec}
+	if err := w.value(t, ""); err != nil {
+		return report{}, err
+	}
+	// encoding/json читает первое значение и хвост не замечает
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		w.rep.trailing = true
+	}
+	return w.rep, nil
+}
+
+type walker struct {
+	dec *json.Decoder
+	rep report
+}
+
+// value разбирает одно значение; t == nil — тип неизвестен, только проходим.
+func (w *walker) value(t reflect.Type, path string) error {
+	tok, err := w.dec.Token()
+	if err != nil {
+		return err
+	}
+	switch tok {
+	case json.Delim('{'):
+		return w.object(t, path)
+	case json.Delim('['):
+		return w.array(t, path)
+	}
+	return nil
+}
+
+func (w *walker) object(t reflect.Type, path string) error {
+	fields := fieldsOf(t)
+	seen := make(map[string]bool)
+
+	for w.dec.More() {
+		tok, err := w.dec.Token()
+		if err != nil {
+			return err
+		}
+		key := tok.(string)
+		p := key
+		if path != "" {
+			p = path + "." + key
+		}
+
+		var ft reflect.Type
+		canon := key
+		if fields != nil {
+			name, typ, ok := fields.lookup(key)
+			// служебное поле версии — без учёта регистра, как его читает resolveVersion
+			if !ok && !(path == "" && strings.EqualFold(key, VersionField)) {
+				w.rep.unknown = append(w.rep.unknown, p)
+			}
+			canon, ft = name, typ
+		}
+		// "Order_UID" и "order_uid" попадают в одно поле — это тоже дубль
+		if seen[canon] {
+			w.rep.duplicates = append(w.rep.duplicates, p)
+		}
+		seen[canon] = true
+
+		if err := w.value(ft, p); err != nil {
+			return err
+		}
+	}
+	_, err := w.dec.Token() // '}'
+	return err
+}
+
+func (w *walker) array(t reflect.Type, path string) error {
+	var elem reflect.Type
+	if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+		elem = t.Elem()
+	}
+	for w.dec.More() {
+		if err := w.value(elem, path+"[]"); err != nil {
+			return err
+		}
+	}
+	_, err := w.dec.Token() // ']'
+	return err
+}
+
+// fieldSet — поля структуры по JSON-имени.
+type fieldSet map[string]reflect.Type
+
+// lookup повторяет правило encoding/json: точное совпадение, затем без учёта регистра.
+func (fs fieldSet) lookup(key string) (string, reflect.Type, bool) {
+	if t, ok := fs[key]; ok {
+		return key, t, true
+	}
+	for name, t := range fs {
+		if strings.EqualFold(name, key) {
+			return name, t, true
+		}
+	}
+	return key, nil, false
+}
+
+// fieldsOf — JSON-поля структуры; nil, если t не структура или сам
+// разбирает свой JSON (time.Time, models.Money).
+func fieldsOf(t reflect.Type) fieldSet {
+	t = structOf(t)
+	if t == nil {
+		return nil
+	}
+	fs := make(fieldSet, t.NumField())
+	addFields(fs, t)
+	return fs
+}
+
+// structOf — t без указателей, если это структура со своим разбором
+// полей; иначе nil.
+func structOf(t reflect.Type) reflect.Type {
+	if t == nil {
+		return nil
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || reflect.PointerTo(t).Implements(unmarshalerType) {
+		return nil
+	}
+	return t
+}
+
+// addFields добавляет поля t в fs. Поля встроенной структуры без имени
+// в теге поднимаются наверх, как в encoding/json; свои поля t важнее
+// поднятых (глубже — слабее).
+func addFields(fs fieldSet, t reflect.Type) {
+	own := make(fieldSet, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			// неэкспортируемый встроенный тип тоже отдаёт свои поля
+			if et := structOf(f.Type); et != nil {
+				addFields(fs, et)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		own[name] = f.Type
+	}
+	for name, ft := range own {
+		fs[name] = ft
+	}
+}
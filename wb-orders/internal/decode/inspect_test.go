@@ -0,0 +1,129 @@
+package decode
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"wb-orders/internal/models"
+)
+
+func TestDecodeModes(t *testing.T) {
+	const order = `{"order_uid": "o1", "delivery": {"name": "A"}, "items": [{"chrt_id": 1}]}`
+	big := `{"order_uid": "` + strings.Repeat("x", 200) + `"}`
+
+	for _, tc := range []struct {
+		name    string
+		body    string
+		strict  error  // ошибка в strict; nil — принят
+		lenient error  // то же в lenient
+		reason  string // причина отказа (Stats.Rejected) в strict
+	}{
+		{"clean", order, nil, nil, ""},
+		{"duplicate key", `{"order_uid": "o1", "order_uid": "o2"}`, ErrDuplicateKey, nil, "duplicate_key"},
+		{"duplicate key other case", `{"order_uid": "o1", "Order_UID": "o2"}`, ErrDuplicateKey, nil, "duplicate_key"},
+		{"nested duplicate", `{"delivery": {"name": "A", "name": "B"}}`, ErrDuplicateKey, nil, "duplicate_key"},
+		{"unknown field", `{"order_uid": "o1", "order_uuid": "o1"}`, ErrUnknownField, nil, "unknown_field"},
+		{"nested unknown field", `{"delivery": {"name": "A", "flat": "12"}}`, ErrUnknownField, nil, "unknown_field"},
+		{"unknown field in array", `{"items": [{"chrt_id": 1}, {"colour": "red"}]}`, ErrUnknownField, nil, "unknown_field"},
+		{"unknown object is skipped whole", `{"extra": {"a": [1, {"b": 2}]}, "order_uid": "o1"}`, ErrUnknownField, nil, "unknown_field"},
+		{"trailing garbage", order + ` xyz`, ErrTrailingData, nil, "trailing_data"},
+		{"second value", order + ` {}`, ErrTrailingData, nil, "trailing_data"},
+		{"trailing whitespace", order + " \n\t", nil, nil, ""},
+		{"syntax error", `{"order_uid": "o1",}`, errAny, errAny, "syntax"},
+		{"wrong type", `{"order_uid": 1}`, errAny, errAny, "type"},
+		{"oversize", big, ErrTooLarge, ErrTooLarge, "too_large"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, m := range []struct {
+				mode Mode
+				want error
+			}{{ModeStrict, tc.strict}, {ModeLenient, tc.lenient}} {
+				d := New(m.mode, 128)
+				_, err := d.Decode([]byte(tc.body), "")
+				switch {
+				case m.want == nil && err != nil:
+					t.Errorf("%s: unexpected error %v", m.mode, err)
+				case m.want == errAny && err == nil, m.want != nil && m.want != errAny && !errors.Is(err, m.want):
+					t.Errorf("%s: err = %v, want %v", m.mode, err, m.want)
+				}
+				if m.mode == ModeStrict && tc.reason != "" {
+					if got := d.Stats().Rejected[tc.reason]; got != 1 {
+						t.Errorf("strict: rejected[%s] = %d, want 1 (%v)", tc.reason, got, d.Stats().Rejected)
+					}
+				}
+			}
+		})
+	}
+}
+
+// errAny — ошибка нужна, но какая — не важно (её даёт encoding/json).
+var errAny = errors.New("any error")
+
+func TestLenientCountsFindings(t *testing.T) {
+	d := New(ModeLenient, 0)
+	body := `{"order_uid": "o1", "order_uid": "o2", "items": [{"colour": "red"}]} tail`
+	o, err := d.Decode([]byte(body), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.OrderUID != "o2" {
+		t.Errorf("order_uid = %q, want the last duplicate", o.OrderUID)
+	}
+	st := d.Stats()
+	if st.DuplicateKeys["order_uid"] != 1 || st.UnknownFields["items[].colour"] != 1 || st.TrailingData != 1 {
+		t.Fatalf("stats = %+v", st)
+	}
+}
+
+type base struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type hidden struct {
+	Secret string `json:"secret"`
+}
+
+type withEmbedded struct {
+	base
+	*hidden
+	models.Delivery `json:"delivery"` // имя в теге — обычное поле
+	Name            string            `json:"name"` // своё поле важнее поднятого
+	Ignored         string            `json:"-"`
+}
+
+func TestFieldsOfEmbedded(t *testing.T) {
+	fs := fieldsOf(reflect.TypeOf(withEmbedded{}))
+	for _, name := range []string{"id", "name", "secret", "delivery"} {
+		if _, ok := fs[name]; !ok {
+			t.Errorf("field %q missing: %v", name, fs)
+		}
+	}
+	for _, name := range []string{"base", "hidden", "Ignored", "-", "city"} {
+		if _, ok := fs[name]; ok {
+			t.Errorf("unexpected field %q", name)
+		}
+	}
+	if len(fs) != 4 {
+		t.Errorf("fields = %v, want 4", fs)
+	}
+
+	rep, err := inspect([]byte(`{"id": "1", "secret": "s", "delivery": {"city": "X"}, "city": "Y"}`),
+		reflect.TypeOf(withEmbedded{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.unknown) != 1 || rep.unknown[0] != "city" {
+		t.Errorf("unknown = %v, want [city]", rep.unknown)
+	}
+}
+
+func TestFieldsOfNonStruct(t *testing.T) {
+	for _, v := range []any{models.Money{}, 1, "s", []int{}} {
+		if fs := fieldsOf(reflect.TypeOf(v)); fs != nil {
+			t.Errorf("fieldsOf(%T) = %v, want nil", v, fs)
+		}
+	}
+}
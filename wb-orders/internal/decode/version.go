@@ -0,0 +1,101 @@
+// internal/decode/version.go
+package decode
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"wb-orders/internal/models"
+)
+
+const (
+	// VersionHeader — заголовок Kafka-сообщения с версией схемы.
+	VersionHeader = "schema-version"
+	// VersionField — то же, но полем в корне JSON.
+	VersionField = "schema_version"
+	// CurrentVersion — версия, которой соответствует models.Order.
+	CurrentVersion = 1
+)
+
+var ErrUnknownVersion = errors.New("unknown schema version")
+
+// Upconverter разбирает payload своей версии и приводит его к текущей модели.
+type Upconverter func(d *Decoder, data []byte) (models.Order, error)
+
+var (
+	versionsMu sync.RWMutex
+	versions   = map[int]Upconverter{}
+)
+
+// RegisterVersion добавляет декодер версии v. Новая версия формата —
+// это своя структура payload + функция, которая переводит её в models.Order;
+// старые версии остаются зарегистрированы, пока их кто-то шлёт.
+func RegisterVersion(v int, up Upconverter) {
+	versionsMu.Lock()
+	defer versionsMu.Unlock()
+	if _, dup := versions[v]; dup {
+		panic(fmt.Sprintf("decode: version %d registered twice", v))
+	}
+	versions[v] = up
+}
+
+// Versions — список поддерживаемых версий (для /debug/decode).
+func Versions() []int {
+	versionsMu.RLock()
+	defer versionsMu.RUnlock()
+	out := make([]int, 0, len(versions))
+	for v := range versions {
+		out = append(out, v)
+	}
+	sort.Ints(out)
+	return out
+}
+
+func lookupVersion(v int) (Upconverter, bool) {
+	versionsMu.RLock()
+	defer versionsMu.RUnlock()
+	up, ok := versions[v]
+	return up, ok
+}
+
+func init() {
+	// v1 — исходный формат WB, совпадает с models.Order
+	RegisterVersion(1, func(d *Decoder, data []byte) (models.Order, error) {
+		var ord models.Order
+		if err := d.Into(data, &ord); err != nil {
+			return models.Order{}, err
+		}
+		return ord, nil
+	})
+}
+
+// resolveVersion: заголовок важнее поля в теле; ни того ни другого — v1.
+func resolveVersion(data []byte, header string) (int, error) {
+	if header = strings.TrimSpace(header); header != "" {
+		return parseVersion(header)
+	}
+
+	var probe struct {
+		Version json.RawMessage `json:"schema_version"`
+	}
+	// ошибки синтаксиса здесь не важны — их вернёт сам декодер версии
+	if err := json.Unmarshal(data, &probe); err != nil || len(probe.Version) == 0 || string(probe.Version) == "null" {
+		return 1, nil
+	}
+	raw := bytes.Trim(probe.Version, `"`)
+	return parseVersion(string(raw))
+}
+
+func parseVersion(s string) (int, error) {
+	v, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(s), "v"))
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownVersion, s)
+	}
+	return v, nil
+}
@@ -0,0 +1,105 @@
+package decode
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"wb-orders/internal/models"
+)
+
+// orderV2 — пример следующей версии: order_uid переименован в id,
+// товары — в lines, дата — в секундах Unix.
+type orderV2 struct {
+	ID          string         `json:"id"`
+	TrackNumber string         `json:"track_number"`
+	Payment     models.Payment `json:"payment"`
+	Lines       []models.Item  `json:"lines"`
+	CreatedUnix int64          `json:"created_unix"`
+}
+
+func init() {
+	RegisterVersion(2, func(d *Decoder, data []byte) (models.Order, error) {
+		var v2 orderV2
+		if err := d.Into(data, &v2); err != nil {
+			return models.Order{}, err
+		}
+		return models.Order{
+			OrderUID:    v2.ID,
+			TrackNumber: v2.TrackNumber,
+			Payment:     v2.Payment,
+			Items:       v2.Lines,
+			DateCreated: time.Unix(v2.CreatedUnix, 0).UTC(),
+		}, nil
+	})
+}
+
+const (
+	v1Body = `{"order_uid": "o1", "track_number": "T1", "items": [{"chrt_id": 7}]}`
+	v2Body = `{"id": "o1", "track_number": "T1", "lines": [{"chrt_id": 7}], "created_unix": 1637907739}`
+)
+
+func TestDecodeDispatchesByVersion(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		body   string
+		header string
+	}{
+		{"default v1", v1Body, ""},
+		{"v1 header", v1Body, "1"},
+		{"v2 header", v2Body, "v2"},
+		{"v2 header with spaces", v2Body, " V2 "},
+		{"v2 field", `{"schema_version": 2, "id": "o1", "track_number": "T1", "lines": [{"chrt_id": 7}]}`, ""},
+		{"v2 field as string", `{"schema_version": "v2", "id": "o1", "track_number": "T1", "lines": [{"chrt_id": 7}]}`, ""},
+		{"v2 field other case", `{"Schema_Version": 2, "id": "o1", "track_number": "T1", "lines": [{"chrt_id": 7}]}`, ""},
+		{"header wins over field", `{"schema_version": 1, "id": "o1", "track_number": "T1", "lines": [{"chrt_id": 7}]}`, "2"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := New(ModeStrict, 0)
+			o, err := d.Decode([]byte(tc.body), tc.header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if o.OrderUID != "o1" || o.TrackNumber != "T1" || len(o.Items) != 1 || o.Items[0].ChrtID != 7 {
+				t.Fatalf("decoded %+v", o)
+			}
+		})
+	}
+}
+
+func TestDecodeRejectsUnknownVersion(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		body   string
+		header string
+	}{
+		{"unregistered header", v1Body, "9"},
+		{"unregistered field", `{"schema_version": 9, "order_uid": "o1"}`, ""},
+		{"garbage header", v1Body, "latest"},
+		{"zero", v1Body, "0"},
+		{"negative field", `{"schema_version": -1, "order_uid": "o1"}`, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := New(ModeLenient, 0)
+			if _, err := d.Decode([]byte(tc.body), tc.header); !errors.Is(err, ErrUnknownVersion) {
+				t.Fatalf("err = %v, want ErrUnknownVersion", err)
+			}
+			if got := d.Stats().Rejected["version"]; got != 1 {
+				t.Errorf("rejected[version] = %d, want 1", got)
+			}
+		})
+	}
+}
+
+func TestVersions(t *testing.T) {
+	got := Versions()
+	if len(got) < 2 || got[0] != 1 || got[1] != 2 {
+		t.Fatalf("Versions() = %v, want [1 2 ...]", got)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("registering version 1 twice did not panic")
+		}
+	}()
+	RegisterVersion(1, nil)
+}
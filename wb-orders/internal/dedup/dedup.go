@@ -0,0 +1,225 @@
+// internal/dedup/dedup.go
+package dedup
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store — долговременное хранилище отметок (storage.Repo, таблица message_dedup).
+type Store interface {
+	DedupSeen(ctx context.Context, id string) (bool, time.Time, error)
+	// DedupMark ставит отметку; order — заказ отпечатка содержимого
+	// ("" для id продюсера).
+	DedupMark(ctx context.Context, id, order string, expires time.Time) error
+	// DedupForget удаляет отпечатки содержимого заказа order, кроме keep.
+	DedupForget(ctx context.Context, order, keep string) error
+	DedupPurge(ctx context.Context) (int64, error)
+}
+
+// contentPrefix — начало ключа-отпечатка содержимого заказа order.
+const contentPrefix = "sha256:"
+
+// DefaultCacheSize — значение по умолчанию для KAFKA_DEDUP_CACHE.
+const DefaultCacheSize = 100_000
+
+// Deduper отвечает на вопрос «это сообщение уже применяли?». Сначала
+// смотрит в память (последние cacheSize id), потом в Postgres.
+// Ошибка БД при проверке — не дубль: повторное применение заказа
+// идемпотентно, а терять сообщение из-за дедупликации нельзя.
+type Deduper struct {
+	store     Store
+	ttl       time.Duration
+	cacheSize int
+
+	mu        sync.Mutex
+	ll        *list.List               // порядок добавления, старые — в конце
+	front     map[string]*list.Element // id → элемент с *frontEntry
+	content   map[string]string        // заказ → его последний отпечаток в памяти
+	lastPurge time.Time
+	stats     Stats
+}
+
+type frontEntry struct {
+	id      string
+	expires time.Time
+}
+
+// Stats — ответ /debug/dedup.
+type Stats struct {
+	TTL        string `json:"ttl"`
+	CacheLen   int    `json:"cache_len"`
+	CacheSize  int    `json:"cache_size"`
+	CacheHits  uint64 `json:"cache_hits"`
+	StoreHits  uint64 `json:"store_hits"`
+	Misses     uint64 `json:"misses"`
+	Marked     uint64 `json:"marked"`
+	StoreError uint64 `json:"store_errors"`
+	Purged     int64  `json:"purged"`
+}
+
+// New возвращает nil, если ttl <= 0: дедупликация выключена
+// (методы nil-Deduper ничего не делают).
+func New(store Store, ttl time.Duration, cacheSize int) *Deduper {
+	if ttl <= 0 {
+		return nil
+	}
+	if cacheSize <= 0 {
+		cacheSize = DefaultCacheSize
+	}
+	return &Deduper{
+		store:     store,
+		ttl:       ttl,
+		cacheSize: cacheSize,
+		ll:        list.New(),
+		front:     make(map[string]*list.Element),
+		content:   make(map[string]string),
+		lastPurge: time.Now(),
+	}
+}
+
+// Key — ключ дедупликации: id сообщения от продюсера, если он есть,
+// иначе SHA-256 содержимого в рамках заказа order (ключ сообщения).
+// Отпечаток у заказа помнится только последний применённый (см. Mark):
+// повтор того же содержимого подряд — дубль, а A→B→A — нет, иначе в БД
+// осталось бы B.
+func Key(messageID, order string, value []byte) string {
+	if messageID != "" {
+		return "id:" + messageID
+	}
+	sum := sha256.Sum256(value)
+	return contentPrefix + order + ":" + hex.EncodeToString(sum[:])
+}
+
+// orderOf — заказ ключа-отпечатка "sha256:<order>:<hash>"; для id
+// продюсера — "".
+func orderOf(key string) string {
+	if !strings.HasPrefix(key, contentPrefix) {
+		return ""
+	}
+	return key[len(contentPrefix):strings.LastIndexByte(key, ':')]
+}
+
+// Seen — сообщение с этим ключом уже применялось в пределах TTL.
+func (d *Deduper) Seen(ctx context.Context, key string) bool {
+	if d == nil {
+		return false
+	}
+	now := time.Now()
+
+	d.mu.Lock()
+	if el, ok := d.front[key]; ok {
+		if el.Value.(*frontEntry).expires.After(now) {
+			d.stats.CacheHits++
+			d.mu.Unlock()
+			return true
+		}
+		d.remove(el)
+	}
+	d.mu.Unlock()
+
+	seen, expires, err := d.store.DedupSeen(ctx, key)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch {
+	case err != nil:
+		d.stats.StoreError++
+		log.Printf("[dedup] check %s: %v", key, err)
+		return false
+	case seen:
+		d.stats.StoreHits++
+		d.remember(key, expires)
+		return true
+	}
+	d.stats.Misses++
+	return false
+}
+
+// Mark отмечает сообщение применённым. Заодно, не чаще чем раз в ttl/10,
+// чистит просроченные отметки в БД.
+func (d *Deduper) Mark(ctx context.Context, key string) {
+	if d == nil {
+		return
+	}
+	now := time.Now()
+	expires := now.Add(d.ttl)
+	order := orderOf(key)
+	if order != "" {
+		// прежнее содержимое заказа больше не дубль: пришло другое
+		if err := d.store.DedupForget(ctx, order, key); err != nil {
+			log.Printf("[dedup] forget order=%s: %v", order, err)
+		}
+	}
+	if err := d.store.DedupMark(ctx, key, order, expires); err != nil {
+		log.Printf("[dedup] mark %s: %v", key, err)
+	}
+
+	d.mu.Lock()
+	d.stats.Marked++
+	d.remember(key, expires)
+	purge := now.Sub(d.lastPurge) >= max(d.ttl/10, time.Minute)
+	if purge {
+		d.lastPurge = now
+	}
+	d.mu.Unlock()
+
+	if purge {
+		n, err := d.store.DedupPurge(ctx)
+		if err != nil {
+			log.Printf("[dedup] purge: %v", err)
+			return
+		}
+		d.mu.Lock()
+		d.stats.Purged += n
+		d.mu.Unlock()
+	}
+}
+
+// remember кладёт ключ в память; при переполнении вытесняет самый старый.
+// У заказа в памяти остаётся один отпечаток — последний.
+func (d *Deduper) remember(key string, expires time.Time) {
+	if el, ok := d.front[key]; ok {
+		el.Value.(*frontEntry).expires = expires
+		d.ll.MoveToFront(el)
+		return
+	}
+	if order := orderOf(key); order != "" {
+		if old, ok := d.front[d.content[order]]; ok {
+			d.remove(old)
+		}
+		d.content[order] = key
+	}
+	d.front[key] = d.ll.PushFront(&frontEntry{id: key, expires: expires})
+	for d.ll.Len() > d.cacheSize {
+		d.remove(d.ll.Back())
+	}
+}
+
+func (d *Deduper) remove(el *list.Element) {
+	d.ll.Remove(el)
+	id := el.Value.(*frontEntry).id
+	delete(d.front, id)
+	if order := orderOf(id); order != "" && d.content[order] == id {
+		delete(d.content, order)
+	}
+}
+
+func (d *Deduper) Stats() Stats {
+	if d == nil {
+		return Stats{TTL: "off"}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := d.stats
+	out.TTL = d.ttl.String()
+	out.CacheLen = d.ll.Len()
+	out.CacheSize = d.cacheSize
+	return out
+}
@@ -0,0 +1,210 @@
+package dedup
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memStore — message_dedup в памяти; err — ответ на любой запрос.
+type memStore struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+	orders  map[string]string // id → order_uid
+	err     error
+	seen    int // вызовов DedupSeen
+}
+
+func newMemStore() *memStore {
+	return &memStore{expires: make(map[string]time.Time), orders: make(map[string]string)}
+}
+
+func (s *memStore) DedupSeen(_ context.Context, id string) (bool, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seen++
+	if s.err != nil {
+		return false, time.Time{}, s.err
+	}
+	exp, ok := s.expires[id]
+	if !ok || !exp.After(time.Now()) {
+		return false, time.Time{}, nil
+	}
+	return true, exp, nil
+}
+
+func (s *memStore) DedupMark(_ context.Context, id, order string, expires time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.expires[id] = expires
+	if order != "" {
+		s.orders[id] = order
+	}
+	return nil
+}
+
+func (s *memStore) DedupForget(_ context.Context, order, keep string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	for id, o := range s.orders {
+		if o == order && id != keep {
+			delete(s.expires, id)
+			delete(s.orders, id)
+		}
+	}
+	return nil
+}
+
+func (s *memStore) DedupPurge(context.Context) (int64, error) { return 0, s.err }
+
+func TestSeenAfterMark(t *testing.T) {
+	ctx := context.Background()
+	d := New(newMemStore(), time.Hour, 10)
+	key := Key("m-1", "o1", nil)
+	if d.Seen(ctx, key) {
+		t.Fatal("unmarked key reported as seen")
+	}
+	d.Mark(ctx, key)
+	if !d.Seen(ctx, key) {
+		t.Fatal("marked key not seen")
+	}
+	if st := d.Stats(); st.CacheHits != 1 || st.Misses != 1 || st.Marked != 1 {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+func TestTTLExpiry(t *testing.T) {
+	ctx := context.Background()
+	s := newMemStore()
+	d := New(s, 20*time.Millisecond, 10)
+	key := Key("m-1", "o1", nil)
+	d.Mark(ctx, key)
+	if !d.Seen(ctx, key) {
+		t.Fatal("fresh mark not seen")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if d.Seen(ctx, key) {
+		t.Fatal("expired mark still seen")
+	}
+	if st := d.Stats(); st.CacheLen != 0 {
+		t.Errorf("expired key left in memory: cache_len=%d", st.CacheLen)
+	}
+}
+
+func TestLRUEviction(t *testing.T) {
+	ctx := context.Background()
+	s := newMemStore()
+	d := New(s, time.Hour, 2)
+	a, b, c := Key("a", "", nil), Key("b", "", nil), Key("c", "", nil)
+	d.Mark(ctx, a)
+	d.Mark(ctx, b)
+	d.Mark(ctx, c) // вытесняет самый старый — a
+
+	if st := d.Stats(); st.CacheLen != 2 {
+		t.Fatalf("cache_len = %d, want 2", st.CacheLen)
+	}
+	before := s.seen
+	if !d.Seen(ctx, b) || !d.Seen(ctx, c) {
+		t.Fatal("recent keys not seen")
+	}
+	if s.seen != before {
+		t.Error("recent keys should be answered from memory")
+	}
+	// вытесненный ключ находится в БД и возвращается в память
+	if !d.Seen(ctx, a) {
+		t.Fatal("evicted key not found in store")
+	}
+	if st := d.Stats(); st.StoreHits != 1 || st.CacheLen != 2 {
+		t.Errorf("stats = %+v, want store_hits=1 cache_len=2", st)
+	}
+}
+
+// Ошибка БД — не дубль: сообщение применится ещё раз, но не потеряется.
+func TestStoreErrorFallsThrough(t *testing.T) {
+	ctx := context.Background()
+	s := newMemStore()
+	d := New(s, time.Hour, 10)
+	s.err = errors.New("connection refused")
+
+	key := Key("m-1", "o1", nil)
+	if d.Seen(ctx, key) {
+		t.Fatal("store error reported as duplicate")
+	}
+	d.Mark(ctx, key) // ошибка записи только логируется
+	if st := d.Stats(); st.StoreError != 1 || st.Marked != 1 {
+		t.Errorf("stats = %+v, want store_errors=1 marked=1", st)
+	}
+	// отмеченное в памяти ловится и без БД
+	if !d.Seen(ctx, key) {
+		t.Error("key marked in memory not seen")
+	}
+}
+
+// A→B→A без message-id: повтор A после B — новое состояние, не дубль.
+func TestContentKeyScopedToLastPayload(t *testing.T) {
+	ctx := context.Background()
+	for _, cache := range []int{10, 1} { // 1 — проверка через БД
+		s := newMemStore()
+		d := New(s, time.Hour, cache)
+		a := Key("", "o1", []byte(`{"v":"A"}`))
+		b := Key("", "o1", []byte(`{"v":"B"}`))
+		other := Key("", "o2", []byte(`{"v":"A"}`))
+
+		d.Mark(ctx, a)
+		d.Mark(ctx, other)
+		if !d.Seen(ctx, a) {
+			t.Fatalf("cache=%d: immediate repeat of A not seen", cache)
+		}
+		if d.Seen(ctx, b) {
+			t.Fatalf("cache=%d: B reported as duplicate", cache)
+		}
+		d.Mark(ctx, b)
+		if d.Seen(ctx, a) {
+			t.Errorf("cache=%d: A after B dropped as duplicate", cache)
+		}
+		if !d.Seen(ctx, other) {
+			t.Errorf("cache=%d: other order's mark forgotten", cache)
+		}
+	}
+}
+
+func TestKey(t *testing.T) {
+	if got := Key("m-1", "o1", []byte("x")); got != "id:m-1" {
+		t.Errorf("Key with message id = %q", got)
+	}
+	k1, k2 := Key("", "o1", []byte("x")), Key("", "o2", []byte("x"))
+	if k1 == k2 {
+		t.Error("same payload of different orders share a key")
+	}
+	if o := orderOf(k1); o != "o1" {
+		t.Errorf("orderOf = %q", o)
+	}
+	if o := orderOf(Key("", "a:b", []byte("x"))); o != "a:b" {
+		t.Errorf("orderOf with colon in order = %q", o)
+	}
+	if o := orderOf("id:m-1"); o != "" {
+		t.Errorf("orderOf id key = %q", o)
+	}
+}
+
+func TestNilDeduper(t *testing.T) {
+	var d *Deduper
+	if New(newMemStore(), 0, 10) != nil {
+		t.Fatal("ttl=0 should disable dedup")
+	}
+	d.Mark(context.Background(), "k")
+	if d.Seen(context.Background(), "k") {
+		t.Error("nil deduper reported duplicate")
+	}
+	if d.Stats().TTL != "off" {
+		t.Error("nil deduper stats")
+	}
+}
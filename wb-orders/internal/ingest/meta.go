@@ -0,0 +1,91 @@
+// internal/ingest/meta.go
+package ingest
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Meta — откуда и как пришёл заказ: заголовки сообщения (трассировка,
+// продюсер, тип содержимого, версия схемы) и его место в Kafka.
+// Едет через context от консьюмера до storage и логов.
+type Meta struct {
+	MessageID     string    `json:"message_id,omitempty"`
+	TraceID       string    `json:"trace_id,omitempty"`
+	SpanID        string    `json:"span_id,omitempty"`
+	Producer      string    `json:"producer,omitempty"`
+	ContentType   string    `json:"content_type,omitempty"`
+	SchemaVersion string    `json:"schema_version,omitempty"`
+	Key           string    `json:"key,omitempty"`
+	Topic         string    `json:"topic,omitempty"`
+	Partition     int       `json:"partition"`
+	Offset        int64     `json:"offset"`
+	Time          time.Time `json:"time"`
+}
+
+type ctxKey struct{}
+
+func WithMeta(ctx context.Context, m Meta) context.Context {
+	return context.WithValue(ctx, ctxKey{}, m)
+}
+
+func FromContext(ctx context.Context) (Meta, bool) {
+	m, ok := ctx.Value(ctxKey{}).(Meta)
+	return m, ok
+}
+
+// String — для логов: "trace=4bf9… producer=checkout"; пусто, если
+// заголовков не было.
+func (m Meta) String() string {
+	var parts []string
+	for _, kv := range [][2]string{
+		{"trace", m.TraceID},
+		{"producer", m.Producer},
+		{"schema", m.SchemaVersion},
+	} {
+		if kv[1] != "" {
+			parts = append(parts, kv[0]+"="+kv[1])
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// ParseTraceParent разбирает W3C traceparent: "00-<trace-id>-<span-id>-<flags>".
+// Невалидный заголовок — пустые строки. Версии новее 00 могут дописывать
+// поля в конец — их пропускаем.
+func ParseTraceParent(s string) (traceID, spanID string) {
+	f := strings.Split(strings.TrimSpace(s), "-")
+	if len(f) < 4 || len(f[0]) != 2 || len(f[1]) != 32 || len(f[2]) != 16 || len(f[3]) != 2 {
+		return "", ""
+	}
+	if !isHex(f[0]) || !isHex(f[1]) || !isHex(f[2]) || !isHex(f[3]) {
+		return "", ""
+	}
+	version := strings.ToLower(f[0])
+	if version == "ff" || (version == "00" && len(f) != 4) {
+		return "", ""
+	}
+	if strings.Trim(f[1], "0") == "" || strings.Trim(f[2], "0") == "" {
+		return "", ""
+	}
+	return strings.ToLower(f[1]), strings.ToLower(f[2])
+}
+
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i] | 0x20
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// IsJSON — тип содержимого, который понимает декодер. Пустой — тоже JSON
+// (старые продюсеры заголовок не ставят).
+func IsJSON(contentType string) bool {
+	mt, _, _ := strings.Cut(contentType, ";")
+	mt = strings.ToLower(strings.TrimSpace(mt))
+	return mt == "" || mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
@@ -0,0 +1,72 @@
+package ingest
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	const (
+		trace = "4bf92f3577b34da6a3ce929d0e0e4736"
+		span  = "00f067aa0ba902b7"
+	)
+	cases := []struct {
+		in          string
+		trace, span string
+	}{
+		{"00-" + trace + "-" + span + "-01", trace, span},
+		{"  00-" + trace + "-" + span + "-00\n", trace, span},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-01", trace, span},
+		{"01-" + trace + "-" + span + "-01-future", trace, span}, // новая версия с доп. полем
+		{"", "", ""},
+		{"garbage", "", ""},
+		{"00-" + trace + "-" + span, "", ""},                            // нет flags
+		{"00-" + trace + "-" + span + "-01-extra", "", ""},              // у 00 ровно 4 поля
+		{"ff-" + trace + "-" + span + "-01", "", ""},                    // запрещённая версия
+		{"0x-" + trace + "-" + span + "-01", "", ""},                    // версия не hex
+		{"00-" + trace[:31] + "-" + span + "-01", "", ""},               // короткий trace-id
+		{"00-" + trace + "-" + span + "-1", "", ""},                     // короткие flags
+		{"00-" + trace[:31] + "g-" + span + "-01", "", ""},              // не hex
+		{"00-" + trace + "-" + span[:15] + "z-01", "", ""},              // не hex
+		{"00-00000000000000000000000000000000-" + span + "-01", "", ""}, // нулевой trace-id
+		{"00-" + trace + "-0000000000000000-01", "", ""},                // нулевой span-id
+	}
+	for _, tc := range cases {
+		tr, sp := ParseTraceParent(tc.in)
+		if tr != tc.trace || sp != tc.span {
+			t.Errorf("ParseTraceParent(%q) = %q, %q; want %q, %q", tc.in, tr, sp, tc.trace, tc.span)
+		}
+	}
+}
+
+func TestIsJSON(t *testing.T) {
+	for ct, want := range map[string]bool{
+		"":                                true,
+		"application/json":                true,
+		"Application/JSON; charset=utf-8": true,
+		"application/vnd.order.v2+json":   true,
+		"text/plain":                      false,
+		"application/x-protobuf":          false,
+	} {
+		if got := IsJSON(ct); got != want {
+			t.Errorf("IsJSON(%q) = %t, want %t", ct, got, want)
+		}
+	}
+}
+
+func TestMetaContext(t *testing.T) {
+	if _, ok := FromContext(context.Background()); ok {
+		t.Error("empty context has meta")
+	}
+	m := Meta{TraceID: "abc", Producer: "checkout", Offset: 5}
+	got, ok := FromContext(WithMeta(context.Background(), m))
+	if !ok || got != m {
+		t.Errorf("FromContext = %+v, %t", got, ok)
+	}
+	if s := m.String(); s != "trace=abc producer=checkout" {
+		t.Errorf("String = %q", s)
+	}
+	if s := (Meta{}).String(); s != "" {
+		t.Errorf("empty String = %q", s)
+	}
+}
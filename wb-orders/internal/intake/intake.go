@@ -0,0 +1,256 @@
+// internal/intake/intake.go
+package intake
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"wb-orders/internal/decode"
+	"wb-orders/internal/ingest"
+	"wb-orders/internal/models"
+	"wb-orders/internal/pipeline"
+	"wb-orders/internal/storage"
+)
+
+// Итог по заказу (Result.Status).
+const (
+	StatusStored   = "stored"   // сохранён
+	StatusRejected = "rejected" // данные не приняты — повтор без правки не поможет
+	StatusSkipped  = "skipped"  // отфильтрован звеном цепочки
+	StatusFailed   = "failed"   // БД недоступна — можно повторить как есть
+)
+
+const (
+	// MaxBulkOrders — сколько заказов можно прислать в одном /orders:bulk.
+	MaxBulkOrders = 10_000
+	// OrderTimeout — предел на один заказ (POST /orders и строку пакета).
+	OrderTimeout = 10 * time.Second
+	// BulkTimeout — предел на пакет целиком: столько держится и запрос,
+	// и его Idempotency-Key. На MaxBulkOrders строк это ~12 мс на строку —
+	// с запасом для живой БД; строки, до которых не дошли, — failed.
+	BulkTimeout = 2 * time.Minute
+	// DefaultIdempotencyTTL — сколько помнить ответ по Idempotency-Key.
+	DefaultIdempotencyTTL = 24 * time.Hour
+)
+
+// ErrTooManyOrders — в пакете больше MaxBulkOrders строк.
+var ErrTooManyOrders = fmt.Errorf("more than %d orders in one request", MaxBulkOrders)
+
+// Result — ответ по одному заказу.
+type Result struct {
+	Line     int      `json:"line,omitempty"` // строка NDJSON, с 1 (только bulk)
+	OrderUID string   `json:"order_uid,omitempty"`
+	Status   string   `json:"status"`
+	Stage    string   `json:"stage,omitempty"` // стадия отказа (pipeline.Stage*)
+	Error    string   `json:"error,omitempty"`
+	Fixes    []string `json:"fixes,omitempty"`
+}
+
+// BulkResult — ответ /orders:bulk: итоги по строкам и счётчики.
+type BulkResult struct {
+	Stored   int      `json:"stored"`
+	Rejected int      `json:"rejected"`
+	Skipped  int      `json:"skipped"`
+	Failed   int      `json:"failed"`
+	Results  []Result `json:"results"`
+}
+
+// Service — приём заказов не из Kafka (HTTP). Цепочка та же, что у
+// Consumer (pipeline.Chain): звенья до записи, UpsertOrder, звенья после.
+type Service struct {
+	repo  *storage.Repo
+	chain *pipeline.Chain
+	ttl   time.Duration
+
+	mu        sync.Mutex
+	lastPurge time.Time
+}
+
+func New(repo *storage.Repo, chain *pipeline.Chain) *Service {
+	return &Service{repo: repo, chain: chain, ttl: DefaultIdempotencyTTL, lastPurge: time.Now()}
+}
+
+// Apply принимает один заказ; meta — откуда он пришёл (для аудита и логов).
+func (s *Service) Apply(ctx context.Context, data []byte, meta ingest.Meta) Result {
+	ctx = ingest.WithMeta(ctx, meta)
+	it := &pipeline.Item{Raw: data, Meta: meta}
+	result := func() Result { return Result{OrderUID: it.Order.OrderUID, Fixes: it.Fixes} }
+
+	if err := s.chain.Prepare(ctx, it); err != nil {
+		if stage, ok := pipeline.IsReject(err); ok {
+			return s.rejected(result(), stage, err, meta)
+		}
+		if reason, ok := pipeline.IsSkip(err); ok {
+			res := result()
+			res.Status, res.Error = StatusSkipped, reason
+			return res
+		}
+		return s.failed(result(), "", err, meta)
+	}
+	if err := s.repo.UpsertOrder(ctx, it.Order, it.Audit()); err != nil {
+		switch {
+		case storage.IsTransient(err) || ctx.Err() != nil:
+			return s.failed(result(), pipeline.StageStore, err, meta)
+		case errors.Is(err, models.ErrIllegalTransition):
+			return s.rejected(result(), pipeline.StageTransition, err, meta)
+		}
+		return s.rejected(result(), pipeline.StageStore, err, meta)
+	}
+	// Заказ записан, но звено после записи (приёмник) не отработало:
+	// повтор перезапишет заказ идемпотентно и прогонит звенья снова
+	if err := s.chain.Stored(ctx, it); err != nil {
+		return s.failed(result(), "", err, meta)
+	}
+
+	res := result()
+	res.Status = StatusStored
+	return res
+}
+
+func (s *Service) rejected(res Result, stage string, err error, meta ingest.Meta) Result {
+	log.Printf("[http] reject: stage=%s id=%s %s: %v", stage, res.OrderUID, meta, err)
+	res.Status, res.Stage, res.Error = StatusRejected, stage, err.Error()
+	return res
+}
+
+func (s *Service) failed(res Result, stage string, err error, meta ingest.Meta) Result {
+	log.Printf("[http] failed: stage=%s id=%s %s: %v", stage, res.OrderUID, meta, err)
+	res.Status, res.Stage, res.Error = StatusFailed, stage, err.Error()
+	return res
+}
+
+// Bulk принимает заказы из NDJSON: по одному на строку, пустые строки
+// пропускаются. Каждая строка — отдельный заказ со своим итогом; ошибка
+// возвращается, только если сам поток не прочитать или он не проходит
+// по пределам (ErrTooManyOrders, decode.ErrTooLarge) — тогда не
+// применяется ни одна строка.
+//
+// На строку — OrderTimeout, на пакет — BulkTimeout: строки, до которых
+// не дошли к сроку (или к отключению клиента), не применяются и
+// возвращаются как failed — их можно прислать повторно.
+func (s *Service) Bulk(ctx context.Context, r io.Reader, meta ingest.Meta) (BulkResult, error) {
+	lines, err := splitBulk(r)
+	if err != nil {
+		return BulkResult{}, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, BulkTimeout)
+	defer cancel()
+
+	out := BulkResult{Results: make([]Result, 0, len(lines))}
+	for _, l := range lines {
+		var res Result
+		if err := ctx.Err(); err != nil {
+			res = Result{Status: StatusFailed, Error: "not processed: " + err.Error()}
+		} else {
+			lm := meta
+			lm.Offset = int64(l.n)
+			lm.ContentType = "application/json" // тип пакета — NDJSON, каждой строки — JSON
+			lctx, cancel := context.WithTimeout(ctx, OrderTimeout)
+			res = s.Apply(lctx, l.data, lm)
+			cancel()
+		}
+		res.Line = l.n
+		switch res.Status {
+		case StatusStored:
+			out.Stored++
+		case StatusRejected:
+			out.Rejected++
+		case StatusSkipped:
+			out.Skipped++
+		case StatusFailed:
+			out.Failed++
+		}
+		out.Results = append(out.Results, res)
+	}
+	return out, nil
+}
+
+// bulkLine — непустая строка пакета и её номер (с 1).
+type bulkLine struct {
+	n    int
+	data []byte
+}
+
+// splitBulk читает пакет целиком и проверяет пределы до того, как
+// применится первый заказ: иначе отказ на 10 001-й строке отменил бы
+// ответ по уже записанным.
+func splitBulk(r io.Reader) ([]bulkLine, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64<<10), decode.DefaultMaxSize+1)
+
+	var lines []bulkLine
+	line := 1
+	for ; sc.Scan(); line++ {
+		data := bytes.TrimSpace(sc.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		if len(lines) == MaxBulkOrders {
+			return nil, ErrTooManyOrders
+		}
+		lines = append(lines, bulkLine{n: line, data: bytes.Clone(data)})
+	}
+	if err := sc.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			err = decode.ErrTooLarge
+		}
+		return nil, fmt.Errorf("line %d: %w", line, err)
+	}
+	return lines, nil
+}
+
+// RequestHash — отпечаток запроса для Idempotency-Key: метод, путь и тело.
+func RequestHash(method, path string, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", method, path)
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Claim занимает Idempotency-Key под запрос. nil, nil — выполнять запрос;
+// ответ — запрос уже выполнялся, отдать сохранённое. Заодно, не чаще раза
+// в час, чистит просроченные ключи.
+func (s *Service) Claim(ctx context.Context, key, requestHash string) (*storage.StoredResponse, error) {
+	s.purge(ctx)
+	return s.repo.ClaimIdempotencyKey(ctx, key, requestHash, time.Now().Add(s.ttl))
+}
+
+// Finish сохраняет ответ по ключу; retryable — ответ сохранять нельзя
+// (временная ошибка), ключ освобождается под повтор.
+func (s *Service) Finish(ctx context.Context, key string, resp storage.StoredResponse, retryable bool) {
+	var err error
+	if retryable {
+		err = s.repo.ReleaseIdempotencyKey(ctx, key)
+	} else {
+		err = s.repo.SaveIdempotentResponse(ctx, key, resp)
+	}
+	if err != nil {
+		log.Printf("[http] idempotency key %q: %v", key, err)
+	}
+}
+
+func (s *Service) purge(ctx context.Context) {
+	s.mu.Lock()
+	due := time.Since(s.lastPurge) >= time.Hour
+	if due {
+		s.lastPurge = time.Now()
+	}
+	s.mu.Unlock()
+	if !due {
+		return
+	}
+	if n, err := s.repo.PurgeIdempotencyKeys(ctx); err != nil {
+		log.Printf("[http] purge idempotency keys: %v", err)
+	} else if n > 0 {
+		log.Printf("[http] purged %d idempotency keys", n)
+	}
+}
@@ -0,0 +1,85 @@
+package intake
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"wb-orders/internal/decode"
+	"wb-orders/internal/ingest"
+)
+
+func TestSplitBulk(t *testing.T) {
+	lines, err := splitBulk(strings.NewReader("{\"a\":1}\n\n  \n{\"b\":2}\r\n{\"c\":3}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []bulkLine{{1, []byte(`{"a":1}`)}, {4, []byte(`{"b":2}`)}, {5, []byte(`{"c":3}`)}}
+	if len(lines) != len(want) {
+		t.Fatalf("lines = %d, want %d", len(lines), len(want))
+	}
+	for i, l := range lines {
+		if l.n != want[i].n || string(l.data) != string(want[i].data) {
+			t.Errorf("line %d = {%d %s}, want {%d %s}", i, l.n, l.data, want[i].n, want[i].data)
+		}
+	}
+}
+
+// Пакет за пределами отклоняется до первой записи: у сервиса нет ни БД,
+// ни цепочки — дойди Bulk до Apply, тест упал бы с паникой.
+func TestBulkChecksLimitsBeforeApplying(t *testing.T) {
+	tooMany := strings.Repeat("{}\n", MaxBulkOrders) + "\n{}\n"
+	tooLong := "{}\n{}\n" + strings.Repeat("x", decode.DefaultMaxSize+1) + "\n"
+
+	for _, tc := range []struct {
+		name string
+		body string
+		want error
+		line string
+	}{
+		{"too many orders", tooMany, ErrTooManyOrders, ""},
+		{"too long line", tooLong, decode.ErrTooLarge, "line 3"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &Service{}
+			_, err := s.Bulk(context.Background(), strings.NewReader(tc.body), ingest.Meta{})
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("err = %v, want %v", err, tc.want)
+			}
+			if !strings.Contains(err.Error(), tc.line) {
+				t.Errorf("err = %v, want it to name %q", err, tc.line)
+			}
+		})
+	}
+}
+
+func TestSplitBulkAtLimit(t *testing.T) {
+	lines, err := splitBulk(strings.NewReader(strings.Repeat("{}\n\n", MaxBulkOrders)))
+	if err != nil {
+		t.Fatalf("exactly %d orders: %v", MaxBulkOrders, err)
+	}
+	if len(lines) != MaxBulkOrders {
+		t.Fatalf("lines = %d", len(lines))
+	}
+}
+
+// После срока пакета строки не применяются (у сервиса нет ни БД, ни
+// цепочки), а возвращаются как failed со своими номерами.
+func TestBulkPastDeadlineFailsRemainingLines(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res, err := (&Service{}).Bulk(ctx, strings.NewReader("{}\n\n{}\n"), ingest.Meta{})
+	if err != nil {
+		t.Fatalf("Bulk: %v", err)
+	}
+	if res.Failed != 2 || res.Stored != 0 || len(res.Results) != 2 {
+		t.Fatalf("result = %+v, want 2 failed", res)
+	}
+	for i, want := range []int{1, 3} {
+		r := res.Results[i]
+		if r.Line != want || r.Status != StatusFailed || !strings.Contains(r.Error, "not processed") {
+			t.Errorf("results[%d] = %+v, want failed line %d", i, r, want)
+		}
+	}
+}
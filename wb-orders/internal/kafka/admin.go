@@ -0,0 +1,196 @@
+// internal/kafka/admin.go
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// ErrGroupActive — в группе есть участники (другие экземпляры сервиса):
+// офсеты без поколения брокер не примет, а примет — участники их перезапишут.
+var ErrGroupActive = errors.New("consumer group has active members")
+
+// Admin — операции с офсетами группы через kafka.Client (без участия ридера).
+type Admin struct {
+	client *kafka.Client
+	group  string
+}
+
+func NewAdmin(cfg Config) (*Admin, error) {
+	tr, err := cfg.Transport()
+	if err != nil {
+		return nil, err
+	}
+	return &Admin{
+		client: &kafka.Client{Addr: kafka.TCP(cfg.Brokers...), Transport: tr, Timeout: 10 * time.Second},
+		group:  cfg.GroupID,
+	}, nil
+}
+
+// Partitions — номера партиций топика.
+func (a *Admin) Partitions(ctx context.Context, topic string) ([]int, error) {
+	md, err := a.client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return nil, fmt.Errorf("metadata %s: %w", topic, err)
+	}
+	for _, t := range md.Topics {
+		if t.Name != topic {
+			continue
+		}
+		if t.Error != nil {
+			return nil, fmt.Errorf("metadata %s: %w", topic, t.Error)
+		}
+		out := make([]int, len(t.Partitions))
+		for i, p := range t.Partitions {
+			out[i] = p.ID
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("topic %s not found", topic)
+}
+
+// CommittedOffsets — офсеты группы по партициям топика; партиций без
+// коммита в карте нет.
+func (a *Admin) CommittedOffsets(ctx context.Context, topic string) (map[int]int64, error) {
+	parts, err := a.Partitions(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := a.client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{
+		GroupID: a.group,
+		Topics:  map[string][]int{topic: parts},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("offset fetch: %w", err)
+	}
+	if resp.Error != nil {
+		return nil, fmt.Errorf("offset fetch: %w", resp.Error)
+	}
+	out := make(map[int]int64)
+	for _, p := range resp.Topics[topic] {
+		if p.Error == nil && p.CommittedOffset >= 0 {
+			out[p.Partition] = p.CommittedOffset
+		}
+	}
+	return out, nil
+}
+
+// PartitionBounds — первый доступный и следующий за последним офсеты партиции,
+// плюс (если at не нулевой) первый офсет с временем >= at.
+type PartitionBounds struct {
+	First, Last int64
+	AtTime      int64
+}
+
+func (a *Admin) Bounds(ctx context.Context, topic string, at time.Time) (map[int]PartitionBounds, error) {
+	parts, err := a.Partitions(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+	reqs := make([]kafka.OffsetRequest, 0, len(parts)*3)
+	for _, p := range parts {
+		reqs = append(reqs, kafka.FirstOffsetOf(p), kafka.LastOffsetOf(p))
+		if !at.IsZero() {
+			reqs = append(reqs, kafka.TimeOffsetOf(p, at))
+		}
+	}
+	resp, err := a.client.ListOffsets(ctx, &kafka.ListOffsetsRequest{
+		Topics: map[string][]kafka.OffsetRequest{topic: reqs},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list offsets: %w", err)
+	}
+
+	out := make(map[int]PartitionBounds, len(parts))
+	for _, po := range resp.Topics[topic] {
+		if po.Error != nil {
+			return nil, fmt.Errorf("list offsets partition=%d: %w", po.Partition, po.Error)
+		}
+		b := PartitionBounds{First: po.FirstOffset, Last: po.LastOffset, AtTime: po.LastOffset}
+		for off := range po.Offsets {
+			if off >= 0 && off < b.AtTime {
+				b.AtTime = off
+			}
+		}
+		out[po.Partition] = b
+	}
+	return out, nil
+}
+
+// ensureEmpty — ErrGroupActive, если в группе кто-то есть.
+func (a *Admin) ensureEmpty(ctx context.Context) error {
+	resp, err := a.client.DescribeGroups(ctx, &kafka.DescribeGroupsRequest{GroupIDs: []string{a.group}})
+	if err != nil {
+		return fmt.Errorf("describe group: %w", err)
+	}
+	for _, g := range resp.Groups {
+		if g.Error != nil {
+			return fmt.Errorf("describe group %s: %w", g.GroupID, g.Error)
+		}
+		if len(g.Members) == 0 {
+			continue
+		}
+		hosts := make([]string, len(g.Members))
+		for i, m := range g.Members {
+			hosts[i] = m.ClientHost
+		}
+		return fmt.Errorf("%w: %s has %d (%s), stop other instances first",
+			ErrGroupActive, g.GroupID, len(g.Members), strings.Join(hosts, ", "))
+	}
+	return nil
+}
+
+// CommitOffsets записывает офсеты группы напрямую (GenerationID -1). Брокер
+// примет такой коммит, только если в группе сейчас нет участников: сначала
+// из группы должен выйти и свой консьюмер (Supervisor.restart), и другие
+// экземпляры сервиса.
+func (a *Admin) CommitOffsets(ctx context.Context, topic string, offsets map[int]int64) error {
+	commits := make([]kafka.OffsetCommit, 0, len(offsets))
+	for p, off := range offsets {
+		commits = append(commits, kafka.OffsetCommit{Partition: p, Offset: off})
+	}
+	resp, err := a.client.OffsetCommit(ctx, &kafka.OffsetCommitRequest{
+		GroupID:      a.group,
+		GenerationID: -1,
+		Topics:       map[string][]kafka.OffsetCommit{topic: commits},
+	})
+	if err != nil {
+		return fmt.Errorf("offset commit: %w", err)
+	}
+	var errs []error
+	for _, p := range resp.Topics[topic] {
+		if p.Error != nil {
+			errs = append(errs, fmt.Errorf("partition=%d: %w", p.Partition, p.Error))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// applyStartTime — KAFKA_START_FROM=<время>: партициям, у которых у группы
+// ещё нет офсета, выставляем первый офсет не раньше этого момента.
+// Уже закоммиченные офсеты не трогаем — так же ведёт себя earliest/latest.
+func (a *Admin) applyStartTime(ctx context.Context, topic string, at time.Time) error {
+	committed, err := a.CommittedOffsets(ctx, topic)
+	if err != nil {
+		return err
+	}
+	bounds, err := a.Bounds(ctx, topic, at)
+	if err != nil {
+		return err
+	}
+	missing := make(map[int]int64)
+	for p, b := range bounds {
+		if _, ok := committed[p]; !ok {
+			missing[p] = b.AtTime
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return a.CommitOffsets(ctx, topic, missing)
+}
@@ -0,0 +1,268 @@
+// internal/kafka/backpressure.go
+package kafka
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"wb-orders/internal/storage"
+)
+
+// Состояние backpressure (BackpressureState.State).
+const (
+	BackpressureOff       = "off"       // выключено (KAFKA_BACKPRESSURE=false)
+	BackpressureRunning   = "running"   // БД здорова, читаем без задержек
+	BackpressureThrottled = "throttled" // перед каждым чтением — задержка
+	BackpressurePaused    = "paused"    // чтение остановлено на KAFKA_BP_PAUSE
+)
+
+const (
+	// bpMinDelay — первая ступень замедления; задержка меньше — снимается.
+	bpMinDelay = 10 * time.Millisecond
+	// bpAdjustEvery — задержка меняется не чаще: окно должно успеть
+	// показать, помогло ли прошлое изменение.
+	bpAdjustEvery = time.Second
+	// bpMinSamples — на меньшем числе замеров решений не принимаем.
+	bpMinSamples = 5
+)
+
+// BackpressureConfig — пороги замедления чтения по здоровью БД. Замеры —
+// время и исход записи заказа (UpsertOrder) за последние Window записей.
+// Порог 0 не проверяется.
+type BackpressureConfig struct {
+	Enabled bool // KAFKA_BACKPRESSURE
+	Window  int  // KAFKA_BP_WINDOW
+
+	// p90 времени записи: выше Slow — замедляемся, выше Pause — пауза
+	SlowLatency  time.Duration // KAFKA_BP_SLOW_LATENCY
+	PauseLatency time.Duration // KAFKA_BP_PAUSE_LATENCY
+	// доля временных ошибок БД: не меньше Slow — замедляемся, Pause — пауза
+	SlowErrors  float64 // KAFKA_BP_SLOW_ERRORS
+	PauseErrors float64 // KAFKA_BP_PAUSE_ERRORS
+
+	MaxDelay time.Duration // KAFKA_BP_MAX_DELAY: предел задержки перед чтением
+	PauseFor time.Duration // KAFKA_BP_PAUSE: сколько стоять на паузе
+}
+
+var DefaultBackpressure = BackpressureConfig{
+	Window:       50,
+	SlowLatency:  250 * time.Millisecond,
+	PauseLatency: 2 * time.Second,
+	SlowErrors:   0.05,
+	PauseErrors:  0.5,
+	MaxDelay:     2 * time.Second,
+	PauseFor:     10 * time.Second,
+}
+
+// BackpressureState — состояние для /debug/consumer.
+type BackpressureState struct {
+	State       string     `json:"state"`
+	Reason      string     `json:"reason,omitempty"` // latency | errors
+	Since       *time.Time `json:"since,omitempty"`
+	DelayMs     int64      `json:"delay_ms"`
+	PausedUntil *time.Time `json:"paused_until,omitempty"`
+	Samples     int        `json:"samples"`
+	LatencyP90  float64    `json:"latency_p90_ms"`
+	ErrorRate   float64    `json:"error_rate"`
+}
+
+type bpSample struct {
+	latency time.Duration
+	failed  bool
+}
+
+// backpressure — адаптивное замедление чтения: медленная или сбоящая БД
+// увеличивает задержку перед FetchMessage (вдвое, до MaxDelay), совсем
+// плохая — ставит чтение на паузу; здоровая — задержку снимает (вдвое).
+// После паузы чтение идёт с MaxDelay и окно копится заново. В отличие от
+// автопаузы (pauseGate), срабатывает до того, как БД откажет совсем.
+// Живёт в Supervisor и переживает перезапуски; nil — выключено.
+type backpressure struct {
+	cfg BackpressureConfig
+
+	mu       sync.Mutex
+	samples  []bpSample // кольцо последних замеров
+	next, n  int
+	state    string
+	reason   string
+	since    time.Time
+	delay    time.Duration
+	until    time.Time // конец паузы
+	adjusted time.Time
+}
+
+func newBackpressure(cfg BackpressureConfig) *backpressure {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &backpressure{
+		cfg:     cfg,
+		samples: make([]bpSample, max(cfg.Window, 1)),
+		state:   BackpressureRunning,
+		since:   time.Now(),
+	}
+}
+
+// timed оборачивает запись orders заказов замером: время на заказ и
+// была ли временная ошибка БД. Отмена контекста не замеряется.
+func (b *backpressure) timed(orders int, write func() error) func() error {
+	if b == nil {
+		return write
+	}
+	return func() error {
+		start := time.Now()
+		err := write()
+		if !errors.Is(err, context.Canceled) {
+			b.record(time.Since(start)/time.Duration(max(orders, 1)), storage.IsTransient(err))
+		}
+		return err
+	}
+}
+
+func (b *backpressure) record(latency time.Duration, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.samples[b.next] = bpSample{latency: latency, failed: failed}
+	b.next = (b.next + 1) % len(b.samples)
+	b.n = min(b.n+1, len(b.samples))
+	b.adjust(time.Now())
+}
+
+// window — p90 времени записи и доля ошибок по окну.
+func (b *backpressure) window() (time.Duration, float64) {
+	if b.n == 0 {
+		return 0, 0
+	}
+	lat := make([]time.Duration, 0, b.n)
+	failed := 0
+	for _, s := range b.samples[:b.n] {
+		lat = append(lat, s.latency)
+		if s.failed {
+			failed++
+		}
+	}
+	slices.Sort(lat)
+	return lat[(len(lat)*9)/10], float64(failed) / float64(b.n)
+}
+
+// adjust пересматривает задержку по окну.
+func (b *backpressure) adjust(now time.Time) {
+	if b.state == BackpressurePaused || b.n < min(bpMinSamples, len(b.samples)) {
+		return
+	}
+	p90, errRate := b.window()
+	over := func(v, limit float64) bool { return limit > 0 && v >= limit }
+	reason := func(latencyLimit time.Duration, errLimit float64) string {
+		if over(errRate, errLimit) {
+			return "errors"
+		}
+		if over(float64(p90), float64(latencyLimit)) {
+			return "latency"
+		}
+		return ""
+	}
+
+	if r := reason(b.cfg.PauseLatency, b.cfg.PauseErrors); r != "" {
+		b.delay, b.until = b.cfg.MaxDelay, now.Add(b.cfg.PauseFor)
+		b.setState(BackpressurePaused, r, now)
+		log.Printf("[kafka] backpressure: paused for %v (%s: p90=%v errors=%.0f%%)",
+			b.cfg.PauseFor, r, p90, errRate*100)
+		return
+	}
+	if now.Sub(b.adjusted) < bpAdjustEvery {
+		return
+	}
+
+	if r := reason(b.cfg.SlowLatency, b.cfg.SlowErrors); r != "" {
+		b.adjusted = now
+		b.delay = min(max(2*b.delay, bpMinDelay), b.cfg.MaxDelay)
+		if b.state != BackpressureThrottled || b.reason != r {
+			log.Printf("[kafka] backpressure: throttling (%s: p90=%v errors=%.0f%%)", r, p90, errRate*100)
+		}
+		b.setState(BackpressureThrottled, r, now)
+		return
+	}
+	if b.delay == 0 {
+		return
+	}
+	b.adjusted = now
+	if b.delay /= 2; b.delay < bpMinDelay {
+		b.delay = 0
+		b.setState(BackpressureRunning, "", now)
+		log.Printf("[kafka] backpressure: db is healthy, throttling off")
+	}
+}
+
+func (b *backpressure) setState(state, reason string, now time.Time) {
+	if b.state != state {
+		b.since = now
+	}
+	b.state, b.reason = state, reason
+}
+
+// expire завершает отстоявшую паузу: дальше — с MaxDelay и пустым окном.
+func (b *backpressure) expire(now time.Time) {
+	if b.state != BackpressurePaused || now.Before(b.until) {
+		return
+	}
+	b.next, b.n, b.adjusted = 0, 0, now
+	b.setState(BackpressureThrottled, b.reason, now)
+	log.Printf("[kafka] backpressure: pause over, reading with delay=%v", b.delay)
+}
+
+// wait — задержка перед чтением: текущая, а на паузе — до её конца.
+// nil не задерживает никогда.
+func (b *backpressure) wait(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	now := time.Now()
+	b.expire(now)
+	d := b.delay
+	if b.state == BackpressurePaused {
+		d = b.until.Sub(now)
+	}
+	b.mu.Unlock()
+	if d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *backpressure) snapshot() BackpressureState {
+	if b == nil {
+		return BackpressureState{State: BackpressureOff}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expire(time.Now())
+	p90, errRate := b.window()
+	since := b.since
+	out := BackpressureState{
+		State:      b.state,
+		Reason:     b.reason,
+		Since:      &since,
+		DelayMs:    b.delay.Milliseconds(),
+		Samples:    b.n,
+		LatencyP90: float64(p90) / float64(time.Millisecond),
+		ErrorRate:  errRate,
+	}
+	if b.state == BackpressurePaused {
+		until := b.until
+		out.PausedUntil = &until
+	}
+	return out
+}
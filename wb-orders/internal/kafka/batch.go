@@ -0,0 +1,250 @@
+// internal/kafka/batch.go
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"wb-orders/internal/ingest"
+	"wb-orders/internal/models"
+	"wb-orders/internal/pipeline"
+	"wb-orders/internal/storage"
+)
+
+// DefaultBatchWait — сколько ждать добора пакета после первого сообщения.
+const DefaultBatchWait = 200 * time.Millisecond
+
+// prepared — сообщение, прошедшее звенья цепочки до записи в БД.
+type prepared struct {
+	m       kafka.Message
+	it      *pipeline.Item
+	started time.Time
+}
+
+// runBatch — режим для бэкфиллов: копим до batchSize сообщений или
+// batchWait с первого, пишем пакет одной транзакцией, коммитим офсеты
+// только после успешной записи. ctx останавливает чтение, work — запись
+// и коммит уже набранного пакета (см. drainContext).
+func (c *Consumer) runBatch(ctx, work context.Context) error {
+	for {
+		if err := c.gate.wait(ctx); err != nil {
+			return nil
+		}
+		if err := c.bp.wait(ctx); err != nil {
+			return nil
+		}
+		batch, err := c.fetchBatch(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				// нормальное завершение по отмене контекста
+				return nil
+			}
+			return err
+		}
+
+		if err := c.handleBatch(work, batch); err != nil {
+			if work.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		// kafka-go коммитит по каждой партиции наибольший офсет из переданных
+		if err := c.source.CommitMessages(work, batch...); err != nil {
+			if work.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("commit batch of %d: %w", len(batch), err)
+		}
+	}
+}
+
+// fetchBatch ждёт первое сообщение без ограничения, остальные — до
+// заполнения пакета или истечения batchWait.
+func (c *Consumer) fetchBatch(ctx context.Context) ([]kafka.Message, error) {
+	m, err := c.source.FetchMessage(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("fetch message: %w", err)
+	}
+	c.metrics.fetched(m)
+	batch := append(make([]kafka.Message, 0, c.batchSize), m)
+
+	wctx, cancel := context.WithTimeout(ctx, c.batchWait)
+	defer cancel()
+	for len(batch) < c.batchSize {
+		m, err := c.source.FetchMessage(wctx)
+		if err != nil {
+			if wctx.Err() != nil && ctx.Err() == nil {
+				break // время вышло — пишем что набрали
+			}
+			return nil, fmt.Errorf("fetch message: %w", err)
+		}
+		c.metrics.fetched(m)
+		batch = append(batch, m)
+	}
+	return batch, nil
+}
+
+// handleBatch: разбор и валидация по одному (плохие — сразу в DLQ), запись
+// валидных одной транзакцией. Если транзакция упала не из-за БД, а из-за
+// данных, пакет переписывается по одному заказу — так в DLQ уходят только
+// виноватые строки.
+func (c *Consumer) handleBatch(ctx context.Context, batch []kafka.Message) error {
+	good := make([]prepared, 0, len(batch))
+	for _, m := range batch {
+		if c.duplicate(ctx, m) {
+			continue // офсет сдвинется вместе с пакетом (batchPositions)
+		}
+		p, err := c.prepare(ctx, m)
+		if err != nil {
+			stage, ok := pipeline.IsReject(err)
+			switch {
+			case ok:
+				if err := c.deadLetter(ctx, m, stage, err); err != nil {
+					return err
+				}
+			case !c.filtered(m, err):
+				return err
+			}
+			continue // офсет сдвинется вместе с пакетом
+		}
+		good = append(good, p)
+	}
+
+	positions := c.batchPositions(batch)
+	if c.group != "" {
+		var (
+			applied []prepared
+			err     error
+		)
+		if good, applied, positions, err = c.dropApplied(ctx, good, positions); err != nil {
+			return err
+		}
+		for _, p := range applied {
+			if err := c.afterStore(ctx, p); err != nil {
+				return err
+			}
+		}
+	}
+
+	orders, audits := make([]models.Order, len(good)), make([]storage.Audit, len(good))
+	for i, p := range good {
+		orders[i], audits[i] = p.it.Order, p.it.Audit()
+	}
+
+	// замер — на заказ: порог один для пакетов и одиночной записи
+	err := c.withRetry(ctx, fmt.Sprintf("batch of %d", len(orders)), c.bp.timed(len(orders), func() error {
+		return c.repo.UpsertOrders(ctx, orders, audits, positions)
+	}))
+	switch {
+	case err == nil:
+		for _, p := range good {
+			if err := c.stored(ctx, p); err != nil {
+				return err
+			}
+		}
+		log.Printf("[kafka] stored batch: orders=%d messages=%d", len(good), len(batch))
+		return nil
+	case errors.Is(err, ErrStoreUnavailable) || ctx.Err() != nil:
+		return err
+	}
+
+	// Ошибка данных или офсеты сдвинулись после dropApplied (ErrAlreadyApplied
+	// откатил весь пакет, вместе с чужими партициями): по одному заказу —
+	// UpsertOrderAt сам пропустит применённые и запишет остальные.
+	log.Printf("[kafka] batch of %d failed, retrying one by one: %v", len(orders), err)
+	for _, p := range good {
+		if err := c.storeOne(ctx, p); err != nil {
+			return err
+		}
+	}
+	if c.group != "" && len(positions) > 0 {
+		// хвост пакета мог состоять из отклонённых сообщений
+		for _, pos := range positions {
+			if err := c.repo.SaveOffset(ctx, pos); err != nil {
+				return fmt.Errorf("save offset: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// dropApplied отделяет сообщения, офсеты которых уже записаны в БД
+// (пакет после рестарта мог нарезаться иначе, чем до падения), и убирает
+// позиции партиций, применённых целиком: иначе claimOffset вернёт
+// ErrAlreadyApplied и откатит запись остальных партиций пакета.
+// Применённые записывать не нужно, но звенья после записи для них
+// прогоняются (Consumer.afterStore).
+func (c *Consumer) dropApplied(ctx context.Context, good []prepared, positions []storage.Position) (
+	pending, applied []prepared, _ []storage.Position, _ error) {
+	stored := make(map[string]map[int]int64)
+	for _, pos := range positions {
+		if _, ok := stored[pos.Topic]; ok {
+			continue
+		}
+		next, err := c.repo.StoredOffsets(ctx, c.group, pos.Topic)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("load offsets: %w", err)
+		}
+		stored[pos.Topic] = next
+	}
+	isApplied := func(topic string, partition int, offset int64) bool {
+		n, ok := stored[topic][partition]
+		return ok && offset < n
+	}
+
+	for _, p := range good {
+		if isApplied(p.m.Topic, p.m.Partition, p.m.Offset) {
+			c.metrics.skippedMsg(p.m, SkipAlreadyApplied)
+			applied = append(applied, p)
+			continue
+		}
+		pending = append(pending, p)
+	}
+	open := positions[:0]
+	for _, pos := range positions {
+		if !isApplied(pos.Topic, pos.Partition, pos.Offset) {
+			open = append(open, pos)
+		}
+	}
+	return pending, applied, open, nil
+}
+
+// batchPositions — наибольший офсет пакета по каждой партиции
+// (только при офсетах в Postgres).
+func (c *Consumer) batchPositions(batch []kafka.Message) []storage.Position {
+	if c.group == "" {
+		return nil
+	}
+	idx := make(map[string]int)
+	var out []storage.Position
+	for _, m := range batch {
+		k := trackKey(m)
+		if i, ok := idx[k]; ok {
+			if m.Offset > out[i].Offset {
+				out[i].Offset = m.Offset
+			}
+			continue
+		}
+		idx[k] = len(out)
+		out = append(out, c.position(m))
+	}
+	return out
+}
+
+// prepare прогоняет сообщение через звенья до записи (разбор, нормализация,
+// проверка ключа, валидация и зарегистрированные свои). Ошибка — отказ
+// (pipeline.IsReject), фильтр (pipeline.IsSkip) или временная.
+func (c *Consumer) prepare(ctx context.Context, m kafka.Message) (prepared, error) {
+	started := time.Now()
+	it := &pipeline.Item{Raw: m.Value, Meta: messageMeta(m)}
+	if err := c.chain.Prepare(ingest.WithMeta(ctx, it.Meta), it); err != nil {
+		return prepared{}, err
+	}
+	return prepared{m: m, it: it, started: started}, nil
+}
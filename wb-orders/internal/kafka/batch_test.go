@@ -0,0 +1,255 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"wb-orders/internal/models"
+	"wb-orders/internal/pipeline"
+	"wb-orders/internal/storage"
+)
+
+// offsetStore — flakyStore с офсетами группы, как в consumer_offsets:
+// claimOffset по каждой позиции, пакет — всё или ничего.
+type offsetStore struct {
+	flakyStore
+	omu  sync.Mutex
+	next map[tp]int64 // партиция → следующий офсет
+}
+
+type tp struct {
+	topic     string
+	partition int
+}
+
+func (s *offsetStore) claim(positions ...storage.Position) error {
+	for _, pos := range positions {
+		if n, ok := s.next[tp{pos.Topic, pos.Partition}]; ok && pos.Offset < n {
+			return fmt.Errorf("%w: %s/%d offset=%d next=%d",
+				storage.ErrAlreadyApplied, pos.Topic, pos.Partition, pos.Offset, n)
+		}
+	}
+	for _, pos := range positions {
+		s.next[tp{pos.Topic, pos.Partition}] = pos.Offset + 1
+	}
+	return nil
+}
+
+func (s *offsetStore) UpsertOrderAt(ctx context.Context, o models.Order, a storage.Audit, pos storage.Position) error {
+	s.omu.Lock()
+	defer s.omu.Unlock()
+	if err := s.claim(pos); err != nil {
+		return err
+	}
+	return s.flakyStore.UpsertOrder(ctx, o, a)
+}
+
+func (s *offsetStore) UpsertOrders(ctx context.Context, orders []models.Order, audits []storage.Audit, positions []storage.Position) error {
+	s.omu.Lock()
+	defer s.omu.Unlock()
+	saved := make(map[tp]int64, len(s.next))
+	for k, v := range s.next {
+		saved[k] = v
+	}
+	if err := s.claim(positions...); err != nil {
+		return err
+	}
+	if err := s.flakyStore.UpsertOrders(ctx, orders, audits, positions); err != nil {
+		s.next = saved // откат транзакции
+		return err
+	}
+	return nil
+}
+
+func (s *offsetStore) SaveOffset(_ context.Context, pos storage.Position) error {
+	s.omu.Lock()
+	defer s.omu.Unlock()
+	_ = s.claim(pos)
+	return nil
+}
+
+func (s *offsetStore) StoredOffsets(_ context.Context, _, topic string) (map[int]int64, error) {
+	s.omu.Lock()
+	defer s.omu.Unlock()
+	out := make(map[int]int64)
+	for k, v := range s.next {
+		if k.topic == topic {
+			out[k.partition] = v
+		}
+	}
+	return out, nil
+}
+
+// orderWithUID — testOrder с другим order_uid.
+func orderWithUID(uid string) []byte {
+	return []byte(strings.ReplaceAll(testOrder, "b563feb7b2b84b6test", uid))
+}
+
+// Партиция 0 уже применена целиком (рестарт между транзакцией и коммитом),
+// партиция 1 — нет: её заказы должны записаться, а не потеряться вместе
+// с откатом пакета.
+func TestBatchWithFullyAppliedPartition(t *testing.T) {
+	r := &fakeReader{msgs: []kafka.Message{
+		{Topic: "orders", Partition: 0, Offset: 5, Value: orderWithUID("p0o5")},
+		{Topic: "orders", Partition: 1, Offset: 3, Value: orderWithUID("p1o3")},
+		{Topic: "orders", Partition: 0, Offset: 6, Value: orderWithUID("p0o6")},
+		{Topic: "orders", Partition: 1, Offset: 4, Value: orderWithUID("p1o4")},
+	}}
+	s := &offsetStore{next: map[tp]int64{{"orders", 0}: 7}}
+	c := newTestConsumer(r, s)
+	c.repo = s
+	c.group = "g"
+	c.batchSize, c.batchWait = 4, 20*time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := c.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, uid := range []string{"p1o3", "p1o4"} {
+		if _, ok := s.orders[uid]; !ok {
+			t.Errorf("order %s from partition 1 is lost", uid)
+		}
+	}
+	for _, uid := range []string{"p0o5", "p0o6"} {
+		if _, ok := s.orders[uid]; ok {
+			t.Errorf("order %s from applied partition 0 written again", uid)
+		}
+	}
+	if n := s.next[tp{"orders", 1}]; n != 5 {
+		t.Errorf("partition 1 next offset = %d, want 5", n)
+	}
+	if n := s.next[tp{"orders", 0}]; n != 7 {
+		t.Errorf("partition 0 next offset = %d, want 7", n)
+	}
+}
+
+// Транзакция с офсетом прошла, а публикация — нет (остановка): при
+// повторной доставке запись пропускается, но заказ всё равно публикуется.
+func TestAlreadyAppliedOrderIsPublished(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		batch int
+	}{
+		{"single", 0},
+		{"batch", 4},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &fakeReader{msgs: []kafka.Message{
+				{Topic: "orders", Partition: 0, Offset: 5, Value: orderWithUID("applied")},
+				{Topic: "orders", Partition: 0, Offset: 6, Value: orderWithUID("fresh")},
+			}}
+			s := &offsetStore{next: map[tp]int64{{"orders", 0}: 6}}
+			c := newTestConsumer(r, s)
+			c.repo = s
+			c.group = "g"
+			if tc.batch > 0 {
+				c.batchSize, c.batchWait = tc.batch, 20*time.Millisecond
+			}
+			pub := &fakePublisher{}
+			if err := c.chain.InsertAfter(pipeline.StageCache, pipeline.Publish(pub)); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			if err := c.Run(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, ok := s.orders["applied"]; ok {
+				t.Error("applied order written again")
+			}
+			for _, uid := range []string{"applied", "fresh"} {
+				if _, ok := pub.sent[uid]; !ok {
+					t.Errorf("order %s not published", uid)
+				}
+			}
+		})
+	}
+}
+
+// stateStore — flakyStore, который, как storage, проверяет переходы
+// состояния заказа: пакет — по каждому сообщению по порядку, всё или ничего.
+type stateStore struct {
+	flakyStore
+	states      map[string]models.OrderState
+	quarantined []storage.QuarantineEntry
+}
+
+func (s *stateStore) UpsertOrder(ctx context.Context, o models.Order, a storage.Audit) error {
+	if err := models.CheckTransition(s.states[o.OrderUID], o.State()); err != nil {
+		return err
+	}
+	s.states[o.OrderUID] = o.State()
+	return s.flakyStore.UpsertOrder(ctx, o, a)
+}
+
+func (s *stateStore) UpsertOrders(ctx context.Context, orders []models.Order, audits []storage.Audit, _ []storage.Position) error {
+	next := make(map[string]models.OrderState)
+	for _, o := range orders {
+		from, ok := next[o.OrderUID]
+		if !ok {
+			from = s.states[o.OrderUID]
+		}
+		if err := models.CheckTransition(from, o.State()); err != nil {
+			return err // откат всего пакета
+		}
+		next[o.OrderUID] = o.State()
+	}
+	for i, o := range orders {
+		if err := s.flakyStore.UpsertOrder(ctx, o, audits[i]); err != nil {
+			return err
+		}
+	}
+	for uid, st := range next {
+		s.states[uid] = st
+	}
+	return nil
+}
+
+func (s *stateStore) Quarantine(_ context.Context, e storage.QuarantineEntry) error {
+	s.quarantined = append(s.quarantined, e)
+	return nil
+}
+
+// orderWithStatus — testOrder с другим статусом товара.
+func orderWithStatus(status int) []byte {
+	return []byte(strings.Replace(testOrder, `"status": 202`, fmt.Sprintf(`"status": %d`, status), 1))
+}
+
+// Два сообщения одного заказа в пакете, второй переход недопустим
+// (cancelled → paid): первое записывается, второе уходит в карантин —
+// как при записи по одному.
+func TestBatchChecksEachTransition(t *testing.T) {
+	r := &fakeReader{msgs: []kafka.Message{
+		{Offset: 1, Value: orderWithStatus(500)}, // cancelled
+		{Offset: 2, Value: orderWithStatus(200)}, // paid
+	}}
+	s := &stateStore{states: map[string]models.OrderState{}}
+	c := newTestConsumer(r, s)
+	c.batchSize, c.batchWait = 2, 20*time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := c.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if st := s.states["b563feb7b2b84b6test"]; st != models.StateCancelled {
+		t.Errorf("state = %q, want cancelled", st)
+	}
+	if len(s.quarantined) != 1 || s.quarantined[0].Stage != StageTransition || s.quarantined[0].Meta.Offset != 2 {
+		t.Errorf("quarantined = %+v, want offset 2 at %s", s.quarantined, StageTransition)
+	}
+	if got := r.commits(); len(got) == 0 || got[len(got)-1] != 2 {
+		t.Errorf("commits = %v, want up to offset 2", got)
+	}
+}
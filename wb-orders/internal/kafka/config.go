@@ -0,0 +1,475 @@
+// internal/kafka/config.go
+package kafka
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+
+	"wb-orders/internal/dedup"
+)
+
+// С какого места читать, если у группы ещё нет офсетов (KAFKA_START_FROM).
+const (
+	StartEarliest = "earliest"
+	StartLatest   = "latest"
+)
+
+// Config — всё подключение к Kafka. Заполняется из env в LoadConfig.
+type Config struct {
+	// Source — откуда читать заказы: kafka или dir (каталог SourceDir,
+	// опрашивается раз в SourcePoll).
+	Source     string        // KAFKA_SOURCE
+	SourceDir  string        // KAFKA_SOURCE_DIR
+	SourcePoll time.Duration // KAFKA_SOURCE_POLL
+
+	Brokers  []string // KAFKA_BROKERS, через запятую
+	Topics   []string // KAFKA_TOPIC_ORDERS, через запятую
+	GroupID  string   // KAFKA_GROUP_ORDERS
+	ClientID string   // KAFKA_CLIENT_ID
+	DLQTopic string   // KAFKA_TOPIC_DLQ
+
+	// OutputTopic — куда публиковать обогащённые заказы после записи в БД
+	// (пусто — не публикуем).
+	OutputTopic string // KAFKA_TOPIC_OUTPUT
+
+	// StatusTopic — топик событий смены статуса товаров (пусто — не читаем),
+	// StatusGroupID — его группа, по умолчанию <GroupID>-status.
+	StatusTopic   string // KAFKA_TOPIC_STATUS
+	StatusGroupID string // KAFKA_GROUP_STATUS
+
+	// StartFrom — earliest, latest или момент времени RFC3339
+	// (тогда StartTime не нулевой). Действует, только пока у группы
+	// нет закоммиченных офсетов.
+	StartFrom string
+	StartTime time.Time
+
+	SessionTimeout    time.Duration // KAFKA_SESSION_TIMEOUT
+	HeartbeatInterval time.Duration // KAFKA_HEARTBEAT_INTERVAL
+	RebalanceTimeout  time.Duration // KAFKA_REBALANCE_TIMEOUT
+
+	MinBytes int           // KAFKA_FETCH_MIN_BYTES
+	MaxBytes int           // KAFKA_FETCH_MAX_BYTES
+	MaxWait  time.Duration // KAFKA_FETCH_MAX_WAIT
+
+	TLS  TLSConfig
+	SASL SASLConfig
+
+	OffsetStore string        // KAFKA_OFFSET_STORE: kafka | postgres
+	Workers     int           // KAFKA_WORKERS
+	BatchSize   int           // KAFKA_BATCH_SIZE
+	BatchWait   time.Duration // KAFKA_BATCH_WAIT_MS
+	AutoPause   bool          // KAFKA_AUTO_PAUSE
+
+	// DrainTimeout — сколько при остановке дообрабатывать и коммитить
+	// сообщения, уже взятые в работу.
+	DrainTimeout time.Duration // KAFKA_DRAIN_TIMEOUT
+
+	// Дедупликация сообщений: TTL отметок (0 — выключена) и сколько
+	// последних id держать в памяти перед походом в Postgres.
+	DedupTTL       time.Duration // KAFKA_DEDUP_TTL
+	DedupCacheSize int           // KAFKA_DEDUP_CACHE
+
+	// Backpressure — замедление чтения по времени и ошибкам записи в БД.
+	Backpressure BackpressureConfig
+}
+
+type TLSConfig struct {
+	Enabled            bool   // KAFKA_TLS_ENABLED
+	CAFile             string // KAFKA_TLS_CA_FILE
+	CertFile           string // KAFKA_TLS_CERT_FILE
+	KeyFile            string // KAFKA_TLS_KEY_FILE
+	InsecureSkipVerify bool   // KAFKA_TLS_INSECURE
+}
+
+type SASLConfig struct {
+	Mechanism string // KAFKA_SASL_MECHANISM: plain | scram-sha-256 | scram-sha-512
+	Username  string // KAFKA_SASL_USERNAME
+	Password  string // KAFKA_SASL_PASSWORD
+}
+
+// LoadConfig читает конфигурацию из переменных окружения.
+func LoadConfig() (Config, error) {
+	cfg := Config{
+		Source:        envOr("KAFKA_SOURCE", SourceKafka),
+		SourceDir:     os.Getenv("KAFKA_SOURCE_DIR"),
+		Brokers:       splitList(os.Getenv("KAFKA_BROKERS")),
+		Topics:        splitList(os.Getenv("KAFKA_TOPIC_ORDERS")),
+		GroupID:       os.Getenv("KAFKA_GROUP_ORDERS"),
+		ClientID:      envOr("KAFKA_CLIENT_ID", "wb-orders"),
+		DLQTopic:      os.Getenv("KAFKA_TOPIC_DLQ"),
+		OutputTopic:   os.Getenv("KAFKA_TOPIC_OUTPUT"),
+		StatusTopic:   os.Getenv("KAFKA_TOPIC_STATUS"),
+		StatusGroupID: os.Getenv("KAFKA_GROUP_STATUS"),
+		StartFrom:     envOr("KAFKA_START_FROM", StartEarliest),
+		OffsetStore:   envOr("KAFKA_OFFSET_STORE", OffsetStoreKafka),
+		TLS: TLSConfig{
+			CAFile:   os.Getenv("KAFKA_TLS_CA_FILE"),
+			CertFile: os.Getenv("KAFKA_TLS_CERT_FILE"),
+			KeyFile:  os.Getenv("KAFKA_TLS_KEY_FILE"),
+		},
+		SASL: SASLConfig{
+			Mechanism: strings.ToLower(os.Getenv("KAFKA_SASL_MECHANISM")),
+			Username:  os.Getenv("KAFKA_SASL_USERNAME"),
+			Password:  os.Getenv("KAFKA_SASL_PASSWORD"),
+		},
+	}
+
+	var errs []error
+	ints := []struct {
+		env string
+		dst *int
+		def int
+	}{
+		{"KAFKA_FETCH_MIN_BYTES", &cfg.MinBytes, 1},
+		{"KAFKA_FETCH_MAX_BYTES", &cfg.MaxBytes, 10e6},
+		{"KAFKA_WORKERS", &cfg.Workers, 1},
+		{"KAFKA_BATCH_SIZE", &cfg.BatchSize, 1},
+		{"KAFKA_DEDUP_CACHE", &cfg.DedupCacheSize, dedup.DefaultCacheSize},
+		{"KAFKA_BP_WINDOW", &cfg.Backpressure.Window, DefaultBackpressure.Window},
+	}
+	for _, v := range ints {
+		n, err := envInt(v.env, v.def)
+		errs = append(errs, err)
+		*v.dst = n
+	}
+	durations := []struct {
+		env string
+		dst *time.Duration
+		def time.Duration
+	}{
+		{"KAFKA_SESSION_TIMEOUT", &cfg.SessionTimeout, 30 * time.Second},
+		{"KAFKA_HEARTBEAT_INTERVAL", &cfg.HeartbeatInterval, 3 * time.Second},
+		{"KAFKA_REBALANCE_TIMEOUT", &cfg.RebalanceTimeout, 30 * time.Second},
+		{"KAFKA_FETCH_MAX_WAIT", &cfg.MaxWait, 10 * time.Second},
+		{"KAFKA_DEDUP_TTL", &cfg.DedupTTL, 0},
+		{"KAFKA_SOURCE_POLL", &cfg.SourcePoll, DefaultSourcePoll},
+		{"KAFKA_DRAIN_TIMEOUT", &cfg.DrainTimeout, DefaultDrainTimeout},
+		{"KAFKA_BP_SLOW_LATENCY", &cfg.Backpressure.SlowLatency, DefaultBackpressure.SlowLatency},
+		{"KAFKA_BP_PAUSE_LATENCY", &cfg.Backpressure.PauseLatency, DefaultBackpressure.PauseLatency},
+		{"KAFKA_BP_MAX_DELAY", &cfg.Backpressure.MaxDelay, DefaultBackpressure.MaxDelay},
+		{"KAFKA_BP_PAUSE", &cfg.Backpressure.PauseFor, DefaultBackpressure.PauseFor},
+	}
+	for _, v := range durations {
+		d, err := envDuration(v.env, v.def)
+		errs = append(errs, err)
+		*v.dst = d
+	}
+	floats := []struct {
+		env string
+		dst *float64
+		def float64
+	}{
+		{"KAFKA_BP_SLOW_ERRORS", &cfg.Backpressure.SlowErrors, DefaultBackpressure.SlowErrors},
+		{"KAFKA_BP_PAUSE_ERRORS", &cfg.Backpressure.PauseErrors, DefaultBackpressure.PauseErrors},
+	}
+	for _, v := range floats {
+		f, err := envFloat(v.env, v.def)
+		errs = append(errs, err)
+		*v.dst = f
+	}
+	waitMs, err := envInt("KAFKA_BATCH_WAIT_MS", int(DefaultBatchWait/time.Millisecond))
+	errs = append(errs, err)
+	cfg.BatchWait = time.Duration(waitMs) * time.Millisecond
+
+	cfg.TLS.Enabled, err = envBool("KAFKA_TLS_ENABLED")
+	errs = append(errs, err)
+	cfg.TLS.InsecureSkipVerify, err = envBool("KAFKA_TLS_INSECURE")
+	errs = append(errs, err)
+	cfg.AutoPause, err = envBool("KAFKA_AUTO_PAUSE")
+	errs = append(errs, err)
+	cfg.Backpressure.Enabled, err = envBool("KAFKA_BACKPRESSURE")
+	errs = append(errs, err)
+	if cfg.TLS.CAFile != "" || cfg.TLS.CertFile != "" {
+		cfg.TLS.Enabled = true
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return Config{}, err
+	}
+	return cfg, cfg.validate()
+}
+
+func (c *Config) validate() error {
+	switch c.Source {
+	case SourceKafka:
+		if err := c.validateKafka(); err != nil {
+			return err
+		}
+	case SourceDir:
+		if c.SourceDir == "" {
+			return errors.New("KAFKA_SOURCE_DIR is empty")
+		}
+		if c.OffsetStore == OffsetStorePostgres {
+			return errors.New("KAFKA_OFFSET_STORE=postgres needs KAFKA_SOURCE=kafka")
+		}
+		if c.SourcePoll <= 0 {
+			return errors.New("KAFKA_SOURCE_POLL must be positive")
+		}
+		if len(c.Brokers) == 0 {
+			// без брокеров Kafka не нужна вовсе: DLQ и статусы выключены
+			if c.OutputTopic != "" {
+				return errors.New("KAFKA_TOPIC_OUTPUT needs KAFKA_BROKERS")
+			}
+			c.DLQTopic, c.StatusTopic = "", ""
+		}
+	default:
+		return fmt.Errorf("unknown KAFKA_SOURCE %q (want kafka|dir)", c.Source)
+	}
+	if c.StatusGroupID == "" && c.GroupID != "" {
+		c.StatusGroupID = c.GroupID + "-status"
+	}
+	if c.StatusTopic != "" && c.StatusGroupID == "" {
+		return errors.New("KAFKA_TOPIC_STATUS needs KAFKA_GROUP_STATUS or KAFKA_GROUP_ORDERS")
+	}
+
+	switch c.StartFrom {
+	case StartEarliest, StartLatest:
+	default:
+		t, err := time.Parse(time.RFC3339, c.StartFrom)
+		if err != nil {
+			return fmt.Errorf("KAFKA_START_FROM: want earliest|latest|RFC3339, got %q", c.StartFrom)
+		}
+		c.StartTime = t
+	}
+
+	switch c.OffsetStore {
+	case OffsetStoreKafka, OffsetStorePostgres:
+	default:
+		return fmt.Errorf("unknown KAFKA_OFFSET_STORE %q (want kafka|postgres)", c.OffsetStore)
+	}
+
+	switch c.SASL.Mechanism {
+	case "", "plain", "scram-sha-256", "scram-sha-512":
+	default:
+		return fmt.Errorf("unknown KAFKA_SASL_MECHANISM %q", c.SASL.Mechanism)
+	}
+
+	if c.Workers < 1 || c.BatchSize < 1 || c.BatchWait <= 0 {
+		return errors.New("KAFKA_WORKERS, KAFKA_BATCH_SIZE and KAFKA_BATCH_WAIT_MS must be positive")
+	}
+	if c.DrainTimeout < 0 {
+		return errors.New("KAFKA_DRAIN_TIMEOUT must not be negative")
+	}
+	if c.BatchSize > 1 && c.Workers > 1 {
+		return errors.New("KAFKA_BATCH_SIZE and KAFKA_WORKERS are mutually exclusive")
+	}
+	return c.Backpressure.validate()
+}
+
+func (b BackpressureConfig) validate() error {
+	if !b.Enabled {
+		return nil
+	}
+	if b.Window < 1 || b.MaxDelay <= 0 || b.PauseFor <= 0 {
+		return errors.New("KAFKA_BP_WINDOW, KAFKA_BP_MAX_DELAY and KAFKA_BP_PAUSE must be positive")
+	}
+	if b.SlowLatency < 0 || b.PauseLatency < 0 {
+		return errors.New("KAFKA_BP_SLOW_LATENCY and KAFKA_BP_PAUSE_LATENCY must not be negative")
+	}
+	for _, r := range []float64{b.SlowErrors, b.PauseErrors} {
+		if r < 0 || r > 1 {
+			return errors.New("KAFKA_BP_SLOW_ERRORS and KAFKA_BP_PAUSE_ERRORS must be within [0, 1]")
+		}
+	}
+	return nil
+}
+
+// validateKafka — то, без чего нельзя читать из Kafka.
+func (c *Config) validateKafka() error {
+	if len(c.Brokers) == 0 {
+		return errors.New("KAFKA_BROKERS is empty")
+	}
+	if len(c.Topics) == 0 {
+		return errors.New("KAFKA_TOPIC_ORDERS is empty")
+	}
+	if c.GroupID == "" {
+		return errors.New("KAFKA_GROUP_ORDERS is empty")
+	}
+	return nil
+}
+
+// startOffset — StartOffset для ридера. Для момента времени — FirstOffset:
+// сами офсеты по времени выставляет applyStartTime до старта группы.
+func (c Config) startOffset() int64 {
+	if c.StartFrom == StartLatest {
+		return kafka.LastOffset
+	}
+	return kafka.FirstOffset
+}
+
+func (c Config) tlsConfig() (*tls.Config, error) {
+	if !c.TLS.Enabled {
+		return nil, nil
+	}
+	tc := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: c.TLS.InsecureSkipVerify,
+	}
+	if c.TLS.CAFile != "" {
+		pem, err := os.ReadFile(c.TLS.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", c.TLS.CAFile)
+		}
+		tc.RootCAs = pool
+	}
+	if c.TLS.CertFile != "" || c.TLS.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.TLS.CertFile, c.TLS.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client cert: %w", err)
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	return tc, nil
+}
+
+func (c Config) saslMechanism() (sasl.Mechanism, error) {
+	switch c.SASL.Mechanism {
+	case "":
+		return nil, nil
+	case "plain":
+		return plain.Mechanism{Username: c.SASL.Username, Password: c.SASL.Password}, nil
+	case "scram-sha-256":
+		return scram.Mechanism(scram.SHA256, c.SASL.Username, c.SASL.Password)
+	case "scram-sha-512":
+		return scram.Mechanism(scram.SHA512, c.SASL.Username, c.SASL.Password)
+	}
+	return nil, fmt.Errorf("unknown SASL mechanism %q", c.SASL.Mechanism)
+}
+
+// Dialer — для ридеров и группы консьюмеров.
+func (c Config) Dialer() (*kafka.Dialer, error) {
+	tc, err := c.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	mech, err := c.saslMechanism()
+	if err != nil {
+		return nil, err
+	}
+	return &kafka.Dialer{
+		ClientID:      c.ClientID,
+		Timeout:       10 * time.Second,
+		DualStack:     true,
+		TLS:           tc,
+		SASLMechanism: mech,
+	}, nil
+}
+
+// Transport — для writer'ов (DLQ) и админского клиента.
+func (c Config) Transport() (*kafka.Transport, error) {
+	tc, err := c.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	mech, err := c.saslMechanism()
+	if err != nil {
+		return nil, err
+	}
+	return &kafka.Transport{
+		ClientID: c.ClientID,
+		TLS:      tc,
+		SASL:     mech,
+	}, nil
+}
+
+// ReaderConfig — конфиг kafka.Reader группы: один топик или GroupTopics.
+func (c Config) ReaderConfig(dialer *kafka.Dialer) kafka.ReaderConfig {
+	rc := kafka.ReaderConfig{
+		Brokers:           c.Brokers,
+		GroupID:           c.GroupID,
+		Dialer:            dialer,
+		MinBytes:          c.MinBytes,
+		MaxBytes:          c.MaxBytes,
+		MaxWait:           c.MaxWait,
+		StartOffset:       c.startOffset(),
+		SessionTimeout:    c.SessionTimeout,
+		HeartbeatInterval: c.HeartbeatInterval,
+		RebalanceTimeout:  c.RebalanceTimeout,
+	}
+	if len(c.Topics) == 1 {
+		rc.Topic = c.Topics[0]
+	} else {
+		rc.GroupTopics = c.Topics
+	}
+	return rc
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+func envOr(key, def string) string {
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		return v
+	}
+	return def
+}
+
+func envInt(key string, def int) (int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return def, fmt.Errorf("%s: %w", key, err)
+	}
+	return n, nil
+}
+
+func envDuration(key string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return def, fmt.Errorf("%s: %w", key, err)
+	}
+	return d, nil
+}
+
+func envFloat(key string, def float64) (float64, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return def, fmt.Errorf("%s: %w", key, err)
+	}
+	return f, nil
+}
+
+func envBool(key string) (bool, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", key, err)
+	}
+	return b, nil
+}
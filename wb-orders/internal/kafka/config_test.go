@@ -0,0 +1,215 @@
+package kafka
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setEnv очищает все KAFKA_* окружения теста и выставляет kv поверх
+// минимального рабочего набора.
+func setEnv(t *testing.T, kv map[string]string) {
+	t.Helper()
+	for _, e := range os.Environ() {
+		if k, _, _ := strings.Cut(e, "="); strings.HasPrefix(k, "KAFKA_") {
+			t.Setenv(k, "")
+		}
+	}
+	base := map[string]string{
+		"KAFKA_BROKERS":      " k1:9092, ,k2:9092 ",
+		"KAFKA_TOPIC_ORDERS": "orders",
+		"KAFKA_GROUP_ORDERS": "wb",
+	}
+	for k, v := range kv {
+		base[k] = v
+	}
+	for k, v := range base {
+		t.Setenv(k, v)
+	}
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	setEnv(t, nil)
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if !slices.Equal(cfg.Brokers, []string{"k1:9092", "k2:9092"}) {
+		t.Errorf("Brokers = %q", cfg.Brokers)
+	}
+	if cfg.Source != SourceKafka || cfg.OffsetStore != OffsetStoreKafka || cfg.StartFrom != StartEarliest {
+		t.Errorf("source=%s offsets=%s start=%s", cfg.Source, cfg.OffsetStore, cfg.StartFrom)
+	}
+	if cfg.ClientID != "wb-orders" || cfg.StatusGroupID != "wb-status" {
+		t.Errorf("client=%q status group=%q", cfg.ClientID, cfg.StatusGroupID)
+	}
+	if cfg.Workers != 1 || cfg.BatchSize != 1 || cfg.BatchWait != DefaultBatchWait || cfg.DrainTimeout != DefaultDrainTimeout {
+		t.Errorf("workers=%d batch=%d wait=%s drain=%s", cfg.Workers, cfg.BatchSize, cfg.BatchWait, cfg.DrainTimeout)
+	}
+	if cfg.TLS.Enabled || cfg.SASL.Mechanism != "" || cfg.Backpressure.Enabled || cfg.DedupTTL != 0 {
+		t.Errorf("tls=%t sasl=%q bp=%t dedup=%s, want all off", cfg.TLS.Enabled, cfg.SASL.Mechanism, cfg.Backpressure.Enabled, cfg.DedupTTL)
+	}
+	if rc := cfg.ReaderConfig(nil); rc.Topic != "orders" || rc.GroupTopics != nil {
+		t.Errorf("reader topic=%q group topics=%q", rc.Topic, rc.GroupTopics)
+	}
+}
+
+func TestLoadConfigValues(t *testing.T) {
+	setEnv(t, map[string]string{
+		"KAFKA_TOPIC_ORDERS":   "a,b",
+		"KAFKA_START_FROM":     "2024-03-01T10:00:00Z",
+		"KAFKA_SASL_MECHANISM": "SCRAM-SHA-512",
+		"KAFKA_WORKERS":        "4",
+		"KAFKA_BATCH_WAIT_MS":  "250",
+		"KAFKA_DRAIN_TIMEOUT":  "3s",
+		"KAFKA_GROUP_STATUS":   "statuses",
+		"KAFKA_OFFSET_STORE":   "postgres",
+	})
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if want := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC); !cfg.StartTime.Equal(want) {
+		t.Errorf("StartTime = %s, want %s", cfg.StartTime, want)
+	}
+	if cfg.SASL.Mechanism != "scram-sha-512" || cfg.Workers != 4 || cfg.BatchWait != 250*time.Millisecond ||
+		cfg.DrainTimeout != 3*time.Second || cfg.StatusGroupID != "statuses" || cfg.OffsetStore != OffsetStorePostgres {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+	if rc := cfg.ReaderConfig(nil); rc.Topic != "" || !slices.Equal(rc.GroupTopics, []string{"a", "b"}) {
+		t.Errorf("reader topic=%q group topics=%q", rc.Topic, rc.GroupTopics)
+	}
+	if _, err := cfg.Dialer(); err != nil {
+		t.Errorf("Dialer: %v", err)
+	}
+}
+
+func TestLoadConfigParseErrors(t *testing.T) {
+	setEnv(t, map[string]string{
+		"KAFKA_WORKERS":         "many",
+		"KAFKA_SESSION_TIMEOUT": "30",
+		"KAFKA_TLS_ENABLED":     "maybe",
+		"KAFKA_BP_SLOW_ERRORS":  "half",
+	})
+	_, err := LoadConfig()
+	if err == nil {
+		t.Fatal("LoadConfig accepted bad values")
+	}
+	// Все ошибки разбора сразу, а не только первая
+	for _, env := range []string{"KAFKA_WORKERS", "KAFKA_SESSION_TIMEOUT", "KAFKA_TLS_ENABLED", "KAFKA_BP_SLOW_ERRORS"} {
+		if !strings.Contains(err.Error(), env) {
+			t.Errorf("error does not mention %s: %v", env, err)
+		}
+	}
+}
+
+func TestLoadConfigValidate(t *testing.T) {
+	cases := []struct {
+		name string
+		env  map[string]string
+		want string // подстрока ошибки
+	}{
+		{"no brokers", map[string]string{"KAFKA_BROKERS": ""}, "KAFKA_BROKERS is empty"},
+		{"no topics", map[string]string{"KAFKA_TOPIC_ORDERS": " , "}, "KAFKA_TOPIC_ORDERS is empty"},
+		{"no group", map[string]string{"KAFKA_GROUP_ORDERS": ""}, "KAFKA_GROUP_ORDERS is empty"},
+		{"unknown source", map[string]string{"KAFKA_SOURCE": "s3"}, "unknown KAFKA_SOURCE"},
+		{"dir without path", map[string]string{"KAFKA_SOURCE": "dir"}, "KAFKA_SOURCE_DIR is empty"},
+		{"dir with postgres offsets", map[string]string{"KAFKA_SOURCE": "dir", "KAFKA_SOURCE_DIR": "/in",
+			"KAFKA_OFFSET_STORE": "postgres"}, "needs KAFKA_SOURCE=kafka"},
+		{"dir bad poll", map[string]string{"KAFKA_SOURCE": "dir", "KAFKA_SOURCE_DIR": "/in",
+			"KAFKA_SOURCE_POLL": "0s"}, "KAFKA_SOURCE_POLL"},
+		{"dir output without brokers", map[string]string{"KAFKA_SOURCE": "dir", "KAFKA_SOURCE_DIR": "/in",
+			"KAFKA_BROKERS": "", "KAFKA_TOPIC_OUTPUT": "out"}, "KAFKA_TOPIC_OUTPUT needs KAFKA_BROKERS"},
+		{"status without group", map[string]string{"KAFKA_SOURCE": "dir", "KAFKA_SOURCE_DIR": "/in",
+			"KAFKA_GROUP_ORDERS": "", "KAFKA_TOPIC_STATUS": "status"}, "KAFKA_TOPIC_STATUS needs"},
+		{"bad start", map[string]string{"KAFKA_START_FROM": "yesterday"}, "KAFKA_START_FROM"},
+		{"bad offset store", map[string]string{"KAFKA_OFFSET_STORE": "redis"}, "unknown KAFKA_OFFSET_STORE"},
+		{"bad sasl", map[string]string{"KAFKA_SASL_MECHANISM": "gssapi"}, "unknown KAFKA_SASL_MECHANISM"},
+		{"zero workers", map[string]string{"KAFKA_WORKERS": "0"}, "must be positive"},
+		{"zero batch wait", map[string]string{"KAFKA_BATCH_WAIT_MS": "0"}, "must be positive"},
+		{"negative drain", map[string]string{"KAFKA_DRAIN_TIMEOUT": "-1s"}, "KAFKA_DRAIN_TIMEOUT"},
+		{"batch and workers", map[string]string{"KAFKA_WORKERS": "2", "KAFKA_BATCH_SIZE": "10"}, "mutually exclusive"},
+		{"bp window", map[string]string{"KAFKA_BACKPRESSURE": "true", "KAFKA_BP_WINDOW": "0"}, "KAFKA_BP_WINDOW"},
+		{"bp latency", map[string]string{"KAFKA_BACKPRESSURE": "true", "KAFKA_BP_SLOW_LATENCY": "-1ms"}, "must not be negative"},
+		{"bp error ratio", map[string]string{"KAFKA_BACKPRESSURE": "true", "KAFKA_BP_PAUSE_ERRORS": "1.5"}, "within [0, 1]"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			setEnv(t, tc.env)
+			_, err := LoadConfig()
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("err = %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigDirSource(t *testing.T) {
+	// Без брокеров DLQ и статусы выключаются, остальное работает
+	setEnv(t, map[string]string{
+		"KAFKA_SOURCE": "dir", "KAFKA_SOURCE_DIR": "/in", "KAFKA_BROKERS": "",
+		"KAFKA_TOPIC_DLQ": "dlq", "KAFKA_TOPIC_STATUS": "status",
+	})
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if cfg.DLQTopic != "" || cfg.StatusTopic != "" || cfg.SourcePoll != DefaultSourcePoll {
+		t.Errorf("dlq=%q status=%q poll=%s", cfg.DLQTopic, cfg.StatusTopic, cfg.SourcePoll)
+	}
+
+	// Невалидный backpressure не мешает, пока он выключен
+	setEnv(t, map[string]string{"KAFKA_BP_WINDOW": "0"})
+	if _, err := LoadConfig(); err != nil {
+		t.Errorf("disabled backpressure validated: %v", err)
+	}
+}
+
+func TestConfigTLS(t *testing.T) {
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	setEnv(t, map[string]string{"KAFKA_TLS_CA_FILE": ca})
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	// Файл CA включает TLS сам по себе
+	if !cfg.TLS.Enabled {
+		t.Fatal("KAFKA_TLS_CA_FILE did not enable TLS")
+	}
+	if _, err := cfg.Dialer(); err == nil || !strings.Contains(err.Error(), "read CA") {
+		t.Errorf("missing CA: err = %v", err)
+	}
+	if err := os.WriteFile(ca, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.Transport(); err == nil || !strings.Contains(err.Error(), "no certificates") {
+		t.Errorf("bad CA: err = %v", err)
+	}
+
+	setEnv(t, map[string]string{"KAFKA_TLS_ENABLED": "true", "KAFKA_TLS_INSECURE": "1"})
+	cfg, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	tc, err := cfg.tlsConfig()
+	if err != nil || tc == nil || !tc.InsecureSkipVerify || tc.RootCAs != nil {
+		t.Errorf("tlsConfig = %+v, %v", tc, err)
+	}
+}
+
+func TestConfigSASL(t *testing.T) {
+	for _, mech := range []string{"plain", "scram-sha-256", "scram-sha-512"} {
+		setEnv(t, map[string]string{"KAFKA_SASL_MECHANISM": mech, "KAFKA_SASL_USERNAME": "u", "KAFKA_SASL_PASSWORD": "p"})
+		cfg, err := LoadConfig()
+		if err != nil {
+			t.Fatalf("%s: LoadConfig: %v", mech, err)
+		}
+		d, err := cfg.Dialer()
+		if err != nil || d.SASLMechanism == nil {
+			t.Errorf("%s: Dialer = %+v, %v", mech, d, err)
+		}
+	}
+}
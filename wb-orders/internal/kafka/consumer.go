@@ -3,83 +3,446 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"os"
 	"time"
 
 	"github.com/segmentio/kafka-go"
 
-	"wb-orders/internal/cache"
+	"wb-orders/internal/dedup"
+	"wb-orders/internal/ingest"
 	"wb-orders/internal/models"
+	"wb-orders/internal/pipeline"
 	"wb-orders/internal/storage"
 )
 
+// ErrStoreUnavailable — БД не приняла заказ после всех повторов.
+// Офсет при этом не коммитится: сообщение перечитается после рестарта.
+var ErrStoreUnavailable = errors.New("store unavailable")
+
+// orderStore — то, что нужно Consumer от storage.Repo.
+type orderStore interface {
+	UpsertOrder(ctx context.Context, o models.Order, a storage.Audit) error
+	UpsertOrderAt(ctx context.Context, o models.Order, a storage.Audit, pos storage.Position) error
+	UpsertOrders(ctx context.Context, orders []models.Order, audits []storage.Audit, positions []storage.Position) error
+	SaveOffset(ctx context.Context, pos storage.Position) error
+	StoredOffsets(ctx context.Context, group, topic string) (map[int]int64, error)
+	Quarantine(ctx context.Context, e storage.QuarantineEntry) error
+	Ping(ctx context.Context) error
+}
+
+// Где хранятся офсеты (KAFKA_OFFSET_STORE).
+const (
+	// OffsetStoreKafka — офсеты коммитятся в группу Kafka после сохранения
+	// заказа (at-least-once).
+	OffsetStoreKafka = "kafka"
+	// OffsetStorePostgres — офсет пишется в consumer_offsets в одной
+	// транзакции с заказом, чтение после назначения партиций начинается
+	// с него (exactly-once относительно БД).
+	OffsetStorePostgres = "postgres"
+)
+
+// RetryPolicy — повторы UpsertOrder при временных ошибках БД:
+// задержка растёт вдвое от BaseDelay до MaxDelay.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+var DefaultRetry = RetryPolicy{MaxAttempts: 5, BaseDelay: 200 * time.Millisecond, MaxDelay: 5 * time.Second}
+
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.BaseDelay << (attempt - 1)
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d
+}
+
 type Consumer struct {
-	reader *kafka.Reader
-	repo   *storage.Repo
-	cache  *cache.LRU
-}
-
-// Теперь создаём Consumer с зависимостями
-func NewConsumer(repo *storage.Repo, c *cache.LRU) *Consumer {
-	brokers := os.Getenv("KAFKA_BROKERS")
-	topic := os.Getenv("KAFKA_TOPIC_ORDERS")
-	groupID := os.Getenv("KAFKA_GROUP_ORDERS")
-
-	r := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:        []string{brokers},
-		Topic:          topic,
-		GroupID:        groupID,
-		MinBytes:       1,           // минимум 1 байт
-		MaxBytes:       10e6,        // максимум ~10Мб
-		CommitInterval: time.Second, // как часто фиксировать офсеты
-	})
+	source MessageSource
+	repo   orderStore
+	// chain — всё, что делается с заказом до и после записи в БД
+	// (разбор, валидация, обогащение, кэш, лог — см. pipeline.Default)
+	chain *pipeline.Chain
+	dlq   *DLQ
+	retry RetryPolicy
+	dedup *dedup.Deduper // nil — дедупликация выключена
+
+	// group задан, только если офсеты хранятся в Postgres
+	group string
+	// workers > 1 — параллельная обработка (см. runParallel)
+	workers int
+	// batchSize > 1 — пакетная запись (см. runBatch)
+	batchSize int
+	batchWait time.Duration
+
+	// gate — пауза перед чтением; autoPause — вместо остановки при
+	// недоступной БД вставать на паузу до её возвращения
+	gate      *pauseGate
+	autoPause bool
+	// bp — замедление чтения, пока БД тормозит или сбоит (nil — выключено)
+	bp *backpressure
 
-	return &Consumer{reader: r, repo: repo, cache: c}
+	// replayed — офсеты, которые повторяет replay (дедупликация их пропускает)
+	replayed *replayRanges
+
+	// drainTimeout — сколько после остановки дообрабатывать взятое (см. drainContext)
+	drainTimeout time.Duration
+
+	metrics *metrics
 }
 
+// Теперь создаём Consumer с зависимостями; подключение — из Config,
+// источник сообщений — по cfg.Source (см. NewSource).
+func NewConsumer(cfg Config, repo *storage.Repo, chain *pipeline.Chain) (*Consumer, error) {
+	// Старт с момента времени: выставляем офсеты группы до того, как она
+	// начнёт читать (только для партиций, где офсетов ещё нет).
+	if cfg.Source == SourceKafka && !cfg.StartTime.IsZero() {
+		admin, err := NewAdmin(cfg)
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		for _, topic := range cfg.Topics {
+			if err := admin.applyStartTime(ctx, topic, cfg.StartTime); err != nil {
+				return nil, fmt.Errorf("start from %s (%s): %w", cfg.StartFrom, topic, err)
+			}
+		}
+	}
+
+	src, group, err := NewSource(cfg, repo)
+	if err != nil {
+		return nil, err
+	}
+	cons, err := NewConsumerFrom(cfg, src, repo, repo, chain)
+	if err != nil {
+		_ = src.Close()
+		return nil, err
+	}
+	cons.group = group
+	return cons, nil
+}
+
+// NewConsumerFrom — Consumer над готовым источником (MemorySource,
+// DirSource или свой): тот же конвейер, DLQ и карантин, что и для Kafka.
+// Офсеты — только через CommitMessages источника. repo и seen обычно один
+// storage.Repo; seen не нужен, если дедупликация выключена (KAFKA_DEDUP_TTL).
+func NewConsumerFrom(cfg Config, src MessageSource, repo orderStore, seen dedup.Store, chain *pipeline.Chain) (*Consumer, error) {
+	transport, err := cfg.Transport()
+	if err != nil {
+		return nil, fmt.Errorf("kafka transport: %w", err)
+	}
+	return &Consumer{
+		source:    src,
+		repo:      repo,
+		chain:     chain,
+		dlq:       NewDLQ(cfg.Brokers, cfg.DLQTopic, transport),
+		dedup:     dedup.New(seen, cfg.DedupTTL, cfg.DedupCacheSize),
+		retry:     DefaultRetry,
+		workers:   cfg.Workers,
+		batchSize: cfg.BatchSize,
+		batchWait: cfg.BatchWait,
+		gate:      newPauseGate(),
+		autoPause: cfg.AutoPause,
+		bp:        newBackpressure(cfg.Backpressure),
+		metrics:   newMetrics(),
+
+		drainTimeout: cfg.DrainTimeout,
+	}, nil
+}
+
+// Run читает сообщения и коммитит офсет каждого только после обработки
+// (at-least-once). Ошибка возвращается, если продолжать нельзя без потери
+// сообщения: БД недоступна дольше политики повторов, DLQ не принял
+// сообщение или не прошёл коммит.
+//
+// Отмена ctx — остановка: новые сообщения не читаются, взятое в работу
+// дообрабатывается и коммитится (не дольше drainTimeout), и только после
+// этого Run возвращается.
 func (c *Consumer) Run(ctx context.Context) error {
+	if c.gate.reasonIs(PauseDBUnavailable) {
+		// автопауза пережила перезапуск — кто-то должен следить за БД
+		go c.probeDB(ctx)
+	}
+	work, release := drainContext(ctx, c.drainTimeout)
+	defer release()
+	defer func() {
+		if ctx.Err() != nil {
+			logDrain("consumer", work)
+		}
+	}()
+
+	switch {
+	case c.batchSize > 1:
+		return c.runBatch(ctx, work)
+	case c.workers > 1:
+		return c.runParallel(ctx, work)
+	}
 	for {
-		m, err := c.reader.ReadMessage(ctx)
+		if err := c.gate.wait(ctx); err != nil {
+			return nil
+		}
+		if err := c.bp.wait(ctx); err != nil {
+			return nil
+		}
+		m, err := c.source.FetchMessage(ctx)
 		if err != nil {
 			if ctx.Err() != nil {
 				// нормальное завершение по отмене контекста
 				return nil
 			}
-			return fmt.Errorf("read message: %w", err)
+			return fmt.Errorf("fetch message: %w", err)
 		}
+		c.metrics.fetched(m)
 
-		// Парсим JSON в структуру заказа
-		var ord models.Order
-		if err := json.Unmarshal(m.Value, &ord); err != nil {
-			log.Printf("[kafka] skip: bad json (offset=%d): %v", m.Offset, err)
-			continue
+		if err := c.handle(work, m); err != nil {
+			if work.Err() != nil {
+				return nil
+			}
+			return err
 		}
 
-		// Валидация
-		if err := storage.ValidateOrder(ord); err != nil {
-			log.Printf("[kafka] skip: invalid order (offset=%d): %v", m.Offset, err)
-			continue
+		if err := c.source.CommitMessages(work, m); err != nil {
+			if work.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("commit offset=%d: %w", m.Offset, err)
 		}
+	}
+}
+
+// handle обрабатывает одно сообщение. nil — сообщение можно коммитить
+// (сохранено или отклонено в DLQ), ошибка — нельзя.
+func (c *Consumer) handle(ctx context.Context, m kafka.Message) error {
+	if c.duplicate(ctx, m) {
+		return c.skipOffset(ctx, m)
+	}
+	p, err := c.prepare(ctx, m)
+	if err != nil {
+		return c.refuse(ctx, m, err)
+	}
+	return c.storeOne(ctx, p)
+}
+
+// refuse — цепочка не пустила сообщение к записи. Отказ данных — в DLQ,
+// фильтр — пропуск; прочее (временная ошибка звена) — наверх, без коммита.
+func (c *Consumer) refuse(ctx context.Context, m kafka.Message, err error) error {
+	if stage, ok := pipeline.IsReject(err); ok {
+		return c.reject(ctx, m, stage, err)
+	}
+	if c.filtered(m, err) {
+		return c.skipOffset(ctx, m)
+	}
+	return err
+}
+
+// filtered — err означает, что звено отфильтровало сообщение: считаем пропуск.
+func (c *Consumer) filtered(m kafka.Message, err error) bool {
+	reason, ok := pipeline.IsSkip(err)
+	if ok {
+		log.Printf("[kafka] skip: %s partition=%d offset=%d", reason, m.Partition, m.Offset)
+		c.metrics.skippedMsg(m, reason)
+	}
+	return ok
+}
 
-		// Сохраняем в БД (идемпотентно)
-		if err := c.repo.UpsertOrder(ctx, ord); err != nil {
-			log.Printf("[kafka] store error offset=%d id=%s: %v",
-				m.Offset, ord.OrderUID, err)
-			continue
+// storeOne сохраняет подготовленный заказ (с повторами) и прогоняет
+// звенья после записи. Ошибки данных уходят в DLQ, наверх — только то,
+// что мешает коммиту.
+func (c *Consumer) storeOne(ctx context.Context, p prepared) error {
+	ord, m := p.it.Order, p.m
+	ctx = ingest.WithMeta(ctx, p.it.Meta)
+
+	// Сохраняем в БД (идемпотентно, с повторами)
+	err := c.withRetry(ctx, "id="+ord.OrderUID, c.bp.timed(1, func() error {
+		if c.group != "" {
+			return c.repo.UpsertOrderAt(ctx, ord, p.it.Audit(), c.position(m))
+		}
+		return c.repo.UpsertOrder(ctx, ord, p.it.Audit())
+	}))
+	if err != nil {
+		if errors.Is(err, storage.ErrAlreadyApplied) {
+			log.Printf("[kafka] skip: already applied id=%s partition=%d offset=%d %s",
+				ord.OrderUID, m.Partition, m.Offset, p.it.Meta)
+			c.metrics.skippedMsg(m, SkipAlreadyApplied)
+			return c.afterStore(ctx, p)
+		}
+		if errors.Is(err, ErrStoreUnavailable) || ctx.Err() != nil {
+			return err
+		}
+		stage := StageStore
+		if errors.Is(err, models.ErrIllegalTransition) {
+			stage = StageTransition
+		}
+		return c.reject(ctx, m, stage, fmt.Errorf("id=%s: %w", ord.OrderUID, err))
+	}
+
+	return c.stored(ctx, p)
+}
+
+// stored — всё, что делается после успешной записи заказа в БД.
+func (c *Consumer) stored(ctx context.Context, p prepared) error {
+	if err := c.afterStore(ctx, p); err != nil {
+		return err
+	}
+	c.metrics.storedMsg(p.m, p.started)
+	return nil
+}
+
+// afterStore прогоняет звенья AfterStore (кэш, приёмники, лог),
+// потом ставит отметку дедупликации. Ошибка звена — сообщение не
+// коммитится. Вызывается и для уже применённого сообщения (офсеты в
+// Postgres: транзакция прошла, а звенья после неё — не обязательно), иначе
+// при повторной доставке они не прошли бы никогда.
+func (c *Consumer) afterStore(ctx context.Context, p prepared) error {
+	ctx = ingest.WithMeta(ctx, p.it.Meta)
+	if err := c.chain.Stored(ctx, p.it); err != nil {
+		return fmt.Errorf("after store id=%s: %w", p.it.Order.OrderUID, err)
+	}
+
+	// Повтор этого же сообщения больше не применится
+	c.dedup.Mark(ctx, dedupKey(p.m))
+	return nil
+}
+
+// withRetry — запись по политике повторов. С автопаузой повторы
+// не кончаются: консьюмер ждёт БД на паузе и начинает их заново.
+func (c *Consumer) withRetry(ctx context.Context, what string, write func() error) error {
+	for {
+		err := c.retry.do(ctx, what, write)
+		if !c.autoPause || !errors.Is(err, ErrStoreUnavailable) {
+			return err
 		}
+		if err := c.pauseForDB(ctx, err); err != nil {
+			return err
+		}
+	}
+}
+
+// do вызывает write, повторяя временные ошибки БД с экспоненциальной
+// задержкой. Постоянная ошибка возвращается сразу.
+func (p RetryPolicy) do(ctx context.Context, what string, write func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := write()
+		if err == nil || !storage.IsTransient(err) {
+			return err
+		}
+		if attempt >= p.MaxAttempts {
+			return fmt.Errorf("%w: %s after %d attempts: %v",
+				ErrStoreUnavailable, what, attempt, err)
+		}
+
+		wait := p.delay(attempt)
+		log.Printf("[kafka] store retry %s attempt=%d in %v: %v", what, attempt, wait, err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// reject отправляет сообщение в DLQ и, при офсетах в Postgres, сдвигает
+// офсет: иначе после рестарта оно снова придёт и снова уйдёт в DLQ.
+func (c *Consumer) reject(ctx context.Context, m kafka.Message, stage string, cause error) error {
+	if err := c.deadLetter(ctx, m, stage, cause); err != nil {
+		return err
+	}
+	return c.skipOffset(ctx, m)
+}
+
+// skipOffset — при офсетах в Postgres сдвигает офсет мимо сообщения,
+// которое не записывается в БД (DLQ, дубль).
+func (c *Consumer) skipOffset(ctx context.Context, m kafka.Message) error {
+	if c.group == "" {
+		return nil
+	}
+	if err := c.repo.SaveOffset(ctx, c.position(m)); err != nil {
+		return fmt.Errorf("save offset=%d: %w", m.Offset, err)
+	}
+	return nil
+}
+
+// duplicate — сообщение (по заголовку message-id или хэшу содержимого) уже
+// применялось: считаем, подтверждаем и не применяем повторно. Сообщения,
+// которые повторяет replay, дублями не считаются — ради них он и делается.
+func (c *Consumer) duplicate(ctx context.Context, m kafka.Message) bool {
+	if c.replayed.covers(m) {
+		return false
+	}
+	key := dedupKey(m)
+	if !c.dedup.Seen(ctx, key) {
+		return false
+	}
+	log.Printf("[kafka] skip: duplicate %s partition=%d offset=%d", key, m.Partition, m.Offset)
+	c.metrics.skippedMsg(m, SkipDuplicate)
+	return true
+}
+
+// dedupKey — ключ дедупликации сообщения; отпечаток содержимого — в рамках заказа.
+func dedupKey(m kafka.Message) string {
+	return dedup.Key(header(m, HeaderMessageID), string(orderKey(m)), m.Value)
+}
 
-		// Обновляем кэш
-		c.cache.Set(ord.OrderUID, ord)
+// deadLetter логирует отклонённое сообщение, кладёт его в карантин (для
+// поддержки: просмотр, правка и повтор) и отправляет в DLQ (если задан).
+// Ошибки карантина и DLQ возвращаются наверх: иначе сообщение было бы потеряно.
+func (c *Consumer) deadLetter(ctx context.Context, m kafka.Message, stage string, cause error) error {
+	meta := messageMeta(m)
+	log.Printf("[kafka] skip: stage=%s partition=%d offset=%d %s: %v",
+		stage, m.Partition, m.Offset, meta, cause)
+	c.metrics.skippedMsg(m, stage)
 
-		// Краткий лог
-		log.Printf("[kafka] stored order: id=%s items=%d offset=%d",
-			ord.OrderUID, len(ord.Items), m.Offset)
+	entry := storage.QuarantineEntry{
+		OrderUID: string(orderKey(m)),
+		Stage:    stage,
+		Reason:   cause.Error(),
+		Raw:      m.Value,
+		Meta:     meta,
+	}
+	err := c.withRetry(ctx, fmt.Sprintf("quarantine offset=%d", m.Offset), func() error {
+		return c.repo.Quarantine(ctx, entry)
+	})
+	if err != nil {
+		return fmt.Errorf("quarantine offset=%d: %w", m.Offset, err)
 	}
+
+	if c.dlq == nil {
+		return nil
+	}
+	if err := c.dlq.Send(ctx, m, stage, cause); err != nil {
+		return fmt.Errorf("offset=%d: %w", m.Offset, err)
+	}
+	return nil
+}
+
+func (c *Consumer) position(m kafka.Message) storage.Position {
+	return storage.Position{Group: c.group, Topic: m.Topic, Partition: m.Partition, Offset: m.Offset}
+}
+
+// Stats — счётчики, лаг по партициям и гистограммы для /debug/consumer и /metrics.
+func (c *Consumer) Stats() ConsumerStats {
+	r, ok := c.source.(interface{ Stats() kafka.ReaderStats })
+	if ok {
+		c.metrics.addReader(r.Stats())
+	}
+	out := c.metrics.snapshot(ok)
+	out.State = c.gate.state()
+	out.Backpressure = c.bp.snapshot()
+	out.Dedup = c.dedup.Stats()
+	return out
 }
 
 func (c *Consumer) Close() error {
-	return c.reader.Close()
+	err := c.source.Close()
+	if c.dlq != nil {
+		if dErr := c.dlq.Close(); dErr != nil && err == nil {
+			err = dErr
+		}
+	}
+	return err
 }
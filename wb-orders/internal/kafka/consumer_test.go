@@ -0,0 +1,405 @@
+package kafka
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"wb-orders/internal/cache"
+	"wb-orders/internal/decode"
+	"wb-orders/internal/ingest"
+	"wb-orders/internal/models"
+	"wb-orders/internal/normalize"
+	"wb-orders/internal/pipeline"
+	"wb-orders/internal/storage"
+)
+
+const testOrder = `{
+	"order_uid": "b563feb7b2b84b6test",
+	"track_number": "WBILMTESTTRACK",
+	"entry": "WBIL",
+	"delivery": {"name": "Test Testov", "phone": "+9720000000", "zip": "2639809",
+		"city": "Kiryat Mozkin", "address": "Ploshad Mira 15", "region": "Kraiot", "email": "test@gmail.com"},
+	"payment": {"transaction": "b563feb7b2b84b6test", "request_id": "", "currency": "USD",
+		"provider": "wbpay", "amount": 1817, "payment_dt": 1637907727, "bank": "alpha",
+		"delivery_cost": 1500, "goods_total": 317, "custom_fee": 0},
+	"items": [{"chrt_id": 9934930, "track_number": "WBILMTESTTRACK", "price": 453,
+		"rid": "ab4219087a764ae0btest", "name": "Mascaras", "sale": 30, "size": "0",
+		"total_price": 317, "nm_id": 2389212, "brand": "Vivienne Sabo", "status": 202}],
+	"locale": "en",
+	"internal_signature": "",
+	"customer_id": "test",
+	"delivery_service": "meest",
+	"shardkey": "9",
+	"sm_id": 99,
+	"date_created": "2021-11-26T06:22:19Z",
+	"oof_shard": "1"
+}`
+
+// fakeReader отдаёт сообщения по очереди, потом ждёт отмены контекста.
+type fakeReader struct {
+	mu        sync.Mutex
+	msgs      []kafka.Message
+	committed []int64
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	r.mu.Lock()
+	if len(r.msgs) > 0 {
+		m := r.msgs[0]
+		r.msgs = r.msgs[1:]
+		r.mu.Unlock()
+		return m, nil
+	}
+	r.mu.Unlock()
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+func (r *fakeReader) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range msgs {
+		r.committed = append(r.committed, m.Offset)
+	}
+	return nil
+}
+
+func (r *fakeReader) Close() error { return nil }
+
+func (r *fakeReader) commits() []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]int64(nil), r.committed...)
+}
+
+// flakyStore падает с временной ошибкой failures раз, потом сохраняет.
+type flakyStore struct {
+	mu       sync.Mutex
+	failures int
+	calls    int
+	orders   map[string]models.Order
+	audits   map[string]storage.Audit // пишутся вместе с заказом
+}
+
+func (s *flakyStore) UpsertOrder(_ context.Context, o models.Order, a storage.Audit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if s.failures < 0 || s.calls <= s.failures {
+		return driver.ErrBadConn
+	}
+	if s.orders == nil {
+		s.orders, s.audits = make(map[string]models.Order), make(map[string]storage.Audit)
+	}
+	s.orders[o.OrderUID], s.audits[o.OrderUID] = o, a
+	return nil
+}
+
+func (s *flakyStore) UpsertOrderAt(ctx context.Context, o models.Order, a storage.Audit, _ storage.Position) error {
+	return s.UpsertOrder(ctx, o, a)
+}
+
+func (s *flakyStore) UpsertOrders(ctx context.Context, orders []models.Order, audits []storage.Audit, _ []storage.Position) error {
+	for i, o := range orders {
+		if err := s.UpsertOrder(ctx, o, audits[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *flakyStore) SaveOffset(context.Context, storage.Position) error { return nil }
+
+func (s *flakyStore) StoredOffsets(context.Context, string, string) (map[int]int64, error) {
+	return nil, nil
+}
+
+func (s *flakyStore) Ping(context.Context) error { return nil }
+
+func (s *flakyStore) Quarantine(context.Context, storage.QuarantineEntry) error { return nil }
+
+func newTestChain(c *cache.LRU) *pipeline.Chain {
+	return pipeline.Default(decode.New(decode.ModeStrict, 0), normalize.New(), c)
+}
+
+// newTestConsumer — Consumer из NewConsumerFrom без DLQ и дедупликации,
+// с быстрыми повторами.
+func newTestConsumer(r MessageSource, s orderStore) *Consumer {
+	c, err := NewConsumerFrom(Config{}, r, s, nil, newTestChain(cache.NewLRU(10)))
+	if err != nil {
+		panic(err)
+	}
+	c.retry = RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+	return c
+}
+
+func TestConsumerRetriesTransientStoreErrors(t *testing.T) {
+	r := &fakeReader{msgs: []kafka.Message{{Offset: 7, Value: []byte(testOrder)}}}
+	s := &flakyStore{failures: 3}
+	c := newTestConsumer(r, s)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- c.Run(ctx) }()
+
+	deadline := time.After(2 * time.Second)
+	for len(r.commits()) == 0 {
+		select {
+		case <-deadline:
+			t.Fatal("offset was not committed")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if _, ok := s.orders["b563feb7b2b84b6test"]; !ok {
+		t.Fatal("order was committed but not stored")
+	}
+	if s.calls != 4 {
+		t.Fatalf("UpsertOrder calls = %d, want 4", s.calls)
+	}
+	if got := r.commits(); len(got) != 1 || got[0] != 7 {
+		t.Fatalf("committed = %v, want [7]", got)
+	}
+}
+
+func TestConsumerDoesNotCommitWhenStoreIsDown(t *testing.T) {
+	r := &fakeReader{msgs: []kafka.Message{{Offset: 7, Value: []byte(testOrder)}}}
+	s := &flakyStore{failures: -1}
+	c := newTestConsumer(r, s)
+
+	err := c.Run(context.Background())
+	if !errors.Is(err, ErrStoreUnavailable) {
+		t.Fatalf("Run error = %v, want ErrStoreUnavailable", err)
+	}
+	if got := r.commits(); len(got) != 0 {
+		t.Fatalf("committed = %v, want nothing", got)
+	}
+	if s.calls != 5 {
+		t.Fatalf("UpsertOrder calls = %d, want 5", s.calls)
+	}
+}
+
+// fakePublisher запоминает опубликованные заказы.
+type fakePublisher struct {
+	mu   sync.Mutex
+	sent map[string][]byte
+}
+
+func (p *fakePublisher) Publish(_ context.Context, key string, value []byte, _ ingest.Meta) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sent == nil {
+		p.sent = make(map[string][]byte)
+	}
+	p.sent[key] = value
+	return nil
+}
+
+func TestConsumerPublishesEnrichedOrderAfterStore(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		failures int
+		want     int
+	}{
+		{"stored", 0, 1},
+		{"store down", -1, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &fakeReader{msgs: []kafka.Message{{Offset: 7, Value: []byte(testOrder)}}}
+			s := &flakyStore{failures: tc.failures}
+			c := newTestConsumer(r, s)
+			pub := &fakePublisher{}
+			if err := c.chain.InsertAfter(pipeline.StageCache, pipeline.Publish(pub)); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			_ = c.Run(ctx)
+
+			if len(pub.sent) != tc.want {
+				t.Fatalf("published %d orders, want %d", len(pub.sent), tc.want)
+			}
+			data, ok := pub.sent["b563feb7b2b84b6test"]
+			if !ok {
+				return
+			}
+			var got pipeline.EnrichedOrder
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			e := got.Enrichment
+			if got.OrderUID != "b563feb7b2b84b6test" || e.ItemCount != 1 || e.Total != "18.17" ||
+				len(e.StatusNames) != 1 || e.StatusNames[0] != "assembling" || !e.Flags[pipeline.FlagHasEmail] {
+				t.Fatalf("enriched = %+v", got)
+			}
+		})
+	}
+}
+
+// Аудит едет в запись заказа (одна транзакция), а не отдельным звеном после неё.
+func TestConsumerStoresAuditWithOrder(t *testing.T) {
+	for _, batch := range []int{1, 2} {
+		m := kafka.Message{Topic: "orders", Partition: 2, Offset: 7, Key: []byte("b563feb7b2b84b6test"), Value: []byte(testOrder),
+			Headers: []kafka.Header{
+				{Key: HeaderTraceParent, Value: []byte("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")},
+				{Key: HeaderProducer, Value: []byte("checkout")},
+			}}
+		r := &fakeReader{msgs: []kafka.Message{m}}
+		s := &flakyStore{}
+		c := newTestConsumer(r, s)
+		c.batchSize, c.batchWait = batch, 10*time.Millisecond
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		_ = c.Run(ctx)
+		cancel()
+
+		s.mu.Lock()
+		a, ok := s.audits["b563feb7b2b84b6test"]
+		s.mu.Unlock()
+		if !ok {
+			t.Fatalf("batch=%d: order stored without audit", batch)
+		}
+		if string(a.Raw) != testOrder {
+			t.Errorf("batch=%d: raw = %q", batch, a.Raw)
+		}
+		if a.Meta.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || a.Meta.Producer != "checkout" ||
+			a.Meta.Topic != "orders" || a.Meta.Partition != 2 || a.Meta.Offset != 7 || a.Meta.Key != "b563feb7b2b84b6test" {
+			t.Errorf("batch=%d: meta = %+v", batch, a.Meta)
+		}
+	}
+}
+
+func TestBackpressureThrottlesPausesAndRecovers(t *testing.T) {
+	b := newBackpressure(BackpressureConfig{
+		Enabled: true, Window: 10,
+		SlowLatency: 100 * time.Millisecond, PauseLatency: time.Second,
+		SlowErrors: 0.2, PauseErrors: 0.5,
+		MaxDelay: 200 * time.Millisecond, PauseFor: 30 * time.Millisecond,
+	})
+	feed := func(latency time.Duration, failed bool) {
+		for range 10 {
+			b.record(latency, failed)
+		}
+	}
+	want := func(state string, delay time.Duration) {
+		t.Helper()
+		if st := b.snapshot(); st.State != state || st.DelayMs != delay.Milliseconds() {
+			t.Fatalf("state = %s delay=%dms, want %s delay=%v", st.State, st.DelayMs, state, delay)
+		}
+	}
+
+	feed(150*time.Millisecond, false)
+	want(BackpressureThrottled, bpMinDelay)
+
+	feed(5*time.Millisecond, true) // половина окна — ошибки
+	want(BackpressurePaused, 200*time.Millisecond)
+	if err := b.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want(BackpressureThrottled, 200*time.Millisecond)
+
+	for delay := 100 * time.Millisecond; delay >= bpMinDelay; delay /= 2 {
+		b.adjusted = time.Time{}
+		feed(5*time.Millisecond, false)
+		want(BackpressureThrottled, delay)
+	}
+	b.adjusted = time.Time{}
+	feed(5*time.Millisecond, false)
+	want(BackpressureRunning, 0)
+}
+
+func TestConsumerFromMemorySource(t *testing.T) {
+	src := NewMemorySource(
+		kafka.Message{Value: []byte(testOrder)},
+		kafka.Message{Value: []byte(`{"order_uid": `)},
+	)
+	s := &flakyStore{}
+	lru := cache.NewLRU(10)
+	c := newTestConsumer(src, s)
+	c.chain = newTestChain(lru)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- c.Run(ctx) }()
+
+	deadline := time.After(2 * time.Second)
+	for len(src.Committed()) < 2 {
+		select {
+		case <-deadline:
+			t.Fatalf("committed %d of 2 messages", len(src.Committed()))
+		case <-time.After(time.Millisecond):
+		}
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if _, ok := lru.Get("b563feb7b2b84b6test"); !ok {
+		t.Fatal("stored order is not in cache")
+	}
+	if len(s.orders) != 1 {
+		t.Fatalf("stored %d orders, want 1", len(s.orders))
+	}
+	if got := c.Stats().Skipped[StageDecode]; got != 1 {
+		t.Fatalf("skipped at decode = %d, want 1", got)
+	}
+}
+
+func TestDirSourceMovesCommittedFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "order.json"), []byte(testOrder), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "order.json.tmp"), []byte(testOrder), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	src, err := NewDirSource(dir, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &flakyStore{}
+	c := newTestConsumer(src, s)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- c.Run(ctx) }()
+
+	processed := filepath.Join(dir, ProcessedDir, "order.json")
+	deadline := time.After(2 * time.Second)
+	for {
+		if _, err := os.Stat(processed); err == nil {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("file was not moved to processed/")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if len(s.orders) != 1 {
+		t.Fatalf("stored %d orders, want 1", len(s.orders))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "order.json.tmp")); err != nil {
+		t.Fatalf("non-json file was touched: %v", err)
+	}
+}
@@ -0,0 +1,206 @@
+// internal/kafka/dirsource.go
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	// DefaultSourcePoll — как часто DirSource заглядывает в каталог (KAFKA_SOURCE_POLL).
+	DefaultSourcePoll = time.Second
+	// ProcessedDir — подкаталог, куда DirSource переносит подтверждённые файлы.
+	ProcessedDir = "processed"
+)
+
+// DirSource — источник из каталога: каждый *.json файл — одно сообщение
+// с заказом. Файлы берутся по имени, после подтверждения (заказ сохранён
+// или отклонён в DLQ и карантин) переносятся в processed/. Файл, который
+// не успели подтвердить, после перезапуска будет прочитан снова.
+//
+// Файл должен появляться в каталоге целиком: писать во временное имя
+// (не *.json) и переименовывать.
+type DirSource struct {
+	dir       string
+	processed string
+	poll      time.Duration
+	topic     string
+
+	mu       sync.Mutex
+	seq      int64
+	queue    []string         // найденные, ещё не выданные
+	inflight map[int64]string // офсет → выданный, но не подтверждённый файл
+	taken    map[string]bool  // в queue или inflight
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func NewDirSource(dir string, poll time.Duration) (*DirSource, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("source dir %q: %w", dir, err)
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, fmt.Errorf("source dir: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("source dir %s is not a directory", abs)
+	}
+	processed := filepath.Join(abs, ProcessedDir)
+	if err := os.MkdirAll(processed, 0o755); err != nil {
+		return nil, fmt.Errorf("source dir: %w", err)
+	}
+	if poll <= 0 {
+		poll = DefaultSourcePoll
+	}
+	return &DirSource{
+		dir:       abs,
+		processed: processed,
+		poll:      poll,
+		topic:     "dir:" + abs,
+		// Офсеты растут и между запусками: карантин узнаёт повтор
+		// сообщения по topic/partition/offset.
+		seq:      time.Now().UnixMicro(),
+		inflight: make(map[int64]string),
+		taken:    make(map[string]bool),
+		closed:   make(chan struct{}),
+	}, nil
+}
+
+func (s *DirSource) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	for {
+		if m, ok, err := s.next(); err != nil || ok {
+			return m, err
+		}
+		if err := s.scan(); err != nil {
+			return kafka.Message{}, err
+		}
+		if s.queued() {
+			continue
+		}
+
+		select {
+		case <-time.After(s.poll):
+		case <-s.closed:
+			return kafka.Message{}, ErrSourceClosed
+		case <-ctx.Done():
+			return kafka.Message{}, ctx.Err()
+		}
+	}
+}
+
+// next читает первый файл из очереди. ok=false — очередь пуста.
+func (s *DirSource) next() (kafka.Message, bool, error) {
+	for {
+		s.mu.Lock()
+		if len(s.queue) == 0 {
+			s.mu.Unlock()
+			return kafka.Message{}, false, nil
+		}
+		name := s.queue[0]
+		s.queue = s.queue[1:]
+		s.mu.Unlock()
+
+		path := filepath.Join(s.dir, name)
+		info, err := os.Stat(path)
+		var data []byte
+		if err == nil {
+			data, err = os.ReadFile(path)
+		}
+		if errors.Is(err, fs.ErrNotExist) {
+			// файл убрали, пока он ждал в очереди
+			s.mu.Lock()
+			delete(s.taken, name)
+			s.mu.Unlock()
+			continue
+		}
+		if err != nil {
+			return kafka.Message{}, false, fmt.Errorf("read %s: %w", path, err)
+		}
+
+		s.mu.Lock()
+		s.seq++
+		offset := s.seq
+		s.inflight[offset] = name
+		s.mu.Unlock()
+
+		return kafka.Message{
+			Topic:  s.topic,
+			Offset: offset,
+			Value:  data,
+			Time:   info.ModTime(),
+			Headers: []kafka.Header{
+				{Key: HeaderContentType, Value: []byte("application/json")},
+				{Key: HeaderProducer, Value: []byte("file:" + name)},
+			},
+		}, true, nil
+	}
+}
+
+// scan добавляет в очередь новые *.json файлы каталога (по имени).
+func (s *DirSource) scan() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("scan %s: %w", s.dir, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range entries {
+		name := e.Name()
+		if !e.Type().IsRegular() || !strings.EqualFold(filepath.Ext(name), ".json") || s.taken[name] {
+			continue
+		}
+		s.taken[name] = true
+		s.queue = append(s.queue, name)
+	}
+	return nil
+}
+
+func (s *DirSource) queued() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queue) > 0
+}
+
+// CommitMessages переносит в processed/ файлы переданных сообщений и все
+// выданные раньше них (партиция у источника одна).
+func (s *DirSource) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	var upto int64 = -1
+	for _, m := range msgs {
+		upto = max(upto, m.Offset)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for offset, name := range s.inflight {
+		if offset > upto {
+			continue
+		}
+		if err := os.Rename(filepath.Join(s.dir, name), filepath.Join(s.processed, name)); err != nil &&
+			!errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("commit %s: %w", name, err))
+			continue
+		}
+		delete(s.inflight, offset)
+		delete(s.taken, name)
+	}
+	return errors.Join(errs...)
+}
+
+// Close будит ждущих FetchMessage; дальше они получают ErrSourceClosed.
+func (s *DirSource) Close() error {
+	s.closeOnce.Do(func() { close(s.closed) })
+	return nil
+}
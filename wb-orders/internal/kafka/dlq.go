@@ -0,0 +1,86 @@
+// internal/kafka/dlq.go
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"wb-orders/internal/pipeline"
+)
+
+// Стадии, на которых сообщение может быть отклонено (заголовок dlq-stage).
+// Совпадают с именами звеньев pipeline; свои звенья могут отклонять
+// сообщения со своей стадией (pipeline.Reject).
+const (
+	StageDecode     = pipeline.StageDecode
+	StageKey        = pipeline.StageKey
+	StageVersion    = pipeline.StageVersion
+	StageValidate   = pipeline.StageValidate
+	StageTransition = pipeline.StageTransition
+	StageStore      = pipeline.StageStore
+)
+
+// Заголовки, которые DLQ добавляет к исходному сообщению.
+const (
+	HeaderDLQStage     = "dlq-stage"
+	HeaderDLQError     = "dlq-error"
+	HeaderDLQTopic     = "dlq-source-topic"
+	HeaderDLQPartition = "dlq-source-partition"
+	HeaderDLQOffset    = "dlq-source-offset"
+	HeaderDLQTimestamp = "dlq-timestamp"
+)
+
+// DLQ — топик для сообщений, которые не удалось обработать.
+// Ключ и значение уходят как есть, причина — в заголовках.
+type DLQ struct {
+	w *kafka.Writer
+}
+
+// NewDLQ возвращает nil, если топик не задан: тогда отклонённые сообщения
+// только логируются.
+func NewDLQ(brokers []string, topic string, transport *kafka.Transport) *DLQ {
+	if topic == "" {
+		return nil
+	}
+	return &DLQ{w: &kafka.Writer{
+		Addr:                   kafka.TCP(brokers...),
+		Transport:              transport,
+		Topic:                  topic,
+		Balancer:               &kafka.Hash{}, // тот же ключ — та же партиция
+		RequiredAcks:           kafka.RequireAll,
+		AllowAutoTopicCreation: true,
+	}}
+}
+
+func (d *DLQ) Topic() string { return d.w.Topic }
+
+// Send публикует исходное сообщение с описанием ошибки.
+func (d *DLQ) Send(ctx context.Context, m kafka.Message, stage string, cause error) error {
+	headers := make([]kafka.Header, 0, len(m.Headers)+6)
+	headers = append(headers, m.Headers...)
+	headers = append(headers,
+		kafka.Header{Key: HeaderDLQStage, Value: []byte(stage)},
+		kafka.Header{Key: HeaderDLQError, Value: []byte(cause.Error())},
+		kafka.Header{Key: HeaderDLQTopic, Value: []byte(m.Topic)},
+		kafka.Header{Key: HeaderDLQPartition, Value: []byte(strconv.Itoa(m.Partition))},
+		kafka.Header{Key: HeaderDLQOffset, Value: []byte(strconv.FormatInt(m.Offset, 10))},
+		kafka.Header{Key: HeaderDLQTimestamp, Value: []byte(time.Now().UTC().Format(time.RFC3339Nano))},
+	)
+
+	if err := d.w.WriteMessages(ctx, kafka.Message{
+		Key:     m.Key,
+		Value:   m.Value,
+		Headers: headers,
+	}); err != nil {
+		return fmt.Errorf("dlq write: %w", err)
+	}
+	return nil
+}
+
+func (d *DLQ) Close() error {
+	return d.w.Close()
+}
@@ -0,0 +1,46 @@
+// internal/kafka/drain.go
+package kafka
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+const (
+	// DefaultDrainTimeout — сколько при остановке дообрабатывать сообщения,
+	// уже взятые в работу (KAFKA_DRAIN_TIMEOUT).
+	DefaultDrainTimeout = 7 * time.Second
+	// ShutdownMargin — сверх drain: выход из группы и закрытие writer'ов.
+	// DrainTimeout + ShutdownMargin — вся остановка сервиса; с умолчаниями
+	// она укладывается в 10s grace period docker stop.
+	ShutdownMargin = time.Second
+)
+
+// errDrainTimeout — причина отмены контекста обработки: не уложились в drain.
+var errDrainTimeout = errors.New("drain timeout")
+
+// drainContext — контекст обработки уже прочитанных сообщений. Отмена ctx
+// останавливает только чтение: запись в БД, DLQ и коммит офсета идут ещё
+// timeout, потом отменяются — незавершённая транзакция откатывается, офсет
+// не коммитится, сообщение придёт снова.
+func drainContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	work, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() {
+		time.AfterFunc(timeout, func() { cancel(errDrainTimeout) })
+	})
+	return work, func() {
+		stop()
+		cancel(context.Canceled)
+	}
+}
+
+// logDrain — итог остановки для лога: уложились или откатили.
+func logDrain(who string, work context.Context) {
+	if errors.Is(context.Cause(work), errDrainTimeout) {
+		log.Printf("[kafka] %s: drain timeout, in-flight message rolled back and will be redelivered", who)
+		return
+	}
+	log.Printf("[kafka] %s: drained", who)
+}
@@ -0,0 +1,81 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"wb-orders/internal/models"
+	"wb-orders/internal/storage"
+)
+
+// slowStore — запись ждёт release (или отмены контекста записи);
+// entered — запись началась.
+type slowStore struct {
+	flakyStore
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *slowStore) UpsertOrder(ctx context.Context, o models.Order, a storage.Audit) error {
+	s.entered <- struct{}{}
+	select {
+	case <-s.release:
+		return s.flakyStore.UpsertOrder(ctx, o, a)
+	case <-ctx.Done():
+		return ctx.Err() // транзакция откатилась
+	}
+}
+
+// Остановка посреди записи: с запасом drain сообщение дописывается и
+// коммитится, без запаса — откатывается и остаётся незакоммиченным.
+func TestDrainInFlightMessage(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		drain      time.Duration
+		finish     bool // запись завершится во время drain
+		wantStored int
+	}{
+		{"finishes within drain", time.Second, true, 1},
+		{"drain timeout rolls back", 20 * time.Millisecond, false, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			src := NewMemorySource(kafka.Message{Value: []byte(testOrder)})
+			s := &slowStore{entered: make(chan struct{}, 1), release: make(chan struct{})}
+			c := newTestConsumer(src, s)
+			c.drainTimeout = tc.drain
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			go func() { done <- c.Run(ctx) }()
+
+			select {
+			case <-s.entered:
+			case <-time.After(2 * time.Second):
+				t.Fatal("store was never called")
+			}
+			cancel() // сигнал остановки, пока запись в работе
+			if tc.finish {
+				time.Sleep(10 * time.Millisecond) // отмена ctx не прервала запись
+				close(s.release)
+			}
+
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Fatalf("Run: %v", err)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("Run did not return after drain")
+			}
+			if len(s.orders) != tc.wantStored {
+				t.Errorf("stored %d orders, want %d", len(s.orders), tc.wantStored)
+			}
+			if got := len(src.Committed()); got != tc.wantStored {
+				t.Errorf("committed %d messages, want %d", got, tc.wantStored)
+			}
+		})
+	}
+}
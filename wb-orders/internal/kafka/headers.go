@@ -0,0 +1,55 @@
+// internal/kafka/headers.go
+package kafka
+
+import (
+	"strings"
+
+	"github.com/segmentio/kafka-go"
+
+	"wb-orders/internal/decode"
+	"wb-orders/internal/ingest"
+)
+
+// Заголовки входящих сообщений, которые консьюмер понимает.
+const (
+	HeaderTraceParent = "traceparent" // W3C Trace Context
+	HeaderTraceID     = "trace-id"    // упрощённый вариант: только trace id
+	HeaderRequestID   = "x-request-id"
+	HeaderProducer    = "producer"
+	HeaderContentType = "content-type"
+	HeaderMessageID   = "message-id" // id сообщения от продюсера (для дедупликации)
+)
+
+// messageMeta собирает метаданные сообщения из заголовков и координат в Kafka.
+// Trace id: traceparent, иначе trace-id, иначе x-request-id.
+func messageMeta(m kafka.Message) ingest.Meta {
+	meta := ingest.Meta{
+		MessageID:     header(m, HeaderMessageID),
+		Producer:      header(m, HeaderProducer),
+		ContentType:   header(m, HeaderContentType),
+		SchemaVersion: header(m, decode.VersionHeader),
+		Key:           string(m.Key),
+		Topic:         m.Topic,
+		Partition:     m.Partition,
+		Offset:        m.Offset,
+		Time:          m.Time,
+	}
+	meta.TraceID, meta.SpanID = ingest.ParseTraceParent(header(m, HeaderTraceParent))
+	for _, h := range []string{HeaderTraceID, HeaderRequestID} {
+		if meta.TraceID != "" {
+			break
+		}
+		meta.TraceID = strings.TrimSpace(header(m, h))
+	}
+	return meta
+}
+
+// header возвращает значение заголовка сообщения (регистр ключа не важен).
+func header(m kafka.Message, key string) string {
+	for _, h := range m.Headers {
+		if strings.EqualFold(h.Key, key) {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
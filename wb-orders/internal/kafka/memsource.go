@@ -0,0 +1,103 @@
+// internal/kafka/memsource.go
+package kafka
+
+import (
+	"context"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// MemoryTopic — топик сообщений MemorySource, если он не задан.
+const MemoryTopic = "memory"
+
+// MemorySource — источник в памяти для тестов и локальных прогонов:
+// сообщения кладутся через Push, подтверждённые видны в Committed.
+// Офсеты назначаются сами, подряд в каждой партиции — как в логе Kafka.
+type MemorySource struct {
+	mu        sync.Mutex
+	queue     []kafka.Message
+	next      map[string]int64 // topic/partition → следующий офсет
+	committed []kafka.Message
+	ready     chan struct{} // сигнал «в очереди что-то появилось»
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func NewMemorySource(msgs ...kafka.Message) *MemorySource {
+	s := &MemorySource{
+		next:   make(map[string]int64),
+		ready:  make(chan struct{}, 1),
+		closed: make(chan struct{}),
+	}
+	s.Push(msgs...)
+	return s
+}
+
+// Push добавляет сообщения в конец очереди.
+func (s *MemorySource) Push(msgs ...kafka.Message) {
+	s.mu.Lock()
+	for _, m := range msgs {
+		if m.Topic == "" {
+			m.Topic = MemoryTopic
+		}
+		tp := trackKey(m)
+		m.Offset = s.next[tp]
+		s.next[tp]++
+		s.queue = append(s.queue, m)
+	}
+	s.mu.Unlock()
+
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (s *MemorySource) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	for {
+		s.mu.Lock()
+		if len(s.queue) > 0 {
+			m := s.queue[0]
+			s.queue = s.queue[1:]
+			s.mu.Unlock()
+			return m, nil
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-s.ready:
+		case <-s.closed:
+			return kafka.Message{}, ErrSourceClosed
+		case <-ctx.Done():
+			return kafka.Message{}, ctx.Err()
+		}
+	}
+}
+
+func (s *MemorySource) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.committed = append(s.committed, msgs...)
+	return nil
+}
+
+// Committed — подтверждённые сообщения в порядке подтверждения.
+func (s *MemorySource) Committed() []kafka.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]kafka.Message(nil), s.committed...)
+}
+
+// Pending — сколько сообщений ещё не выдано.
+func (s *MemorySource) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queue)
+}
+
+// Close будит ждущих FetchMessage; дальше они получают ErrSourceClosed.
+func (s *MemorySource) Close() error {
+	s.closeOnce.Do(func() { close(s.closed) })
+	return nil
+}
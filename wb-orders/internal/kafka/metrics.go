@@ -0,0 +1,315 @@
+// internal/kafka/metrics.go
+package kafka
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"wb-orders/internal/dedup"
+)
+
+// Причины пропуска, помимо стадий DLQ (StageDecode, StageValidate, ...).
+const (
+	SkipAlreadyApplied = "already_applied"
+	SkipDuplicate      = "duplicate" // повтор уже применённого сообщения (dedup)
+)
+
+// latencyBuckets — верхние границы корзин гистограмм, секунды.
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// histogram — кумулятивная гистограмма в стиле Prometheus.
+type histogram struct {
+	counts []uint64 // по корзинам latencyBuckets, не кумулятивно
+	sum    float64
+	count  uint64
+}
+
+func newHistogram() *histogram {
+	return &histogram{counts: make([]uint64, len(latencyBuckets))}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	v := d.Seconds()
+	h.sum += v
+	h.count++
+	for i, le := range latencyBuckets {
+		if v <= le {
+			h.counts[i]++
+			return
+		}
+	}
+}
+
+// HistogramStats — снимок гистограммы для /debug/consumer.
+type HistogramStats struct {
+	Count   uint64            `json:"count"`
+	SumSec  float64           `json:"sum_seconds"`
+	Buckets map[string]uint64 `json:"buckets"` // "le" → кумулятивное количество
+}
+
+func (h *histogram) snapshot() HistogramStats {
+	out := HistogramStats{Count: h.count, SumSec: h.sum, Buckets: make(map[string]uint64, len(h.counts)+1)}
+	var cum uint64
+	for i, le := range latencyBuckets {
+		cum += h.counts[i]
+		out.Buckets[strconv.FormatFloat(le, 'g', -1, 64)] = cum
+	}
+	out.Buckets["+Inf"] = h.count
+	return out
+}
+
+// PartitionStats — прогресс по одной партиции.
+type PartitionStats struct {
+	Topic         string    `json:"topic"`
+	Partition     int       `json:"partition"`
+	LastOffset    int64     `json:"last_offset"`    // последний обработанный
+	LastProcessed time.Time `json:"last_processed"` // когда
+	HighWaterMark int64     `json:"high_water_mark"`
+	Lag           int64     `json:"lag"`
+}
+
+// metrics — собственные счётчики консьюмера.
+type metrics struct {
+	mu         sync.Mutex
+	consumed   uint64
+	stored     uint64
+	skipped    map[string]uint64
+	processing *histogram // от получения сообщения до записи в БД
+	endToEnd   *histogram // от времени сообщения в Kafka до записи в БД
+	partitions map[string]*PartitionStats
+
+	reader kafka.ReaderStats // накопленные Stats() ридера (он обнуляет счётчики при чтении)
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		skipped:    make(map[string]uint64),
+		processing: newHistogram(),
+		endToEnd:   newHistogram(),
+		partitions: make(map[string]*PartitionStats),
+	}
+}
+
+func (mt *metrics) partition(m kafka.Message) *PartitionStats {
+	k := trackKey(m)
+	p := mt.partitions[k]
+	if p == nil {
+		p = &PartitionStats{Topic: m.Topic, Partition: m.Partition, LastOffset: -1}
+		mt.partitions[k] = p
+	}
+	return p
+}
+
+func (mt *metrics) fetched(m kafka.Message) {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	mt.consumed++
+	p := mt.partition(m)
+	if m.HighWaterMark > p.HighWaterMark {
+		p.HighWaterMark = m.HighWaterMark
+	}
+	p.updateLag()
+}
+
+// done — сообщение обработано (сохранено или пропущено).
+func (mt *metrics) done(m kafka.Message) {
+	p := mt.partition(m)
+	if m.Offset > p.LastOffset {
+		p.LastOffset = m.Offset
+	}
+	p.LastProcessed = time.Now()
+	p.updateLag()
+}
+
+func (p *PartitionStats) updateLag() {
+	if p.HighWaterMark > 0 {
+		p.Lag = max(p.HighWaterMark-(p.LastOffset+1), 0)
+	}
+}
+
+func (mt *metrics) storedMsg(m kafka.Message, started time.Time) {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	mt.stored++
+	mt.processing.observe(time.Since(started))
+	if !m.Time.IsZero() {
+		mt.endToEnd.observe(time.Since(m.Time))
+	}
+	mt.done(m)
+}
+
+func (mt *metrics) skippedMsg(m kafka.Message, reason string) {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	mt.skipped[reason]++
+	mt.done(m)
+}
+
+// addReader добавляет к накопленным счётчикам приращение от Stats() ридера.
+func (mt *metrics) addReader(s kafka.ReaderStats) {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	r := &mt.reader
+	r.Dials += s.Dials
+	r.Fetches += s.Fetches
+	r.Messages += s.Messages
+	r.Bytes += s.Bytes
+	r.Rebalances += s.Rebalances
+	r.Timeouts += s.Timeouts
+	r.Errors += s.Errors
+	r.Lag = s.Lag
+	r.Offset = s.Offset
+	r.QueueLength = s.QueueLength
+	r.QueueCapacity = s.QueueCapacity
+	r.ClientID, r.Topic = s.ClientID, s.Topic
+}
+
+// ConsumerStats — ответ /debug/consumer.
+type ConsumerStats struct {
+	State        PauseState        `json:"state"`
+	Backpressure BackpressureState `json:"backpressure"`
+	Dedup        dedup.Stats       `json:"dedup"`
+	Consumed     uint64            `json:"consumed"`
+	Stored       uint64            `json:"stored"`
+	Skipped      map[string]uint64 `json:"skipped"`
+	Processing   HistogramStats    `json:"processing_latency"`
+	EndToEnd     HistogramStats    `json:"end_to_end_latency"`
+	Partitions   []PartitionStats  `json:"partitions"`
+	Reader       *ReaderTotals     `json:"reader,omitempty"`
+}
+
+// ReaderTotals — накопленные счётчики kafka.Reader.
+type ReaderTotals struct {
+	Dials      int64 `json:"dials"`
+	Fetches    int64 `json:"fetches"`
+	Messages   int64 `json:"messages"`
+	Bytes      int64 `json:"bytes"`
+	Rebalances int64 `json:"rebalances"`
+	Timeouts   int64 `json:"timeouts"`
+	Errors     int64 `json:"errors"`
+	Lag        int64 `json:"lag"`
+	QueueLen   int64 `json:"queue_length"`
+	QueueCap   int64 `json:"queue_capacity"`
+}
+
+func (mt *metrics) snapshot(withReader bool) ConsumerStats {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+
+	out := ConsumerStats{
+		Consumed:   mt.consumed,
+		Stored:     mt.stored,
+		Skipped:    make(map[string]uint64, len(mt.skipped)),
+		Processing: mt.processing.snapshot(),
+		EndToEnd:   mt.endToEnd.snapshot(),
+		Partitions: make([]PartitionStats, 0, len(mt.partitions)),
+	}
+	for k, v := range mt.skipped {
+		out.Skipped[k] = v
+	}
+	for _, p := range mt.partitions {
+		out.Partitions = append(out.Partitions, *p)
+	}
+	sort.Slice(out.Partitions, func(i, j int) bool {
+		a, b := out.Partitions[i], out.Partitions[j]
+		if a.Topic != b.Topic {
+			return a.Topic < b.Topic
+		}
+		return a.Partition < b.Partition
+	})
+	if withReader {
+		r := mt.reader
+		out.Reader = &ReaderTotals{
+			Dials: r.Dials, Fetches: r.Fetches, Messages: r.Messages, Bytes: r.Bytes,
+			Rebalances: r.Rebalances, Timeouts: r.Timeouts, Errors: r.Errors,
+			Lag: r.Lag, QueueLen: r.QueueLength, QueueCap: r.QueueCapacity,
+		}
+	}
+	return out
+}
+
+// -------------------- Prometheus --------------------
+
+// WritePrometheus пишет метрики в текстовом формате Prometheus (для /metrics).
+func (s ConsumerStats) WritePrometheus(w io.Writer) {
+	counter := func(name, help string, v uint64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, v)
+	}
+
+	paused := 0
+	if s.State.State == "paused" {
+		paused = 1
+	}
+	fmt.Fprintf(w, "# HELP wb_orders_consumer_paused Whether consumption is paused.\n# TYPE wb_orders_consumer_paused gauge\nwb_orders_consumer_paused %d\n", paused)
+
+	bpState := map[string]int{BackpressureThrottled: 1, BackpressurePaused: 2}[s.Backpressure.State]
+	fmt.Fprintf(w, "# HELP wb_orders_consumer_backpressure_state Backpressure: 0 off or running, 1 throttled, 2 paused.\n# TYPE wb_orders_consumer_backpressure_state gauge\nwb_orders_consumer_backpressure_state %d\n", bpState)
+	fmt.Fprintf(w, "# HELP wb_orders_consumer_backpressure_delay_seconds Delay before each fetch.\n# TYPE wb_orders_consumer_backpressure_delay_seconds gauge\nwb_orders_consumer_backpressure_delay_seconds %g\n", float64(s.Backpressure.DelayMs)/1000)
+
+	counter("wb_orders_consumer_messages_consumed_total", "Messages fetched from Kafka.", s.Consumed)
+	counter("wb_orders_consumer_messages_stored_total", "Orders written to Postgres.", s.Stored)
+
+	fmt.Fprintf(w, "# HELP wb_orders_consumer_messages_skipped_total Messages skipped, by reason.\n")
+	fmt.Fprintf(w, "# TYPE wb_orders_consumer_messages_skipped_total counter\n")
+	reasons := make([]string, 0, len(s.Skipped))
+	for r := range s.Skipped {
+		reasons = append(reasons, r)
+	}
+	sort.Strings(reasons)
+	for _, r := range reasons {
+		fmt.Fprintf(w, "wb_orders_consumer_messages_skipped_total{reason=%q} %d\n", r, s.Skipped[r])
+	}
+
+	writeHistogram(w, "wb_orders_consumer_processing_seconds",
+		"Time from fetch to successful store.", s.Processing)
+	writeHistogram(w, "wb_orders_consumer_end_to_end_seconds",
+		"Time from Kafka message timestamp to successful store.", s.EndToEnd)
+
+	gauges := []struct {
+		name, help string
+		value      func(p PartitionStats) string
+	}{
+		{"wb_orders_consumer_lag", "Messages behind the high water mark.",
+			func(p PartitionStats) string { return strconv.FormatInt(p.Lag, 10) }},
+		{"wb_orders_consumer_last_offset", "Last processed offset.",
+			func(p PartitionStats) string { return strconv.FormatInt(p.LastOffset, 10) }},
+		{"wb_orders_consumer_last_processed_timestamp_seconds", "Unix time of the last processed message.",
+			func(p PartitionStats) string {
+				if p.LastProcessed.IsZero() {
+					return "0"
+				}
+				return strconv.FormatFloat(float64(p.LastProcessed.UnixNano())/1e9, 'f', 3, 64)
+			}},
+	}
+	for _, g := range gauges {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+		for _, p := range s.Partitions {
+			fmt.Fprintf(w, "%s{topic=%q,partition=\"%d\"} %s\n", g.name, p.Topic, p.Partition, g.value(p))
+		}
+	}
+
+	if r := s.Reader; r != nil {
+		fmt.Fprintf(w, "# HELP wb_orders_kafka_reader_lag Lag reported by kafka.Reader.\n")
+		fmt.Fprintf(w, "# TYPE wb_orders_kafka_reader_lag gauge\nwb_orders_kafka_reader_lag %d\n", r.Lag)
+		counter("wb_orders_kafka_reader_fetches_total", "Fetch requests made by kafka.Reader.", uint64(r.Fetches))
+		counter("wb_orders_kafka_reader_bytes_total", "Bytes read by kafka.Reader.", uint64(r.Bytes))
+		counter("wb_orders_kafka_reader_errors_total", "Errors seen by kafka.Reader.", uint64(r.Errors))
+		counter("wb_orders_kafka_reader_rebalances_total", "Consumer group rebalances.", uint64(r.Rebalances))
+	}
+}
+
+func writeHistogram(w io.Writer, name, help string, h HistogramStats) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for _, le := range latencyBuckets {
+		k := strconv.FormatFloat(le, 'g', -1, 64)
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", name, k, h.Buckets[k])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.Count)
+	fmt.Fprintf(w, "%s_sum %g\n%s_count %d\n", name, h.SumSec, name, h.Count)
+}
@@ -0,0 +1,199 @@
+// internal/kafka/offsets.go
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// errPartitionFailed — ридер одной из партиций dbOffsetReader остановился
+// с ошибкой. Партиция без ридера до конца поколения не читалась бы,
+// поэтому Supervisor пересобирает консьюмер целиком.
+var errPartitionFailed = errors.New("partition reader failed")
+
+// offsetLoader — откуда dbOffsetReader берёт сохранённые офсеты (storage.Repo).
+type offsetLoader interface {
+	StoredOffsets(ctx context.Context, group, topic string) (map[int]int64, error)
+}
+
+// dbOffsetReader — reader поверх kafka.ConsumerGroup, у которого источник
+// правды по офсетам — Postgres. При каждом назначении партиций читаем
+// офсеты из consumer_offsets и начинаем с них; офсет группы в Kafka
+// используется, только если в БД по партиции ничего нет. Коммит в Kafka
+// делается тоже, но лишь для наглядности лага — на чтение он не влияет.
+type dbOffsetReader struct {
+	cfg     Config
+	dialer  *kafka.Dialer
+	group   *kafka.ConsumerGroup
+	offsets offsetLoader
+
+	msgs   chan kafka.Message
+	errc   chan error
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu  sync.Mutex
+	gen *kafka.Generation
+}
+
+func newDBOffsetReader(cfg Config, dialer *kafka.Dialer, offsets offsetLoader) (*dbOffsetReader, error) {
+	group, err := kafka.NewConsumerGroup(kafka.ConsumerGroupConfig{
+		ID:                cfg.GroupID,
+		Brokers:           cfg.Brokers,
+		Dialer:            dialer,
+		Topics:            cfg.Topics,
+		StartOffset:       cfg.startOffset(),
+		SessionTimeout:    cfg.SessionTimeout,
+		HeartbeatInterval: cfg.HeartbeatInterval,
+		RebalanceTimeout:  cfg.RebalanceTimeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("consumer group: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &dbOffsetReader{
+		cfg:     cfg,
+		dialer:  dialer,
+		group:   group,
+		offsets: offsets,
+		msgs:    make(chan kafka.Message),
+		errc:    make(chan error, 1),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	go r.loop(ctx)
+	return r, nil
+}
+
+// loop — по поколению группы за раз: при ребалансе Next вернёт новое
+// поколение, а горутины партиций старого остановятся сами.
+func (r *dbOffsetReader) loop(ctx context.Context) {
+	defer close(r.done)
+	for {
+		gen, err := r.group.Next(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				r.fail(fmt.Errorf("next generation: %w", err))
+			}
+			return
+		}
+		r.mu.Lock()
+		r.gen = gen
+		r.mu.Unlock()
+
+		for topic, assigned := range gen.Assignments {
+			stored, err := r.offsets.StoredOffsets(ctx, r.cfg.GroupID, topic)
+			if err != nil {
+				if ctx.Err() == nil {
+					r.fail(fmt.Errorf("load offsets %s: %w", topic, err))
+				}
+				return
+			}
+
+			for _, pa := range assigned {
+				start, from := pa.Offset, "kafka"
+				if next, ok := stored[pa.ID]; ok {
+					start, from = next, "postgres"
+				}
+				log.Printf("[kafka] assigned topic=%s partition=%d start=%d (from %s) generation=%d",
+					topic, pa.ID, start, from, gen.ID)
+
+				topic, partition := topic, pa.ID
+				gen.Start(func(gctx context.Context) {
+					r.readPartition(gctx, topic, partition, start)
+				})
+			}
+		}
+	}
+}
+
+func (r *dbOffsetReader) readPartition(ctx context.Context, topic string, partition int, start int64) {
+	pr := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   r.cfg.Brokers,
+		Dialer:    r.dialer,
+		Topic:     topic,
+		Partition: partition,
+		MinBytes:  r.cfg.MinBytes,
+		MaxBytes:  r.cfg.MaxBytes,
+		MaxWait:   r.cfg.MaxWait,
+	})
+	defer pr.Close()
+
+	if err := pr.SetOffset(start); err != nil {
+		r.fail(fmt.Errorf("%w: %s/%d set offset %d: %w", errPartitionFailed, topic, partition, start, err))
+		return
+	}
+	for {
+		m, err := pr.ReadMessage(ctx) // без GroupID — ничего не коммитит
+		if err != nil {
+			if ctx.Err() == nil {
+				r.fail(fmt.Errorf("%w: %s/%d read: %w", errPartitionFailed, topic, partition, err))
+			}
+			return
+		}
+		select {
+		case r.msgs <- m:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// fail отдаёт ошибку в FetchMessage. Хватает первой: после неё консьюмер
+// останавливается, и остальные уже никто не прочитает.
+func (r *dbOffsetReader) fail(err error) {
+	select {
+	case r.errc <- err:
+	default:
+		log.Printf("[kafka] %v", err)
+	}
+}
+
+func (r *dbOffsetReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	select {
+	case m := <-r.msgs:
+		return m, nil
+	case err := <-r.errc:
+		return kafka.Message{}, err
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	}
+}
+
+// CommitMessages дублирует офсеты в Kafka. Ошибка (например, поколение уже
+// сменилось) только логируется: офсет к этому моменту уже лежит в Postgres.
+func (r *dbOffsetReader) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	r.mu.Lock()
+	gen := r.gen
+	r.mu.Unlock()
+	if gen == nil || len(msgs) == 0 {
+		return nil
+	}
+
+	offsets := make(map[string]map[int]int64)
+	for _, m := range msgs {
+		if offsets[m.Topic] == nil {
+			offsets[m.Topic] = make(map[int]int64)
+		}
+		if next := m.Offset + 1; next > offsets[m.Topic][m.Partition] {
+			offsets[m.Topic][m.Partition] = next
+		}
+	}
+	if err := gen.CommitOffsets(offsets); err != nil {
+		log.Printf("[kafka] commit to group (informational): %v", err)
+	}
+	return nil
+}
+
+func (r *dbOffsetReader) Close() error {
+	r.cancel()
+	err := r.group.Close()
+	<-r.done
+	return err
+}
@@ -0,0 +1,20 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestDBOffsetReaderPropagatesPartitionFailure(t *testing.T) {
+	r := &dbOffsetReader{msgs: make(chan kafka.Message), errc: make(chan error, 1)}
+	first := errors.New("first")
+	r.fail(first)
+	r.fail(errors.New("second")) // буфер занят — не блокируется
+
+	if _, err := r.FetchMessage(context.Background()); !errors.Is(err, first) {
+		t.Errorf("FetchMessage = %v, want the first failure", err)
+	}
+}
@@ -0,0 +1,92 @@
+// internal/kafka/output.go
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"wb-orders/internal/ingest"
+)
+
+// Заголовки, которые Output добавляет к обогащённому заказу: откуда
+// пришёл исходник (для HTTP — topic "http", offset — строка пакета).
+const (
+	HeaderSourceTopic     = "source-topic"
+	HeaderSourcePartition = "source-partition"
+	HeaderSourceOffset    = "source-offset"
+)
+
+// Output — выходной топик с обогащёнными заказами (KAFKA_TOPIC_OUTPUT),
+// ключ — order_uid. Реализует pipeline.Publisher.
+type Output struct {
+	w     *kafka.Writer
+	retry RetryPolicy // задержки между попытками записи
+}
+
+// NewOutput возвращает nil, если топик не задан: тогда звено publish
+// в цепочку не ставится.
+func NewOutput(cfg Config) (*Output, error) {
+	if cfg.OutputTopic == "" {
+		return nil, nil
+	}
+	transport, err := cfg.Transport()
+	if err != nil {
+		return nil, fmt.Errorf("kafka transport: %w", err)
+	}
+	return &Output{w: &kafka.Writer{
+		Addr:         kafka.TCP(cfg.Brokers...),
+		Transport:    transport,
+		Topic:        cfg.OutputTopic,
+		Balancer:     &kafka.Hash{}, // обновления заказа — в одну партицию, по порядку
+		RequiredAcks: kafka.RequireAll,
+		// запись синхронная, по заказу за раз: не ждём добора пакета
+		BatchTimeout:           5 * time.Millisecond,
+		AllowAutoTopicCreation: true,
+	}, retry: DefaultRetry}, nil
+}
+
+func (o *Output) Topic() string { return o.w.Topic }
+
+// Publish пишет заказ и ждёт подтверждения всех реплик. Неудачная запись
+// повторяется с задержкой по retry, пока не пройдёт или не отменят ctx:
+// заказ в БД уже записан, сдаться — значит потерять его для получателей,
+// а вернуть ошибку — остановить приём. Недоступный выходной топик
+// тормозит чтение, как недоступная БД на автопаузе.
+func (o *Output) Publish(ctx context.Context, key string, value []byte, meta ingest.Meta) error {
+	headers := []kafka.Header{
+		{Key: HeaderContentType, Value: []byte("application/json")},
+		{Key: HeaderProducer, Value: []byte("wb-orders")},
+		{Key: HeaderSourceTopic, Value: []byte(meta.Topic)},
+		{Key: HeaderSourcePartition, Value: []byte(strconv.Itoa(meta.Partition))},
+		{Key: HeaderSourceOffset, Value: []byte(strconv.FormatInt(meta.Offset, 10))},
+	}
+	if meta.TraceID != "" {
+		headers = append(headers, kafka.Header{Key: HeaderTraceID, Value: []byte(meta.TraceID)})
+	}
+	msg := kafka.Message{Key: []byte(key), Value: value, Headers: headers}
+	for attempt := 1; ; attempt++ {
+		err := o.w.WriteMessages(ctx, msg)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("output write: %w", ctx.Err())
+		}
+		wait := o.retry.delay(attempt)
+		log.Printf("[kafka] output retry id=%s attempt=%d in %v: %v", key, attempt, wait, err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return fmt.Errorf("output write: %w", ctx.Err())
+		}
+	}
+}
+
+func (o *Output) Close() error {
+	return o.w.Close()
+}
@@ -0,0 +1,38 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"wb-orders/internal/ingest"
+)
+
+// Недоступный брокер — не ошибка приёма: Publish повторяет запись, пока
+// её не отменят.
+func TestOutputRetriesUntilCanceled(t *testing.T) {
+	o := &Output{
+		w: &kafka.Writer{
+			Addr:         kafka.TCP("127.0.0.1:1"), // никто не слушает
+			Topic:        "orders-enriched",
+			BatchTimeout: time.Millisecond,
+			MaxAttempts:  1,
+		},
+		retry: RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond},
+	}
+	defer o.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := o.Publish(ctx, "o1", []byte(`{}`), ingest.Meta{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want deadline exceeded", err)
+	}
+	if time.Since(start) < 90*time.Millisecond {
+		t.Fatalf("gave up after %v, before the context ended", time.Since(start))
+	}
+}
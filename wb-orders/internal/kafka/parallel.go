@@ -0,0 +1,232 @@
+// internal/kafka/parallel.go
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// workerQueue — сколько сообщений может ждать своей очереди у одного воркера.
+// Когда очередь полна, чтение из Kafka останавливается.
+const workerQueue = 16
+
+// tracked — сообщение и поколение его партиции в offsetTracker.
+type tracked struct {
+	m   kafka.Message
+	gen int
+}
+
+type result struct {
+	tracked
+	err error
+}
+
+// runParallel обрабатывает сообщения пулом из c.workers воркеров.
+//
+// Порядок: сообщения одного order_uid всегда попадают к одному воркеру
+// (хэш ключа), поэтому применяются в порядке чтения. Коммит: офсет
+// партиции сдвигается только по непрерывному префиксу обработанных
+// сообщений — если 10 ещё в работе, а 11 и 12 готовы, коммита не будет,
+// пока не закончится 10.
+//
+// Остановка (отмена parent): чтение прекращается, сообщения из очередей
+// воркеров не берутся (придут снова), текущие дообрабатываются в work.
+func (c *Consumer) runParallel(parent, work context.Context) error {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+	work, cancelWork := context.WithCancel(work)
+	defer cancelWork()
+
+	inputs := make([]chan tracked, c.workers)
+	results := make(chan result, c.workers)
+	var wg sync.WaitGroup
+	for i := range inputs {
+		inputs[i] = make(chan tracked, workerQueue)
+		wg.Add(1)
+		go func(in <-chan tracked) {
+			defer wg.Done()
+			for t := range in {
+				if ctx.Err() != nil {
+					continue // останавливаемся: сообщение не коммитится и придёт снова
+				}
+				results <- result{tracked: t, err: c.handle(work, t.m)}
+			}
+		}(inputs[i])
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	tracker := newOffsetTracker()
+	fetchErr := make(chan error, 1)
+	go func() {
+		defer func() {
+			for _, in := range inputs {
+				close(in)
+			}
+		}()
+		for {
+			if err := c.gate.wait(ctx); err != nil {
+				return
+			}
+			if err := c.bp.wait(ctx); err != nil {
+				return
+			}
+			m, err := c.source.FetchMessage(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					fetchErr <- fmt.Errorf("fetch message: %w", err)
+					cancel()
+				}
+				return
+			}
+			c.metrics.fetched(m)
+			select {
+			case inputs[c.route(m)] <- tracked{m: m, gen: tracker.add(m)}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var runErr error
+	for res := range results {
+		if runErr != nil {
+			continue // дочитываем результаты, пока воркеры не остановятся
+		}
+		if res.err != nil {
+			runErr = res.err
+			cancel()
+			cancelWork()
+			continue
+		}
+		if upto, ok := tracker.complete(res.m, res.gen); ok {
+			if err := c.source.CommitMessages(work, upto); err != nil {
+				runErr = fmt.Errorf("commit offset=%d: %w", upto.Offset, err)
+				cancel()
+				cancelWork()
+			}
+		}
+	}
+
+	select {
+	case err := <-fetchErr:
+		if runErr == nil {
+			runErr = err
+		}
+	default:
+	}
+	if parent.Err() != nil {
+		// нормальное завершение по отмене контекста
+		return nil
+	}
+	return runErr
+}
+
+// route выбирает воркера. Обычно — по ключу заказа; при офсетах в Postgres —
+// по партиции: там офсет партиции должен расти строго по порядку,
+// иначе claimOffset примет более ранние сообщения за уже применённые.
+func (c *Consumer) route(m kafka.Message) int {
+	h := fnv.New32a()
+	if c.group != "" {
+		fmt.Fprintf(h, "%s/%d", m.Topic, m.Partition)
+	} else {
+		_, _ = h.Write(orderKey(m))
+	}
+	return int(h.Sum32() % uint32(c.workers))
+}
+
+// orderKey — ключ сообщения (продюсер кладёт туда order_uid),
+// а если его нет — order_uid из тела.
+func orderKey(m kafka.Message) []byte {
+	if len(m.Key) > 0 {
+		return m.Key
+	}
+	var probe struct {
+		OrderUID string `json:"order_uid"`
+	}
+	_ = json.Unmarshal(m.Value, &probe)
+	return []byte(probe.OrderUID)
+}
+
+// offsetTracker следит за сообщениями в работе по каждой партиции.
+//
+// Партиция может начаться заново: после ребаланса (новое поколение
+// группы) или переподключения reader снова отдаёт сообщения с
+// закоммиченного офсета. Офсет не больше уже прочитанного — признак
+// такого повтора: трекер партиции сбрасывается и начинает новое
+// поколение, а итоги сообщений прошлого поколения (их офсеты либо уже
+// закоммичены, либо придут снова) не учитываются.
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[string]*partitionTrack
+}
+
+type partitionTrack struct {
+	gen     int
+	last    int64                   // последний прочитанный офсет
+	pending []int64                 // офсеты в порядке чтения
+	done    map[int64]kafka.Message // обработанные, но ещё не закоммиченные
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{partitions: make(map[string]*partitionTrack)}
+}
+
+func trackKey(m kafka.Message) string {
+	return fmt.Sprintf("%s/%d", m.Topic, m.Partition)
+}
+
+// add ставит сообщение в работу и возвращает поколение партиции —
+// его надо передать в complete.
+func (t *offsetTracker) add(m kafka.Message) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	k := trackKey(m)
+	p := t.partitions[k]
+	if p == nil || m.Offset <= p.last {
+		gen := 0
+		if p != nil {
+			gen = p.gen + 1 // повтор с более раннего офсета
+		}
+		p = &partitionTrack{gen: gen, done: make(map[int64]kafka.Message)}
+		t.partitions[k] = p
+	}
+	p.last = m.Offset
+	p.pending = append(p.pending, m.Offset)
+	return p.gen
+}
+
+// complete отмечает сообщение обработанным и возвращает последнее сообщение
+// непрерывного обработанного префикса партиции — его и надо коммитить.
+// Сообщение прошлого поколения не учитывается.
+func (t *offsetTracker) complete(m kafka.Message, gen int) (kafka.Message, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p := t.partitions[trackKey(m)]
+	if p == nil || p.gen != gen {
+		return kafka.Message{}, false
+	}
+	p.done[m.Offset] = m
+
+	var (
+		upto kafka.Message
+		ok   bool
+	)
+	for len(p.pending) > 0 {
+		head, isDone := p.done[p.pending[0]]
+		if !isDone {
+			break
+		}
+		delete(p.done, p.pending[0])
+		p.pending = p.pending[1:]
+		upto, ok = head, true
+	}
+	return upto, ok
+}
@@ -0,0 +1,158 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func msgAt(partition int, offset int64) kafka.Message {
+	return kafka.Message{Topic: "orders", Partition: partition, Offset: offset}
+}
+
+// step — add или complete; want — какой офсет коммитить после complete (-1 — никакой).
+type step struct {
+	add      bool
+	m        kafka.Message
+	gen      int
+	wantGen  int
+	wantUpto int64
+}
+
+func runSteps(t *testing.T, steps []step) {
+	t.Helper()
+	tr := newOffsetTracker()
+	for i, s := range steps {
+		if s.add {
+			if gen := tr.add(s.m); gen != s.wantGen {
+				t.Fatalf("step %d: add(%d/%d) gen = %d, want %d", i, s.m.Partition, s.m.Offset, gen, s.wantGen)
+			}
+			continue
+		}
+		upto, ok := tr.complete(s.m, s.gen)
+		switch {
+		case s.wantUpto < 0 && ok:
+			t.Fatalf("step %d: complete(%d/%d) committed %d, want nothing", i, s.m.Partition, s.m.Offset, upto.Offset)
+		case s.wantUpto >= 0 && (!ok || upto.Offset != s.wantUpto):
+			t.Fatalf("step %d: complete(%d/%d) = %d %v, want %d", i, s.m.Partition, s.m.Offset, upto.Offset, ok, s.wantUpto)
+		}
+	}
+}
+
+func add(p int, off int64, gen int) step { return step{add: true, m: msgAt(p, off), wantGen: gen} }
+
+func done(p int, off int64, gen int, upto int64) step {
+	return step{m: msgAt(p, off), gen: gen, wantUpto: upto}
+}
+
+func TestOffsetTracker(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		steps []step
+	}{
+		{"in order", []step{
+			add(0, 10, 0), add(0, 11, 0),
+			done(0, 10, 0, 10), done(0, 11, 0, 11),
+		}},
+		{"head still in flight", []step{
+			add(0, 10, 0), add(0, 11, 0), add(0, 12, 0),
+			done(0, 11, 0, -1), done(0, 12, 0, -1),
+			done(0, 10, 0, 12), // префикс догнал — коммит сразу до 12
+		}},
+		{"gap in the middle", []step{
+			add(0, 10, 0), add(0, 11, 0), add(0, 12, 0),
+			done(0, 10, 0, 10), done(0, 12, 0, -1), done(0, 11, 0, 12),
+		}},
+		{"offsets with holes (compaction)", []step{
+			add(0, 10, 0), add(0, 15, 0), add(0, 30, 0),
+			done(0, 15, 0, -1), done(0, 30, 0, -1), done(0, 10, 0, 30),
+		}},
+		{"partitions are independent", []step{
+			add(0, 10, 0), add(1, 5, 0), add(0, 11, 0), add(1, 6, 0),
+			done(1, 6, 0, -1), done(0, 10, 0, 10), done(1, 5, 0, 6), done(0, 11, 0, 11),
+		}},
+		{"unknown partition", []step{
+			done(3, 1, 0, -1),
+		}},
+		{"redelivery starts a new generation", []step{
+			add(0, 10, 0), add(0, 11, 0), add(0, 12, 0),
+			done(0, 10, 0, 10),
+			// ребаланс: reader снова отдаёт с закоммиченного 11
+			add(0, 11, 1), add(0, 12, 1),
+			done(0, 11, 0, -1), // итог старого поколения не учитывается
+			done(0, 12, 0, -1),
+			done(0, 12, 1, -1),
+			done(0, 11, 1, 12),
+		}},
+		{"redelivery of the same offset", []step{
+			add(0, 10, 0), add(0, 10, 1),
+			done(0, 10, 0, -1), done(0, 10, 1, 10),
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) { runSteps(t, tc.steps) })
+	}
+}
+
+func TestRoute(t *testing.T) {
+	c := &Consumer{workers: 4}
+	byKey := kafka.Message{Partition: 0, Key: []byte("o1")}
+	byBody := kafka.Message{Partition: 3, Value: []byte(`{"order_uid": "o1"}`)}
+	if c.route(byKey) != c.route(byBody) {
+		t.Error("same order_uid (key vs body) routed to different workers")
+	}
+	seen := make(map[int]bool)
+	for _, k := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		w := c.route(kafka.Message{Key: []byte(k)})
+		if w < 0 || w >= c.workers {
+			t.Fatalf("route = %d, out of range", w)
+		}
+		seen[w] = true
+	}
+	if len(seen) < 2 {
+		t.Error("all keys routed to one worker")
+	}
+
+	// офсеты в Postgres — по партиции, а не по ключу
+	c.group = "g"
+	a := kafka.Message{Topic: "orders", Partition: 1, Key: []byte("o1")}
+	b := kafka.Message{Topic: "orders", Partition: 1, Key: []byte("o2")}
+	if c.route(a) != c.route(b) {
+		t.Error("same partition routed to different workers in postgres offset mode")
+	}
+}
+
+// Параллельный режим коммитит только непрерывный префикс: все офсеты
+// в итоге закоммичены, и никогда не раньше обработанных предшественников.
+func TestParallelCommitsContiguousPrefix(t *testing.T) {
+	var msgs []kafka.Message
+	for i := 0; i < 20; i++ {
+		msgs = append(msgs, kafka.Message{
+			Topic: "orders", Offset: int64(i),
+			Key: []byte{byte('a' + i%5)}, Value: orderWithUID(string(rune('a' + i%5))),
+		})
+	}
+	r := &fakeReader{msgs: msgs}
+	s := &flakyStore{}
+	c := newTestConsumer(r, s)
+	c.workers = 4
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if err := c.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	commits := r.commits()
+	if len(commits) == 0 || commits[len(commits)-1] != 19 {
+		t.Fatalf("commits = %v, want last 19", commits)
+	}
+	for i := 1; i < len(commits); i++ {
+		if commits[i] <= commits[i-1] {
+			t.Fatalf("commits not increasing: %v", commits)
+		}
+	}
+	if s.calls != 20 {
+		t.Errorf("store calls = %d, want 20", s.calls)
+	}
+}
@@ -0,0 +1,149 @@
+// internal/kafka/pause.go
+package kafka
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Почему консьюмер стоит на паузе.
+const (
+	PauseManual        = "manual"         // POST /admin/consumer/pause
+	PauseDBUnavailable = "db_unavailable" // автопауза: БД не отвечает дольше политики повторов
+)
+
+// Как часто автопауза проверяет, вернулась ли БД.
+const dbProbeInterval = 5 * time.Second
+
+// PauseState — состояние для /debug/consumer.
+type PauseState struct {
+	State  string     `json:"state"` // running | paused
+	Reason string     `json:"reason,omitempty"`
+	Since  *time.Time `json:"since,omitempty"`
+}
+
+// pauseGate — «шлагбаум» перед чтением: на паузе консьюмер не берёт новые
+// сообщения, но ридер остаётся в группе (kafka-go шлёт heartbeat'ы сам),
+// поэтому ребаланса нет. Живёт в Supervisor и переживает перезапуски.
+type pauseGate struct {
+	mu     sync.Mutex
+	reason string // "" — не на паузе
+	since  time.Time
+	resume chan struct{} // закрывается при снятии паузы
+}
+
+func newPauseGate() *pauseGate {
+	return &pauseGate{}
+}
+
+// Pause ставит паузу. true — пауза только что началась. Ручная пауза
+// поверх автопаузы делает её ручной; наоборот — нет.
+func (g *pauseGate) Pause(reason string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.reason != "" {
+		if reason == PauseManual {
+			g.reason = reason
+		}
+		return false
+	}
+	g.reason, g.since = reason, time.Now()
+	g.resume = make(chan struct{})
+	return true
+}
+
+// Resume снимает паузу. false — паузы не было.
+func (g *pauseGate) Resume() bool {
+	return g.resumeIf("")
+}
+
+// resumeIf снимает паузу, только если она стоит по этой причине
+// ("" — по любой): ручную паузу автоматика не снимает.
+func (g *pauseGate) resumeIf(reason string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.reason == "" || (reason != "" && g.reason != reason) {
+		return false
+	}
+	g.reason = ""
+	close(g.resume)
+	return true
+}
+
+// wait блокируется, пока стоит пауза. nil-шлагбаум не задерживает никогда.
+func (g *pauseGate) wait(ctx context.Context) error {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	paused, resume := g.reason != "", g.resume
+	g.mu.Unlock()
+	if !paused {
+		return nil
+	}
+	select {
+	case <-resume:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (g *pauseGate) reasonIs(reason string) bool {
+	if g == nil {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.reason == reason
+}
+
+func (g *pauseGate) state() PauseState {
+	if g == nil {
+		return PauseState{State: "running"}
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.reason == "" {
+		return PauseState{State: "running"}
+	}
+	since := g.since
+	return PauseState{State: "paused", Reason: g.reason, Since: &since}
+}
+
+// pauseForDB — автопауза: БД не приняла запись после всех повторов.
+// Первый, кто её поставил, запускает проверку БД; ждут все.
+func (c *Consumer) pauseForDB(ctx context.Context, cause error) error {
+	if c.gate.Pause(PauseDBUnavailable) {
+		log.Printf("[kafka] auto-pause: db unavailable: %v", cause)
+		go c.probeDB(ctx)
+	}
+	return c.gate.wait(ctx)
+}
+
+// probeDB пингует БД, пока она не ответит, и снимает автопаузу.
+func (c *Consumer) probeDB(ctx context.Context) {
+	t := time.NewTicker(dbProbeInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+		if !c.gate.reasonIs(PauseDBUnavailable) {
+			return // паузу сняли руками или сделали ручной
+		}
+		pctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+		err := c.repo.Ping(pctx)
+		cancel()
+		if err == nil {
+			if c.gate.resumeIf(PauseDBUnavailable) {
+				log.Printf("[kafka] auto-resume: db is back")
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,191 @@
+// internal/kafka/replay.go
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// ErrBadReplay — запрос replay составлен неверно (ошибка клиента).
+var ErrBadReplay = errors.New("bad replay request")
+
+// ReplayRequest — куда откатить офсеты группы. Задаётся ровно одно из
+// Time, Since и Offsets.
+type ReplayRequest struct {
+	// Topic — пусто: все топики консьюмера (для Offsets — единственный).
+	Topic string `json:"topic"`
+	// Time — первый офсет с временем сообщения не раньше этого момента.
+	Time time.Time `json:"time"`
+	// Since — то же, но относительно текущего момента: "24h".
+	Since string `json:"since"`
+	// Offsets — явные офсеты: партиция → следующий к чтению офсет.
+	// Партиции, которых нет в карте, не трогаются.
+	Offsets map[int]int64 `json:"offsets"`
+	// DryRun — только посчитать, ничего не менять.
+	DryRun bool `json:"dry_run"`
+}
+
+// PartitionReplay — что произойдёт с одной партицией.
+type PartitionReplay struct {
+	Partition int `json:"partition"`
+	// Current — следующий к чтению офсет до сброса; -1 — офсета у группы нет.
+	Current int64 `json:"current"`
+	Target  int64 `json:"target"`
+	// Replay — сколько уже обработанных сообщений придут повторно.
+	Replay int64 `json:"replay"`
+	// Pending — сколько всего сообщений будет к чтению после сброса.
+	Pending int64 `json:"pending"`
+}
+
+type TopicReplay struct {
+	Topic      string            `json:"topic"`
+	Partitions []PartitionReplay `json:"partitions"`
+	Replay     int64             `json:"replay"`
+	Pending    int64             `json:"pending"`
+}
+
+type ReplayPlan struct {
+	Topics  []TopicReplay `json:"topics"`
+	Replay  int64         `json:"replay"`
+	Pending int64         `json:"pending"`
+	DryRun  bool          `json:"dry_run"`
+	Applied bool          `json:"applied"`
+}
+
+// resolve проверяет запрос и возвращает топики и момент времени (нулевой,
+// если заданы явные офсеты).
+func (r ReplayRequest) resolve(topics []string, now time.Time) ([]string, time.Time, error) {
+	set := 0
+	for _, ok := range []bool{!r.Time.IsZero(), r.Since != "", r.Offsets != nil} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, time.Time{}, fmt.Errorf("%w: exactly one of time, since, offsets is required", ErrBadReplay)
+	}
+
+	if r.Topic != "" {
+		if !slices.Contains(topics, r.Topic) {
+			return nil, time.Time{}, fmt.Errorf("%w: topic %s is not consumed", ErrBadReplay, r.Topic)
+		}
+		topics = []string{r.Topic}
+	}
+	if r.Offsets != nil && len(topics) != 1 {
+		return nil, time.Time{}, fmt.Errorf("%w: offsets need a topic", ErrBadReplay)
+	}
+
+	at := r.Time
+	if r.Since != "" {
+		d, err := time.ParseDuration(r.Since)
+		if err != nil || d <= 0 {
+			return nil, time.Time{}, fmt.Errorf("%w: since %q", ErrBadReplay, r.Since)
+		}
+		at = now.Add(-d)
+	}
+	if at.After(now) {
+		return nil, time.Time{}, fmt.Errorf("%w: time %s is in the future", ErrBadReplay, at.Format(time.RFC3339))
+	}
+	return topics, at, nil
+}
+
+// planTopic считает целевые офсеты партиций топика и объём повтора.
+// current — следующие к чтению офсеты группы сейчас.
+func (a *Admin) planTopic(ctx context.Context, topic string, at time.Time, offsets, current map[int]int64) (TopicReplay, error) {
+	bounds, err := a.Bounds(ctx, topic, at)
+	if err != nil {
+		return TopicReplay{}, err
+	}
+	return planPartitions(topic, bounds, offsets, current)
+}
+
+// planPartitions — planTopic по уже известным границам партиций.
+func planPartitions(topic string, bounds map[int]PartitionBounds, offsets, current map[int]int64) (TopicReplay, error) {
+	for p := range offsets {
+		if _, ok := bounds[p]; !ok {
+			return TopicReplay{}, fmt.Errorf("%w: %s has no partition %d", ErrBadReplay, topic, p)
+		}
+	}
+
+	tr := TopicReplay{Topic: topic}
+	for p, b := range bounds {
+		target := b.AtTime
+		if offsets != nil {
+			off, ok := offsets[p]
+			if !ok {
+				continue
+			}
+			if off < b.First || off > b.Last {
+				return TopicReplay{}, fmt.Errorf("%w: %s/%d offset %d out of range [%d, %d]",
+					ErrBadReplay, topic, p, off, b.First, b.Last)
+			}
+			target = off
+		}
+
+		pr := PartitionReplay{Partition: p, Current: -1, Target: target, Pending: b.Last - target}
+		if cur, ok := current[p]; ok {
+			pr.Current = cur
+			pr.Replay = max(0, cur-target)
+		}
+		tr.Partitions = append(tr.Partitions, pr)
+		tr.Replay += pr.Replay
+		tr.Pending += pr.Pending
+	}
+	slices.SortFunc(tr.Partitions, func(x, y PartitionReplay) int { return x.Partition - y.Partition })
+	return tr, nil
+}
+
+// replayRanges — что повторяет replay: по партиции — офсет группы до
+// сброса. Сообщения до него уже применялись, и их отметки дедупликации
+// (в памяти и в Postgres, до KAFKA_DEDUP_TTL) ещё живы — без этого replay
+// пропустил бы всё как дубли. Живёт в Supervisor и переживает перезапуски.
+type replayRanges struct {
+	mu  sync.Mutex
+	end map[string]int64 // trackKey → первый офсет после повторяемого
+}
+
+func newReplayRanges() *replayRanges {
+	return &replayRanges{end: make(map[string]int64)}
+}
+
+func (r *replayRanges) add(tr TopicReplay) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, p := range tr.Partitions {
+		if p.Replay <= 0 {
+			continue
+		}
+		k := trackKey(kafka.Message{Topic: tr.Topic, Partition: p.Partition})
+		r.end[k] = max(r.end[k], p.Current)
+	}
+}
+
+// covers — m из повторяемого диапазона. Партиция, дочитанная до конца
+// диапазона, из него убирается. nil не покрывает ничего.
+func (r *replayRanges) covers(m kafka.Message) bool {
+	if r == nil {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	k := trackKey(m)
+	end, ok := r.end[k]
+	if ok && m.Offset >= end {
+		delete(r.end, k)
+	}
+	return ok && m.Offset < end
+}
+
+func (tr TopicReplay) targets() map[int]int64 {
+	out := make(map[int]int64, len(tr.Partitions))
+	for _, p := range tr.Partitions {
+		out[p.Partition] = p.Target
+	}
+	return out
+}
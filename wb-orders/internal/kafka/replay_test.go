@@ -0,0 +1,199 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"wb-orders/internal/dedup"
+)
+
+// marks — message_dedup в памяти.
+type marks map[string]time.Time
+
+func (m marks) DedupSeen(_ context.Context, id string) (bool, time.Time, error) {
+	exp, ok := m[id]
+	return ok && exp.After(time.Now()), exp, nil
+}
+
+func (m marks) DedupMark(_ context.Context, id, _ string, expires time.Time) error {
+	m[id] = expires
+	return nil
+}
+
+func (m marks) DedupForget(context.Context, string, string) error { return nil }
+
+func (m marks) DedupPurge(context.Context) (int64, error) { return 0, nil }
+
+// Сообщения до офсета, с которого начат replay, уже отмечены дедупликацией,
+// но применяются заново; после диапазона дедупликация работает как обычно.
+func TestReplayBypassesDedup(t *testing.T) {
+	msg := func(offset int64, id string) kafka.Message {
+		return kafka.Message{
+			Topic: "orders", Partition: 0, Offset: offset, Value: []byte(testOrder),
+			Headers: []kafka.Header{{Key: HeaderMessageID, Value: []byte(id)}},
+		}
+	}
+	m := marks{}
+	d := dedup.New(m, time.Hour, 10)
+	for _, id := range []string{"m1", "m2", "m3"} {
+		d.Mark(context.Background(), dedup.Key(id, "", nil))
+	}
+
+	r := &fakeReader{msgs: []kafka.Message{msg(0, "m1"), msg(1, "m2"), msg(2, "m3"), msg(3, "m3")}}
+	s := &flakyStore{}
+	c := newTestConsumer(r, s)
+	c.dedup = d
+	c.replayed = newReplayRanges()
+	c.replayed.add(TopicReplay{Topic: "orders", Partitions: []PartitionReplay{
+		{Partition: 0, Current: 2, Target: 0, Replay: 2},
+	}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := c.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// 0 и 1 — повтор replay'ем, 2 и 3 — дубли m3
+	if s.calls != 2 {
+		t.Errorf("store calls = %d, want 2 (replayed range only)", s.calls)
+	}
+	c.metrics.mu.Lock()
+	dups := c.metrics.skipped[SkipDuplicate]
+	c.metrics.mu.Unlock()
+	if dups != 2 {
+		t.Errorf("duplicates = %d, want 2", dups)
+	}
+}
+
+func TestReplayRangesCovers(t *testing.T) {
+	var none *replayRanges
+	if none.covers(kafka.Message{Topic: "orders"}) {
+		t.Fatal("nil ranges cover a message")
+	}
+	r := newReplayRanges()
+	r.add(TopicReplay{Topic: "orders", Partitions: []PartitionReplay{
+		{Partition: 0, Current: 10, Target: 5, Replay: 5},
+		{Partition: 1, Current: 7, Target: 7, Replay: 0},
+	}})
+	at := func(p int, off int64) kafka.Message {
+		return kafka.Message{Topic: "orders", Partition: p, Offset: off}
+	}
+	if !r.covers(at(0, 5)) || !r.covers(at(0, 9)) {
+		t.Error("replayed offsets not covered")
+	}
+	if r.covers(at(1, 3)) {
+		t.Error("partition without replay covered")
+	}
+	if r.covers(at(0, 10)) {
+		t.Error("offset past the range covered")
+	}
+	// дочитали до конца — диапазон снят
+	if r.covers(at(0, 6)) {
+		t.Error("range kept after the partition passed its end")
+	}
+}
+
+func TestReplayRequestResolve(t *testing.T) {
+	now := time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC)
+	topics := []string{"orders", "orders-v2"}
+
+	for _, tc := range []struct {
+		name       string
+		req        ReplayRequest
+		wantTopics []string
+		wantAt     time.Time
+		bad        bool
+	}{
+		{"since", ReplayRequest{Since: "24h"}, topics, now.Add(-24 * time.Hour), false},
+		{"time", ReplayRequest{Time: now.Add(-time.Hour), Topic: "orders"}, []string{"orders"}, now.Add(-time.Hour), false},
+		{"offsets", ReplayRequest{Topic: "orders", Offsets: map[int]int64{0: 5}}, []string{"orders"}, time.Time{}, false},
+		{"nothing", ReplayRequest{}, nil, time.Time{}, true},
+		{"two at once", ReplayRequest{Since: "1h", Time: now.Add(-time.Hour)}, nil, time.Time{}, true},
+		{"empty offsets still count", ReplayRequest{Since: "1h", Offsets: map[int]int64{}}, nil, time.Time{}, true},
+		{"offsets without topic", ReplayRequest{Offsets: map[int]int64{0: 5}}, nil, time.Time{}, true},
+		{"unknown topic", ReplayRequest{Topic: "payments", Since: "1h"}, nil, time.Time{}, true},
+		{"bad since", ReplayRequest{Since: "yesterday"}, nil, time.Time{}, true},
+		{"negative since", ReplayRequest{Since: "-1h"}, nil, time.Time{}, true},
+		{"future", ReplayRequest{Time: now.Add(time.Minute)}, nil, time.Time{}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, at, err := tc.req.resolve(topics, now)
+			if tc.bad {
+				if !errors.Is(err, ErrBadReplay) {
+					t.Fatalf("err = %v, want ErrBadReplay", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tc.wantTopics) || !at.Equal(tc.wantAt) {
+				t.Fatalf("resolve = %v %v, want %v %v", got, at, tc.wantTopics, tc.wantAt)
+			}
+		})
+	}
+
+	// единственный топик консьюмера подходит для offsets и без topic
+	if _, _, err := (ReplayRequest{Offsets: map[int]int64{0: 1}}).resolve([]string{"orders"}, now); err != nil {
+		t.Errorf("offsets with a single topic: %v", err)
+	}
+}
+
+func TestPlanPartitions(t *testing.T) {
+	bounds := map[int]PartitionBounds{
+		0: {First: 0, Last: 100, AtTime: 40},
+		1: {First: 10, Last: 50, AtTime: 50}, // после at сообщений нет
+		2: {First: 0, Last: 30, AtTime: 0},
+	}
+	current := map[int]int64{0: 90, 1: 50} // у партиции 2 офсета ещё нет
+
+	t.Run("by time", func(t *testing.T) {
+		tr, err := planPartitions("orders", bounds, nil, current)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []PartitionReplay{
+			{Partition: 0, Current: 90, Target: 40, Replay: 50, Pending: 60},
+			{Partition: 1, Current: 50, Target: 50, Replay: 0, Pending: 0},
+			{Partition: 2, Current: -1, Target: 0, Replay: 0, Pending: 30},
+		}
+		if !slices.Equal(tr.Partitions, want) {
+			t.Fatalf("partitions = %+v, want %+v", tr.Partitions, want)
+		}
+		if tr.Replay != 50 || tr.Pending != 90 {
+			t.Errorf("totals replay=%d pending=%d, want 50/90", tr.Replay, tr.Pending)
+		}
+		if got := tr.targets(); len(got) != 3 || got[0] != 40 || got[2] != 0 {
+			t.Errorf("targets = %v", got)
+		}
+	})
+
+	t.Run("explicit offsets", func(t *testing.T) {
+		tr, err := planPartitions("orders", bounds, map[int]int64{0: 95}, current)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// вперёд — повтора нет; остальные партиции не трогаются
+		want := []PartitionReplay{{Partition: 0, Current: 90, Target: 95, Replay: 0, Pending: 5}}
+		if !slices.Equal(tr.Partitions, want) {
+			t.Fatalf("partitions = %+v, want %+v", tr.Partitions, want)
+		}
+	})
+
+	for name, offsets := range map[string]map[int]int64{
+		"unknown partition": {7: 0},
+		"below first":       {1: 5},
+		"past last":         {0: 101},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := planPartitions("orders", bounds, offsets, current); !errors.Is(err, ErrBadReplay) {
+				t.Fatalf("err = %v, want ErrBadReplay", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+// internal/kafka/source.go
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Откуда Consumer берёт сообщения (KAFKA_SOURCE).
+const (
+	// SourceKafka — группа консьюмеров Kafka (офсеты — см. KAFKA_OFFSET_STORE).
+	SourceKafka = "kafka"
+	// SourceDir — *.json файлы, которые кладут в каталог KAFKA_SOURCE_DIR.
+	SourceDir = "dir"
+)
+
+// ErrSourceClosed — источник закрыт, сообщений больше не будет.
+var ErrSourceClosed = errors.New("message source closed")
+
+// MessageSource — откуда Consumer берёт сообщения. Конверт — kafka.Message
+// (ключ, значение, заголовки и координаты): весь конвейер разбор →
+// валидация → БД → кэш, DLQ и карантин работают с ним одинаково для
+// любого источника.
+//
+// FetchMessage блокируется до сообщения или отмены ctx. CommitMessages —
+// как в Kafka: подтверждает переданные сообщения и всё, что было до них
+// в той же партиции; неподтверждённое источник отдаст снова после
+// перезапуска.
+type MessageSource interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// Реализации — kafka.Reader (офсеты в группе), dbOffsetReader (офсеты
+// в Postgres), MemorySource и DirSource.
+var (
+	_ MessageSource = (*kafka.Reader)(nil)
+	_ MessageSource = (*dbOffsetReader)(nil)
+	_ MessageSource = (*MemorySource)(nil)
+	_ MessageSource = (*DirSource)(nil)
+)
+
+// NewSource создаёт источник по cfg.Source. group не пустой, только если
+// офсеты хранятся в Postgres: тогда Consumer пишет их вместе с заказом,
+// а читаются они из offsets (storage.Repo).
+func NewSource(cfg Config, offsets offsetLoader) (src MessageSource, group string, err error) {
+	if cfg.Source == SourceDir {
+		src, err := NewDirSource(cfg.SourceDir, cfg.SourcePoll)
+		return src, "", err
+	}
+
+	dialer, err := cfg.Dialer()
+	if err != nil {
+		return nil, "", fmt.Errorf("kafka dialer: %w", err)
+	}
+	// CommitInterval не задаём: офсеты коммитятся явно и синхронно,
+	// только после того как заказ сохранён (или ушёл в DLQ).
+	switch cfg.OffsetStore {
+	case OffsetStorePostgres:
+		r, err := newDBOffsetReader(cfg, dialer, offsets)
+		if err != nil {
+			return nil, "", err
+		}
+		return r, cfg.GroupID, nil
+	default:
+		return kafka.NewReader(cfg.ReaderConfig(dialer)), "", nil
+	}
+}
@@ -0,0 +1,240 @@
+// internal/kafka/status.go
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"wb-orders/internal/cache"
+	"wb-orders/internal/ingest"
+	"wb-orders/internal/models"
+	"wb-orders/internal/pipeline"
+	"wb-orders/internal/storage"
+)
+
+// statusStore — то, что нужно StatusConsumer от storage.Repo.
+type statusStore interface {
+	UpdateItemStatus(ctx context.Context, ev models.StatusEvent) error
+	GetOrderByID(ctx context.Context, id string) (models.Order, error)
+}
+
+// StatusConsumer читает топик order-status (KAFKA_TOPIC_STATUS): небольшие
+// события смены статуса товара применяются на месте через
+// Repo.UpdateItemStatus, после чего заказ перечитывается из БД в кэш и,
+// если задан KAFKA_TOPIC_OUTPUT, публикуется обогащённым — иначе у
+// получателей остались бы прежние state и status_names.
+// Офсеты — всегда в группе Kafka: повтор события безвреден (тот же статус
+// не пишется, более старое событие отбрасывается).
+type StatusConsumer struct {
+	source MessageSource
+	repo   statusStore
+	cache  *cache.LRU
+	pub    pipeline.Publisher // nil — выходного топика нет
+	dlq    *DLQ
+	retry  RetryPolicy
+	drain  time.Duration
+
+	mu    sync.Mutex
+	stats StatusStats
+}
+
+// StatusStats — ответ /debug/status-consumer.
+type StatusStats struct {
+	Applied  uint64            `json:"applied"`
+	Stale    uint64            `json:"stale"`
+	Rejected map[string]uint64 `json:"rejected"` // по стадиям DLQ
+}
+
+// out может быть nil (KAFKA_TOPIC_OUTPUT не задан).
+func NewStatusConsumer(cfg Config, repo *storage.Repo, c *cache.LRU, out *Output) (*StatusConsumer, error) {
+	dialer, err := cfg.Dialer()
+	if err != nil {
+		return nil, fmt.Errorf("kafka dialer: %w", err)
+	}
+	transport, err := cfg.Transport()
+	if err != nil {
+		return nil, fmt.Errorf("kafka transport: %w", err)
+	}
+
+	rc := cfg.ReaderConfig(dialer)
+	rc.Topic, rc.GroupTopics = cfg.StatusTopic, nil
+	rc.GroupID = cfg.StatusGroupID
+
+	s := &StatusConsumer{
+		source: kafka.NewReader(rc),
+		repo:   repo,
+		cache:  c,
+		dlq:    NewDLQ(cfg.Brokers, cfg.DLQTopic, transport),
+		retry:  DefaultRetry,
+		drain:  cfg.DrainTimeout,
+		stats:  StatusStats{Rejected: map[string]uint64{}},
+	}
+	if out != nil {
+		s.pub = out
+	}
+	return s, nil
+}
+
+// Run — как Consumer.Run: офсет коммитится только после того, как событие
+// применено, отброшено как устаревшее или ушло в DLQ; отмена ctx
+// останавливает чтение, текущее событие дообрабатывается (drainContext).
+func (s *StatusConsumer) Run(ctx context.Context) error {
+	work, release := drainContext(ctx, s.drain)
+	defer release()
+	defer func() {
+		if ctx.Err() != nil {
+			logDrain("status consumer", work)
+		}
+	}()
+
+	for {
+		m, err := s.source.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("fetch status: %w", err)
+		}
+
+		if err := s.handle(work, m); err != nil {
+			if work.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		if err := s.source.CommitMessages(work, m); err != nil {
+			if work.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("commit status offset=%d: %w", m.Offset, err)
+		}
+	}
+}
+
+func (s *StatusConsumer) handle(ctx context.Context, m kafka.Message) error {
+	meta := messageMeta(m)
+	ctx = ingest.WithMeta(ctx, meta)
+
+	var ev models.StatusEvent
+	if !ingest.IsJSON(meta.ContentType) {
+		return s.reject(ctx, m, StageDecode, fmt.Errorf("unsupported content-type %q", meta.ContentType))
+	}
+	if err := json.Unmarshal(m.Value, &ev); err != nil {
+		return s.reject(ctx, m, StageDecode, err)
+	}
+	if err := ev.Validate(); err != nil {
+		return s.reject(ctx, m, StageValidate, err)
+	}
+	if key := strings.TrimSpace(meta.Key); key != "" && key != ev.OrderUID {
+		return s.reject(ctx, m, StageKey, fmt.Errorf("message key %q != order_uid %q", key, ev.OrderUID))
+	}
+
+	err := s.retry.do(ctx, "status id="+ev.OrderUID, func() error {
+		return s.repo.UpdateItemStatus(ctx, ev)
+	})
+	switch {
+	case err == nil:
+	case errors.Is(err, storage.ErrStaleStatus):
+		log.Printf("[kafka] status skip: %v %s", err, meta)
+		s.count(func(st *StatusStats) { st.Stale++ })
+		return nil
+	case errors.Is(err, ErrStoreUnavailable) || ctx.Err() != nil:
+		return err
+	case errors.Is(err, models.ErrIllegalTransition):
+		return s.reject(ctx, m, StageTransition, err)
+	default:
+		return s.reject(ctx, m, StageStore, err)
+	}
+
+	if err := s.refresh(ctx, ev.OrderUID, meta); err != nil {
+		return err
+	}
+	s.count(func(st *StatusStats) { st.Applied++ })
+	log.Printf("[kafka] status applied: id=%s rid=%q chrt_id=%d status=%s %s",
+		ev.OrderUID, ev.RID, ev.ChrtID, ev.Status.Name(), meta)
+	return nil
+}
+
+// refresh перечитывает заказ целиком (чтобы не собирать его вручную),
+// кладёт в кэш и публикует. Без выходного топика ошибка чтения только
+// логируется: кэш догонит БД при следующем чтении. С ним — возвращается,
+// и событие придёт снова: статус повторно не запишется, а заказ уйдёт.
+func (s *StatusConsumer) refresh(ctx context.Context, id string, meta ingest.Meta) error {
+	var o models.Order
+	err := s.retry.do(ctx, "status reread id="+id, func() error {
+		var err error
+		o, err = s.repo.GetOrderByID(ctx, id)
+		return err
+	})
+	if err != nil {
+		if s.pub == nil {
+			log.Printf("[kafka] status: cache refresh id=%s: %v", id, err)
+			return nil
+		}
+		return fmt.Errorf("status reread id=%s: %w", id, err)
+	}
+	s.cache.Set(id, o)
+	if s.pub == nil {
+		return nil
+	}
+
+	it := &pipeline.Item{Order: o, Meta: meta}
+	data, err := json.Marshal(pipeline.EnrichedOrder{Order: o, Enrichment: pipeline.EnrichmentOf(it)})
+	if err != nil {
+		return fmt.Errorf("status publish id=%s: %w", id, err)
+	}
+	if err := s.pub.Publish(ctx, id, data, meta); err != nil {
+		return fmt.Errorf("status publish id=%s: %w", id, err)
+	}
+	return nil
+}
+
+// reject — в DLQ; ошибка DLQ возвращается наверх, чтобы не потерять событие.
+func (s *StatusConsumer) reject(ctx context.Context, m kafka.Message, stage string, cause error) error {
+	log.Printf("[kafka] status skip: stage=%s partition=%d offset=%d %s: %v",
+		stage, m.Partition, m.Offset, messageMeta(m), cause)
+	s.count(func(st *StatusStats) { st.Rejected[stage]++ })
+	if s.dlq == nil {
+		return nil
+	}
+	if err := s.dlq.Send(ctx, m, stage, cause); err != nil {
+		return fmt.Errorf("status offset=%d: %w", m.Offset, err)
+	}
+	return nil
+}
+
+func (s *StatusConsumer) count(fn func(*StatusStats)) {
+	s.mu.Lock()
+	fn(&s.stats)
+	s.mu.Unlock()
+}
+
+func (s *StatusConsumer) Stats() StatusStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := s.stats
+	out.Rejected = make(map[string]uint64, len(s.stats.Rejected))
+	for k, v := range s.stats.Rejected {
+		out.Rejected[k] = v
+	}
+	return out
+}
+
+func (s *StatusConsumer) Close() error {
+	err := s.source.Close()
+	if s.dlq != nil {
+		if dErr := s.dlq.Close(); dErr != nil && err == nil {
+			err = dErr
+		}
+	}
+	return err
+}
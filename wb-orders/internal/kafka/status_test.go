@@ -0,0 +1,87 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"wb-orders/internal/cache"
+	"wb-orders/internal/models"
+	"wb-orders/internal/pipeline"
+)
+
+// statusRepo — заказ в памяти; UpdateItemStatus меняет статус товаров
+// с нужным chrt_id.
+type statusRepo struct {
+	mu    sync.Mutex
+	order models.Order
+}
+
+func (r *statusRepo) UpdateItemStatus(_ context.Context, ev models.StatusEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.order.Items {
+		if r.order.Items[i].ChrtID == ev.ChrtID {
+			r.order.Items[i].Status = ev.Status
+		}
+	}
+	return nil
+}
+
+func (r *statusRepo) GetOrderByID(context.Context, string) (models.Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	o := r.order
+	o.Items = append([]models.Item(nil), r.order.Items...)
+	return o, nil
+}
+
+// Смена статуса уходит в выходной топик: получатели видят новый state.
+func TestStatusUpdateIsPublished(t *testing.T) {
+	var o models.Order
+	if err := json.Unmarshal([]byte(testOrder), &o); err != nil {
+		t.Fatal(err)
+	}
+	ev, _ := json.Marshal(models.StatusEvent{
+		OrderUID: o.OrderUID, ChrtID: o.Items[0].ChrtID, Status: 300, Timestamp: time.Now(),
+	})
+	r := &fakeReader{msgs: []kafka.Message{{Key: []byte(o.OrderUID), Value: ev}}}
+	pub := &fakePublisher{}
+	c := cache.NewLRU(10)
+	s := &StatusConsumer{
+		source: r,
+		repo:   &statusRepo{order: o},
+		cache:  c,
+		pub:    pub,
+		retry:  RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+		stats:  StatusStats{Rejected: map[string]uint64{}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := s.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := s.Stats().Applied; got != 1 {
+		t.Fatalf("applied = %d, want 1", got)
+	}
+	if len(r.commits()) != 1 {
+		t.Fatalf("commits = %v, want 1", r.commits())
+	}
+	var got pipeline.EnrichedOrder
+	if err := json.Unmarshal(pub.sent[o.OrderUID], &got); err != nil {
+		t.Fatalf("published order: %v", err)
+	}
+	e := got.Enrichment
+	if e.State != models.StateShipped || len(e.StatusNames) != 1 || e.StatusNames[0] != "shipped" {
+		t.Fatalf("published enrichment = %+v", e)
+	}
+	if cached, ok := c.Get(o.OrderUID); !ok || cached.Items[0].Status != 300 {
+		t.Fatalf("cache not refreshed: %+v", cached.Items)
+	}
+}
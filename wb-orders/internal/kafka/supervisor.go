@@ -0,0 +1,304 @@
+// internal/kafka/supervisor.go
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"wb-orders/internal/pipeline"
+	"wb-orders/internal/storage"
+)
+
+// ErrNotRunning — консьюмер сейчас не запущен, перезапускать нечего.
+var ErrNotRunning = errors.New("consumer is not running")
+
+// rebuildDelay — пауза перед пересборкой консьюмера, у которого сломался
+// ридер партиции: если брокер недоступен, не крутимся вхолостую.
+var rebuildDelay = time.Second
+
+// Supervisor держит текущий Consumer и умеет остановить его, выполнить
+// операцию над группой (офсеты можно менять, только когда в группе нет
+// участников) и запустить заново.
+type Supervisor struct {
+	cfg   Config
+	repo  *storage.Repo
+	admin *Admin
+	build func() (*Consumer, error)
+	gate  *pauseGate // общий для всех консьюмеров: пауза переживает перезапуск
+	bp    *backpressure
+	// replayed — офсеты, повторяемые replay: дедупликация их не отбрасывает
+	replayed *replayRanges
+
+	ops sync.Mutex // одна операция с перезапуском за раз
+
+	mu     sync.Mutex
+	cons   *Consumer
+	cancel context.CancelFunc // останавливает текущий cons.Run; nil — Run не идёт
+	done   chan struct{}      // закрывается, когда cons.Run вернулся
+	next   chan *Consumer     // консьюмер после перезапуска (nil — не поднялся)
+}
+
+// chain — общая для всех консьюмеров: звенья, зарегистрированные в ней,
+// переживают перезапуск.
+func NewSupervisor(cfg Config, repo *storage.Repo, chain *pipeline.Chain) (*Supervisor, error) {
+	admin, err := NewAdmin(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s := &Supervisor{
+		cfg:   cfg,
+		repo:  repo,
+		admin: admin,
+		gate:  newPauseGate(),
+		bp:    newBackpressure(cfg.Backpressure),
+
+		replayed: newReplayRanges(),
+		next:     make(chan *Consumer, 1),
+	}
+	s.build = func() (*Consumer, error) {
+		cons, err := NewConsumer(cfg, repo, chain)
+		if err != nil {
+			return nil, err
+		}
+		cons.gate, cons.bp, cons.replayed = s.gate, s.bp, s.replayed
+		return cons, nil
+	}
+	if s.cons, err = s.build(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Run крутит текущий консьюмер; после перезапуска — следующий.
+// Возвращается по отмене ctx или если консьюмер остановился сам с ошибкой;
+// сломавшийся ридер партиции (errPartitionFailed) — не повод останавливаться:
+// консьюмер пересобирается.
+func (s *Supervisor) Run(ctx context.Context) error {
+	defer func() {
+		s.mu.Lock()
+		s.cancel = nil
+		s.mu.Unlock()
+	}()
+
+	for {
+		s.mu.Lock()
+		cons := s.cons
+		runCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		s.cancel, s.done = cancel, done
+		s.mu.Unlock()
+
+		err := cons.Run(runCtx)
+		restarting := runCtx.Err() != nil && ctx.Err() == nil
+		cancel()
+		close(done)
+		if !restarting {
+			if ctx.Err() != nil || !errors.Is(err, errPartitionFailed) {
+				return err
+			}
+			log.Printf("[kafka] rebuilding consumer: %v", err)
+			go s.rebuild(ctx, cons)
+		}
+
+		select {
+		case next := <-s.next:
+			if next == nil {
+				return errors.New("consumer restart failed")
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// restart останавливает консьюмер (он покидает группу), выполняет between
+// и поднимает новый. Счётчики метрик и память дедупликации переходят
+// к новому консьюмеру (повторяемое replay'ем она пропускает — replayRanges).
+// Ошибка between не мешает перезапуску: читать дальше нужно в любом случае.
+func (s *Supervisor) restart(ctx context.Context, between func(context.Context) error) error {
+	s.mu.Lock()
+	cancel, done, old := s.cancel, s.done, s.cons
+	s.mu.Unlock()
+	if cancel == nil {
+		return ErrNotRunning
+	}
+
+	cancel()
+	<-done
+	if err := old.Close(); err != nil {
+		log.Printf("[kafka] close consumer before restart: %v", err)
+	}
+
+	opErr := between(ctx)
+
+	next, err := s.build()
+	if err != nil {
+		s.mu.Lock()
+		s.cons = nil
+		s.mu.Unlock()
+		s.next <- nil
+		return errors.Join(opErr, fmt.Errorf("restart consumer: %w", err))
+	}
+	next.metrics, next.dedup = old.metrics, old.dedup
+
+	s.mu.Lock()
+	s.cons = next
+	s.mu.Unlock()
+	s.next <- next
+	return opErr
+}
+
+// rebuild поднимает новый консьюмер вместо failed, остановившегося с
+// ошибкой. Если failed уже заменил перезапуск (replay), делать нечего:
+// следующий консьюмер Run получит от него.
+func (s *Supervisor) rebuild(ctx context.Context, failed *Consumer) {
+	select {
+	case <-time.After(rebuildDelay):
+	case <-ctx.Done():
+		return
+	}
+	s.ops.Lock()
+	defer s.ops.Unlock()
+	s.mu.Lock()
+	current := s.cons
+	s.mu.Unlock()
+	if current != failed {
+		return
+	}
+	if err := s.restart(ctx, func(context.Context) error { return nil }); err != nil {
+		log.Printf("[kafka] rebuild consumer: %v", err)
+	}
+}
+
+// Replay сбрасывает офсеты группы на момент времени или явные офсеты.
+// Консьюмер на время сброса останавливается; план считается уже после
+// остановки, чтобы текущие офсеты не успели сдвинуться.
+func (s *Supervisor) Replay(ctx context.Context, req ReplayRequest) (ReplayPlan, error) {
+	s.ops.Lock()
+	defer s.ops.Unlock()
+
+	if s.cfg.Source != SourceKafka {
+		return ReplayPlan{}, fmt.Errorf("%w: replay needs KAFKA_SOURCE=kafka", ErrBadReplay)
+	}
+	topics, at, err := req.resolve(s.cfg.Topics, time.Now())
+	if err != nil {
+		return ReplayPlan{}, err
+	}
+	if req.DryRun {
+		plan, err := s.plan(ctx, topics, at, req.Offsets)
+		plan.DryRun = true
+		return plan, err
+	}
+
+	var plan ReplayPlan
+	err = s.restart(ctx, func(ctx context.Context) error {
+		var err error
+		if plan, err = s.plan(ctx, topics, at, req.Offsets); err != nil {
+			return err
+		}
+		for _, tr := range plan.Topics {
+			if err := s.resetOffsets(ctx, tr.Topic, tr.targets()); err != nil {
+				return fmt.Errorf("reset %s: %w", tr.Topic, err)
+			}
+			s.replayed.add(tr)
+			log.Printf("[kafka] replay %s: partitions=%d replay=%d pending=%d",
+				tr.Topic, len(tr.Partitions), tr.Replay, tr.Pending)
+		}
+		plan.Applied = true
+		return nil
+	})
+	return plan, err
+}
+
+func (s *Supervisor) plan(ctx context.Context, topics []string, at time.Time, offsets map[int]int64) (ReplayPlan, error) {
+	var plan ReplayPlan
+	for _, topic := range topics {
+		current, err := s.currentOffsets(ctx, topic)
+		if err != nil {
+			return ReplayPlan{}, fmt.Errorf("current offsets %s: %w", topic, err)
+		}
+		tr, err := s.admin.planTopic(ctx, topic, at, offsets, current)
+		if err != nil {
+			return ReplayPlan{}, err
+		}
+		plan.Topics = append(plan.Topics, tr)
+		plan.Replay += tr.Replay
+		plan.Pending += tr.Pending
+	}
+	return plan, nil
+}
+
+// currentOffsets — следующие к чтению офсеты группы там, где они хранятся.
+func (s *Supervisor) currentOffsets(ctx context.Context, topic string) (map[int]int64, error) {
+	if s.cfg.OffsetStore == OffsetStorePostgres {
+		return s.repo.StoredOffsets(ctx, s.cfg.GroupID, topic)
+	}
+	return s.admin.CommittedOffsets(ctx, topic)
+}
+
+// resetOffsets пишет офсеты туда, откуда их возьмёт новый консьюмер.
+// При офсетах в Postgres группа в Kafka — только для наглядности (лаг в
+// kafka-ui), поэтому её ошибка лишь логируется.
+func (s *Supervisor) resetOffsets(ctx context.Context, topic string, offsets map[int]int64) error {
+	if s.cfg.OffsetStore != OffsetStorePostgres {
+		// офсеты только в группе: при живых участниках сброс не пройдёт
+		// или будет перезаписан их коммитами — отказываем сразу
+		if err := s.admin.ensureEmpty(ctx); err != nil {
+			return err
+		}
+		return s.admin.CommitOffsets(ctx, topic, offsets)
+	}
+	if err := s.repo.ResetOffsets(ctx, s.cfg.GroupID, topic, offsets); err != nil {
+		return err
+	}
+	if err := s.admin.CommitOffsets(ctx, topic, offsets); err != nil {
+		log.Printf("[kafka] replay %s: kafka group offsets not updated: %v", topic, err)
+	}
+	return nil
+}
+
+// Pause останавливает чтение новых сообщений, не выходя из группы.
+// Сообщения, уже взятые в работу, дообрабатываются. false — уже на паузе.
+func (s *Supervisor) Pause() bool {
+	started := s.gate.Pause(PauseManual)
+	if started {
+		log.Printf("[kafka] paused by admin")
+	}
+	return started
+}
+
+// Resume снимает паузу (ручную или автопаузу). false — паузы не было.
+func (s *Supervisor) Resume() bool {
+	resumed := s.gate.Resume()
+	if resumed {
+		log.Printf("[kafka] resumed by admin")
+	}
+	return resumed
+}
+
+// State — текущее состояние паузы.
+func (s *Supervisor) State() PauseState { return s.gate.state() }
+
+// Stats — статистика текущего консьюмера.
+func (s *Supervisor) Stats() ConsumerStats {
+	s.mu.Lock()
+	cons := s.cons
+	s.mu.Unlock()
+	if cons == nil {
+		return ConsumerStats{State: s.gate.state(), Backpressure: s.bp.snapshot()}
+	}
+	return cons.Stats()
+}
+
+func (s *Supervisor) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cons == nil {
+		return nil
+	}
+	return s.cons.Close()
+}
@@ -0,0 +1,91 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// brokenSource — источник, у которого сломался ридер партиции.
+type brokenSource struct {
+	closed atomic.Bool
+}
+
+func (s *brokenSource) FetchMessage(context.Context) (kafka.Message, error) {
+	return kafka.Message{}, fmt.Errorf("%w: orders/0 set offset 5: boom", errPartitionFailed)
+}
+
+func (s *brokenSource) CommitMessages(context.Context, ...kafka.Message) error { return nil }
+
+func (s *brokenSource) Close() error {
+	s.closed.Store(true)
+	return nil
+}
+
+func TestSupervisorRebuildsAfterPartitionFailure(t *testing.T) {
+	defer func(d time.Duration) { rebuildDelay = d }(rebuildDelay)
+	rebuildDelay = time.Millisecond
+
+	broken := &brokenSource{}
+	r := &fakeReader{msgs: []kafka.Message{{Offset: 3, Value: []byte(testOrder)}}}
+	store := &flakyStore{}
+	s := &Supervisor{
+		cons:  newTestConsumer(broken, store),
+		build: func() (*Consumer, error) { return newTestConsumer(r, store), nil },
+		next:  make(chan *Consumer, 1),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+
+	deadline := time.After(2 * time.Second)
+	for len(r.commits()) == 0 {
+		select {
+		case err := <-done:
+			t.Fatalf("Run stopped instead of rebuilding: %v", err)
+		case <-deadline:
+			t.Fatal("rebuilt consumer did not commit")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	if !broken.closed.Load() {
+		t.Error("failed consumer was not closed")
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run: %v", err)
+	}
+}
+
+func TestSupervisorStopsOnOtherErrors(t *testing.T) {
+	// БД недоступна дольше политики повторов — это не сломанный ридер
+	r := &fakeReader{msgs: []kafka.Message{{Offset: 3, Value: []byte(testOrder)}}}
+	built := false
+	s := &Supervisor{
+		cons:  newTestConsumer(r, &flakyStore{failures: -1}),
+		build: func() (*Consumer, error) { built = true; return nil, nil },
+		next:  make(chan *Consumer, 1),
+	}
+	select {
+	case err := <-runAsync(s):
+		if err == nil {
+			t.Error("Run returned nil")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not stop")
+	}
+	if built {
+		t.Error("consumer was rebuilt")
+	}
+}
+
+func runAsync(s *Supervisor) <-chan error {
+	done := make(chan error, 1)
+	go func() { done <- s.Run(context.Background()) }()
+	return done
+}
@@ -0,0 +1,240 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	ErrMoneyOverflow    = errors.New("money overflow")
+)
+
+// Money — сумма в минорных единицах валюты (центы, копейки).
+// В JSON и в БД это по-прежнему целое число (1817), поэтому формат
+// сообщений не меняется. Валюта в JSON не пишется — её проставляет
+// Order.BindCurrency из Payment.Currency.
+type Money struct {
+	Minor    int64
+	Currency string
+}
+
+// Currency — описание валюты: сколько знаков после запятой и символ.
+type Currency struct {
+	Code     string
+	Exponent int
+	Symbol   string
+}
+
+var currencies = map[string]Currency{
+	"USD": {Code: "USD", Exponent: 2, Symbol: "$"},
+	"EUR": {Code: "EUR", Exponent: 2, Symbol: "€"},
+	"GBP": {Code: "GBP", Exponent: 2, Symbol: "£"},
+	"RUB": {Code: "RUB", Exponent: 2, Symbol: "₽"},
+	"BYN": {Code: "BYN", Exponent: 2, Symbol: "Br"},
+	"KZT": {Code: "KZT", Exponent: 2, Symbol: "₸"},
+	"UZS": {Code: "UZS", Exponent: 2, Symbol: "сўм"},
+	"AMD": {Code: "AMD", Exponent: 2, Symbol: "֏"},
+	"ILS": {Code: "ILS", Exponent: 2, Symbol: "₪"},
+	"CNY": {Code: "CNY", Exponent: 2, Symbol: "¥"},
+	"JPY": {Code: "JPY", Exponent: 0, Symbol: "¥"},
+	"KWD": {Code: "KWD", Exponent: 3, Symbol: "KD"},
+}
+
+// LookupCurrency ищет валюту по коду (без учёта регистра).
+func LookupCurrency(code string) (Currency, bool) {
+	c, ok := currencies[strings.ToUpper(code)]
+	return c, ok
+}
+
+// currencyOf возвращает описание валюты; для неизвестных — 2 знака и сам код.
+func currencyOf(code string) Currency {
+	if c, ok := LookupCurrency(code); ok {
+		return c
+	}
+	return Currency{Code: strings.ToUpper(code), Exponent: 2, Symbol: strings.ToUpper(code)}
+}
+
+func NewMoney(minor int64, currency string) Money {
+	return Money{Minor: minor, Currency: currency}
+}
+
+func (m Money) IsNegative() bool { return m.Minor < 0 }
+
+// sameCurrency: пустая валюта совместима с любой (значение ещё не привязано).
+func (m Money) sameCurrency(o Money) (string, error) {
+	switch {
+	case m.Currency == "":
+		return o.Currency, nil
+	case o.Currency == "" || strings.EqualFold(m.Currency, o.Currency):
+		return m.Currency, nil
+	}
+	return "", fmt.Errorf("%w: %s vs %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+}
+
+func (m Money) Add(o Money) (Money, error) {
+	cur, err := m.sameCurrency(o)
+	if err != nil {
+		return Money{}, err
+	}
+	if (o.Minor > 0 && m.Minor > math.MaxInt64-o.Minor) ||
+		(o.Minor < 0 && m.Minor < math.MinInt64-o.Minor) {
+		return Money{}, ErrMoneyOverflow
+	}
+	return Money{Minor: m.Minor + o.Minor, Currency: cur}, nil
+}
+
+// Sum складывает суммы с проверкой валюты и переполнения.
+func Sum(ms ...Money) (Money, error) {
+	var total Money
+	for _, m := range ms {
+		var err error
+		if total, err = total.Add(m); err != nil {
+			return Money{}, err
+		}
+	}
+	return total, nil
+}
+
+// Major — сумма в основных единицах строкой без группировки: "18.17".
+func (m Money) Major() string {
+	return m.format(localeFormat{decimal: "."}, currencyOf(m.Currency).Exponent)
+}
+
+type localeFormat struct {
+	group       string
+	decimal     string
+	symbolFirst bool
+}
+
+var localeFormats = map[string]localeFormat{
+	"en": {group: ",", decimal: ".", symbolFirst: true},
+	"ru": {group: " ", decimal: ",", symbolFirst: false},
+	"de": {group: ".", decimal: ",", symbolFirst: false},
+	"fr": {group: " ", decimal: ",", symbolFirst: false},
+	"es": {group: ".", decimal: ",", symbolFirst: false},
+	"kk": {group: " ", decimal: ",", symbolFirst: false},
+	"he": {group: ",", decimal: ".", symbolFirst: true},
+}
+
+// Format печатает сумму по правилам локали: en → "$18.17", ru → "18,17 $".
+// Локаль берётся по первому сегменту ("en-US", "ru_RU"); неизвестные — как en.
+func (m Money) Format(locale string) string {
+	lang := strings.ToLower(locale)
+	if i := strings.IndexAny(lang, "-_"); i >= 0 {
+		lang = lang[:i]
+	}
+	lf, ok := localeFormats[lang]
+	if !ok {
+		lf = localeFormats["en"]
+	}
+	cur := currencyOf(m.Currency)
+	num := m.format(lf, cur.Exponent)
+	if cur.Symbol == "" {
+		return num
+	}
+	if lf.symbolFirst {
+		if strings.HasPrefix(num, "-") {
+			return "-" + cur.Symbol + num[1:]
+		}
+		return cur.Symbol + num
+	}
+	return num + " " + cur.Symbol
+}
+
+func (m Money) format(lf localeFormat, exp int) string {
+	neg := m.Minor < 0
+	u := uint64(m.Minor)
+	if neg {
+		u = -u
+	}
+	digits := strconv.FormatUint(u, 10)
+	if len(digits) <= exp {
+		digits = strings.Repeat("0", exp-len(digits)+1) + digits
+	}
+	intPart, frac := digits[:len(digits)-exp], digits[len(digits)-exp:]
+
+	var b strings.Builder
+	if neg {
+		b.WriteByte('-')
+	}
+	for i, r := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteString(lf.group)
+		}
+		b.WriteRune(r)
+	}
+	if exp > 0 {
+		b.WriteString(lf.decimal)
+		b.WriteString(frac)
+	}
+	return b.String()
+}
+
+func (m Money) String() string {
+	if m.Currency == "" {
+		return m.Major()
+	}
+	return m.Major() + " " + strings.ToUpper(m.Currency)
+}
+
+// -------------------- JSON / SQL --------------------
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return strconv.AppendInt(nil, m.Minor, 10), nil
+}
+
+// UnmarshalJSON принимает только целые числа: 18.17 вместо 1817 — ошибка
+// продюсера, молча округлять её нельзя. null, как и у прежних int-полей,
+// значение не меняет (у нового заказа — 0).
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		return fmt.Errorf("money: want number, got string %s", data)
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("money: %w", err)
+	}
+	v, err := strconv.ParseInt(string(n), 10, 64)
+	if err != nil {
+		return fmt.Errorf("money: want integer minor units, got %s", n)
+	}
+	m.Minor = v
+	return nil
+}
+
+func (m Money) Value() (driver.Value, error) { return m.Minor, nil }
+
+func (m *Money) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		m.Minor = 0
+	case int64:
+		m.Minor = v
+	case int32:
+		m.Minor = int64(v)
+	case []byte:
+		n, err := strconv.ParseInt(string(v), 10, 64)
+		if err != nil {
+			return fmt.Errorf("money scan: %w", err)
+		}
+		m.Minor = n
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("money scan: %w", err)
+		}
+		m.Minor = n
+	default:
+		return fmt.Errorf("money scan: unsupported type %T", src)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestMoneyArithmetic(t *testing.T) {
+	usd := func(n int64) Money { return NewMoney(n, "USD") }
+
+	for _, tc := range []struct {
+		name string
+		op   func() (Money, error)
+		want int64
+		err  error
+	}{
+		{"add", func() (Money, error) { return usd(150).Add(usd(25)) }, 175, nil},
+		{"add unbound", func() (Money, error) { return Money{Minor: 5}.Add(usd(5)) }, 10, nil},
+		{"add case-insensitive", func() (Money, error) { return usd(1).Add(NewMoney(2, "usd")) }, 3, nil},
+		{"add mismatch", func() (Money, error) { return usd(1).Add(NewMoney(1, "EUR")) }, 0, ErrCurrencyMismatch},
+		{"add max", func() (Money, error) { return usd(math.MaxInt64 - 1).Add(usd(1)) }, math.MaxInt64, nil},
+		{"add overflow", func() (Money, error) { return usd(math.MaxInt64).Add(usd(1)) }, 0, ErrMoneyOverflow},
+		{"add underflow", func() (Money, error) { return usd(math.MinInt64).Add(usd(-1)) }, 0, ErrMoneyOverflow},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.op()
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("err = %v, want %v", err, tc.err)
+			}
+			if got.Minor != tc.want {
+				t.Fatalf("got %d, want %d", got.Minor, tc.want)
+			}
+		})
+	}
+}
+
+func TestSum(t *testing.T) {
+	got, err := Sum(NewMoney(1, "RUB"), NewMoney(2, "RUB"), NewMoney(3, ""))
+	if err != nil || got.Minor != 6 || got.Currency != "RUB" {
+		t.Fatalf("Sum = %+v, %v", got, err)
+	}
+	if _, err := Sum(NewMoney(math.MaxInt64, "RUB"), NewMoney(1, "RUB")); !errors.Is(err, ErrMoneyOverflow) {
+		t.Fatalf("overflow err = %v", err)
+	}
+}
+
+func TestMoneyFormat(t *testing.T) {
+	for _, tc := range []struct {
+		m      Money
+		locale string
+		want   string
+	}{
+		{NewMoney(1817, "USD"), "en", "$18.17"},
+		{NewMoney(1817, "USD"), "ru-RU", "18,17\u00a0$"},
+		{NewMoney(123456789, "RUB"), "ru_RU", "1\u00a0234\u00a0567,89\u00a0₽"},
+		{NewMoney(123456789, "EUR"), "de", "1.234.567,89\u00a0€"},
+		{NewMoney(-1817, "USD"), "en", "-$18.17"},
+		{NewMoney(5, "USD"), "en", "$0.05"},
+		{NewMoney(1500, "JPY"), "en", "¥1,500"},
+		{NewMoney(1234, "KWD"), "en", "KD1.234"},
+		{NewMoney(1817, "usd"), "xx", "$18.17"}, // неизвестная локаль — как en
+		{NewMoney(1817, "XYZ"), "en", "XYZ18.17"},
+		{NewMoney(math.MinInt64, "USD"), "en", "-$92,233,720,368,547,758.08"},
+	} {
+		if got := tc.m.Format(tc.locale); got != tc.want {
+			t.Errorf("%v.Format(%q) = %q, want %q", tc.m, tc.locale, got, tc.want)
+		}
+	}
+	if got := NewMoney(1817, "usd").String(); got != "18.17 USD" {
+		t.Errorf("String = %q", got)
+	}
+	if got := NewMoney(7, "").Major(); got != "0.07" {
+		t.Errorf("Major = %q", got)
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	var p struct {
+		Amount       Money `json:"amount"`
+		DeliveryCost Money `json:"delivery_cost"`
+		CustomFee    Money `json:"custom_fee"`
+	}
+	if err := json.Unmarshal([]byte(`{"amount": 1817, "delivery_cost": null, "custom_fee": -3}`), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Amount.Minor != 1817 || p.DeliveryCost.Minor != 0 || p.CustomFee.Minor != -3 {
+		t.Fatalf("decoded %+v", p)
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"amount":1817,"delivery_cost":0,"custom_fee":-3}` {
+		t.Fatalf("encoded %s", data)
+	}
+
+	for _, bad := range []string{`"1817"`, `18.17`, `1e3`, `99999999999999999999`, `true`} {
+		var m Money
+		if err := json.Unmarshal([]byte(bad), &m); err == nil {
+			t.Errorf("%s accepted as %d", bad, m.Minor)
+		}
+	}
+}
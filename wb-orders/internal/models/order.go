@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 // Order — главный объект, который будет возвращаться из БД и API.
 type Order struct {
@@ -37,25 +40,57 @@ type Payment struct {
 	RequestID    string `json:"request_id"`
 	Currency     string `json:"currency"`
 	Provider     string `json:"provider"`
-	Amount       int    `json:"amount"`
+	Amount       Money  `json:"amount"`
 	PaymentDT    int64  `json:"payment_dt"`
 	Bank         string `json:"bank"`
-	DeliveryCost int    `json:"delivery_cost"`
-	GoodsTotal   int    `json:"goods_total"`
-	CustomFee    int    `json:"custom_fee"`
+	DeliveryCost Money  `json:"delivery_cost"`
+	GoodsTotal   Money  `json:"goods_total"`
+	CustomFee    Money  `json:"custom_fee"`
 }
 
 // Item — товар в заказе.
 type Item struct {
-	ChrtID      int    `json:"chrt_id"`
-	TrackNumber string `json:"track_number"`
-	Price       int    `json:"price"`
-	RID         string `json:"rid"`
-	Name        string `json:"name"`
-	Sale        int    `json:"sale"`
-	Size        string `json:"size"`
-	TotalPrice  int    `json:"total_price"`
-	NmID        int    `json:"nm_id"`
-	Brand       string `json:"brand"`
-	Status      int    `json:"status"`
+	ChrtID      int        `json:"chrt_id"`
+	TrackNumber string     `json:"track_number"`
+	Price       Money      `json:"price"`
+	RID         string     `json:"rid"`
+	Name        string     `json:"name"`
+	Sale        int        `json:"sale"`
+	Size        string     `json:"size"`
+	TotalPrice  Money      `json:"total_price"`
+	NmID        int        `json:"nm_id"`
+	Brand       string     `json:"brand"`
+	Status      ItemStatus `json:"status"`
+}
+
+// BindCurrency проставляет валюту из Payment.Currency во все суммы заказа.
+// Вызывается после декодирования JSON и чтения из БД.
+func (o *Order) BindCurrency() {
+	cur := o.Payment.Currency
+	p := &o.Payment
+	p.Amount.Currency = cur
+	p.DeliveryCost.Currency = cur
+	p.GoodsTotal.Currency = cur
+	p.CustomFee.Currency = cur
+	for i := range o.Items {
+		o.Items[i].Price.Currency = cur
+		o.Items[i].TotalPrice.Currency = cur
+	}
+}
+
+// ItemsTotal — сумма total_price по всем товарам.
+func (o Order) ItemsTotal() (Money, error) {
+	total := Money{Currency: o.Payment.Currency}
+	for _, it := range o.Items {
+		var err error
+		if total, err = total.Add(it.TotalPrice); err != nil {
+			return Money{}, fmt.Errorf("item chrt_id=%d: %w", it.ChrtID, err)
+		}
+	}
+	return total, nil
+}
+
+// ExpectedAmount — сколько должно быть в amount: товары + доставка + пошлина.
+func (p Payment) ExpectedAmount() (Money, error) {
+	return Sum(p.GoodsTotal, p.DeliveryCost, p.CustomFee)
 }
@@ -0,0 +1,158 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrIllegalTransition — новое состояние заказа (или товара) недостижимо из текущего.
+var ErrIllegalTransition = errors.New("illegal state transition")
+
+// OrderState — жизненный цикл заказа, выводится из статусов товаров.
+type OrderState string
+
+const (
+	StateCreated   OrderState = "created"
+	StatePaid      OrderState = "paid"
+	StateShipped   OrderState = "shipped"
+	StateDelivered OrderState = "delivered"
+	StateCancelled OrderState = "cancelled"
+	StateReturned  OrderState = "returned"
+)
+
+// ItemStatus — код статуса товара, как его присылает WB (например, 202).
+// В JSON и в БД остаётся числом.
+type ItemStatus int
+
+// StatusInfo — описание кода статуса из реестра.
+type StatusInfo struct {
+	Code  ItemStatus `json:"code"`
+	Name  string     `json:"name"`
+	State OrderState `json:"state"`
+}
+
+// Реестр известных кодов: код → имя → состояние. Публичного справочника
+// кодов у WB нет: в образце заказа из задания есть только 202, остальные —
+// договорённость с продюсером (cmd/producer шлёт те же коды). Заказ или
+// событие с кодом не из реестра отклоняются (storage.ValidateOrder,
+// StatusEvent.Validate); новый код сначала добавляют сюда.
+var statuses = map[ItemStatus]StatusInfo{}
+
+func init() {
+	for _, s := range []StatusInfo{
+		{100, "created", StateCreated},
+		{200, "paid", StatePaid},
+		{201, "payment_confirmed", StatePaid},
+		{202, "assembling", StatePaid},
+		{300, "shipped", StateShipped},
+		{301, "in_transit", StateShipped},
+		{302, "at_pickup_point", StateShipped},
+		{400, "delivered", StateDelivered},
+		{500, "cancelled", StateCancelled},
+		{501, "cancelled_by_seller", StateCancelled},
+		{600, "returned", StateReturned},
+	} {
+		statuses[s.Code] = s
+	}
+}
+
+// LookupStatus ищет код в реестре.
+func LookupStatus(code ItemStatus) (StatusInfo, bool) {
+	s, ok := statuses[code]
+	return s, ok
+}
+
+func (s ItemStatus) Known() bool {
+	_, ok := statuses[s]
+	return ok
+}
+
+// Name — имя статуса ("assembling") или "unknown(999)".
+func (s ItemStatus) Name() string {
+	if info, ok := statuses[s]; ok {
+		return info.Name
+	}
+	return fmt.Sprintf("unknown(%d)", int(s))
+}
+
+// State — состояние, которому соответствует код; для неизвестных — "".
+func (s ItemStatus) State() OrderState {
+	return statuses[s].State
+}
+
+// CanTransition проверяет переход from → to. Пустой from — заказа ещё нет.
+// Повтор того же состояния разрешён всегда (переотправка без изменений).
+// Вперёд по progress можно и через ступень (промежуточное событие могло
+// не дойти), назад — нельзя. Отмена — только до отправки, возврат — только
+// после; из отмены и возврата выхода нет.
+func CanTransition(from, to OrderState) bool {
+	if from == "" || from == to {
+		return true
+	}
+	switch to {
+	case StateCancelled:
+		return from == StateCreated || from == StatePaid
+	case StateReturned:
+		return from == StateShipped || from == StateDelivered
+	}
+	pf, okFrom := progress[from]
+	pt, okTo := progress[to]
+	return okFrom && okTo && pt > pf
+}
+
+// CheckTransition — то же, что CanTransition, но с ошибкой для логов и DLQ.
+func CheckTransition(from, to OrderState) error {
+	if CanTransition(from, to) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s -> %s", ErrIllegalTransition, from, to)
+}
+
+// порядок «продвижения» заказа; отмена и возврат считаются отдельно
+var progress = map[OrderState]int{
+	StateCreated:   0,
+	StatePaid:      1,
+	StateShipped:   2,
+	StateDelivered: 3,
+}
+
+// State выводит состояние заказа из товаров:
+//   - все товары отменены → cancelled;
+//   - все не отменённые возвращены → returned;
+//   - иначе — самое «отстающее» состояние среди остальных товаров
+//     (заказ отправлен, только когда отправлены все его товары).
+//
+// Заказ без товаров считается созданным. Коды товаров должны быть из
+// реестра (заказ прошёл storage.ValidateOrder).
+func (o Order) State() OrderState {
+	var (
+		active   []OrderState
+		returned int
+	)
+	for _, it := range o.Items {
+		switch st := it.Status.State(); st {
+		case StateCancelled:
+		case StateReturned:
+			returned++
+		default:
+			active = append(active, st)
+		}
+	}
+
+	switch {
+	case len(o.Items) == 0:
+		return StateCreated
+	case len(active) == 0 && returned == 0:
+		return StateCancelled
+	case len(active) == 0:
+		return StateReturned
+	}
+
+	min := active[0]
+	for _, st := range active[1:] {
+		if progress[st] < progress[min] {
+			min = st
+		}
+	}
+	return min
+}
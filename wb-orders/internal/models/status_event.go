@@ -0,0 +1,32 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// StatusEvent — событие из топика order-status: у товара заказа сменился
+// статус. Товар ищется по rid, если он задан, иначе по chrt_id.
+type StatusEvent struct {
+	OrderUID  string     `json:"order_uid"`
+	ChrtID    int        `json:"chrt_id,omitempty"`
+	RID       string     `json:"rid,omitempty"`
+	Status    ItemStatus `json:"status"`
+	Timestamp time.Time  `json:"timestamp"`
+}
+
+// Validate — базовые проверки события до похода в БД.
+func (e StatusEvent) Validate() error {
+	switch {
+	case e.OrderUID == "":
+		return errors.New("empty order_uid")
+	case e.ChrtID == 0 && e.RID == "":
+		return errors.New("either chrt_id or rid is required")
+	case !e.Status.Known():
+		return fmt.Errorf("unknown status %d", e.Status)
+	case e.Timestamp.IsZero():
+		return errors.New("empty timestamp")
+	}
+	return nil
+}
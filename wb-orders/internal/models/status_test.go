@@ -0,0 +1,83 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestOrderState(t *testing.T) {
+	order := func(codes ...ItemStatus) Order {
+		var o Order
+		for _, c := range codes {
+			o.Items = append(o.Items, Item{Status: c})
+		}
+		return o
+	}
+
+	for _, tc := range []struct {
+		name  string
+		order Order
+		want  OrderState
+	}{
+		{"no items", order(), StateCreated},
+		{"single created", order(100), StateCreated},
+		{"single paid", order(202), StatePaid},
+		{"single delivered", order(400), StateDelivered},
+		{"slowest item wins", order(400, 301, 202), StatePaid},
+		{"shipped when all shipped", order(300, 302), StateShipped},
+		{"cancelled items ignored", order(500, 400), StateDelivered},
+		{"all cancelled", order(500, 501), StateCancelled},
+		{"returned items ignored", order(600, 300), StateShipped},
+		{"all returned", order(600, 600), StateReturned},
+		{"cancelled and returned", order(500, 600), StateReturned},
+	} {
+		if got := tc.order.State(); got != tc.want {
+			t.Errorf("%s: State() = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestCanTransition(t *testing.T) {
+	allowed := map[[2]OrderState]bool{
+		{StateCreated, StatePaid}:       true,
+		{StateCreated, StateShipped}:    true,
+		{StateCreated, StateDelivered}:  true,
+		{StateCreated, StateCancelled}:  true,
+		{StatePaid, StateShipped}:       true,
+		{StatePaid, StateDelivered}:     true,
+		{StatePaid, StateCancelled}:     true,
+		{StateShipped, StateDelivered}:  true,
+		{StateShipped, StateReturned}:   true,
+		{StateDelivered, StateReturned}: true,
+	}
+	all := []OrderState{StateCreated, StatePaid, StateShipped, StateDelivered, StateCancelled, StateReturned}
+
+	for _, from := range all {
+		for _, to := range all {
+			want := from == to || allowed[[2]OrderState{from, to}]
+			if got := CanTransition(from, to); got != want {
+				t.Errorf("CanTransition(%s, %s) = %v, want %v", from, to, got, want)
+			}
+			err := CheckTransition(from, to)
+			if want != (err == nil) {
+				t.Errorf("CheckTransition(%s, %s) = %v", from, to, err)
+			}
+			if err != nil && !errors.Is(err, ErrIllegalTransition) {
+				t.Errorf("CheckTransition(%s, %s) = %v, want ErrIllegalTransition", from, to, err)
+			}
+		}
+		// заказа ещё нет — можно любое состояние
+		if !CanTransition("", from) {
+			t.Errorf("CanTransition(\"\", %s) = false", from)
+		}
+	}
+}
+
+func TestItemStatusRegistry(t *testing.T) {
+	if !ItemStatus(202).Known() || ItemStatus(202).Name() != "assembling" || ItemStatus(202).State() != StatePaid {
+		t.Error("202 is not assembling/paid")
+	}
+	if ItemStatus(999).Known() || ItemStatus(999).Name() != "unknown(999)" || ItemStatus(999).State() != "" {
+		t.Error("999 should be unknown")
+	}
+}
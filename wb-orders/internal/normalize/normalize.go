@@ -0,0 +1,174 @@
+// internal/normalize/normalize.go
+package normalize
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+
+	"wb-orders/internal/models"
+)
+
+// Имена правил — они же ключи счётчиков в Stats и в order_audit.fixes.
+const (
+	RuleTrimSpace     = "trim_space"
+	RuleLowerEmail    = "lower_email"
+	RulePhoneE164     = "phone_e164"
+	RuleUpperCurrency = "upper_currency"
+	RuleRegionCase    = "region_case"
+	RuleCityCase      = "city_case"
+)
+
+// Normalizer приводит входящий заказ к каноничному виду до UpsertOrder
+// и считает, сколько раз сработало каждое правило.
+type Normalizer struct {
+	mu     sync.Mutex
+	counts map[string]uint64
+}
+
+func New() *Normalizer {
+	return &Normalizer{counts: make(map[string]uint64)}
+}
+
+// Apply возвращает нормализованную копию заказа и список сработавших правил
+// (каждое правило — не больше одного раза, в порядке применения).
+func (n *Normalizer) Apply(o models.Order) (models.Order, []string) {
+	var fixes []string
+	mark := func(rule string, changed bool) {
+		if !changed {
+			return
+		}
+		for _, f := range fixes {
+			if f == rule {
+				return
+			}
+		}
+		fixes = append(fixes, rule)
+	}
+
+	// 1) Пробелы по краям во всех строках
+	o.Items = append([]models.Item(nil), o.Items...)
+	for _, s := range stringFields(&o) {
+		mark(RuleTrimSpace, trim(s))
+	}
+
+	// 2) Контакты
+	d := &o.Delivery
+	mark(RuleLowerEmail, set(&d.Email, strings.ToLower(d.Email)))
+	mark(RulePhoneE164, set(&d.Phone, phoneE164(d.Phone, trunk8(o))))
+
+	// 3) Валюта
+	mark(RuleUpperCurrency, set(&o.Payment.Currency, strings.ToUpper(o.Payment.Currency)))
+
+	// 4) Регион и город
+	mark(RuleRegionCase, set(&d.Region, canonicalCase(d.Region)))
+	mark(RuleCityCase, set(&d.City, canonicalCase(d.City)))
+
+	if len(fixes) > 0 {
+		n.mu.Lock()
+		for _, f := range fixes {
+			n.counts[f]++
+		}
+		n.mu.Unlock()
+	}
+	return o, fixes
+}
+
+// Stats — сколько заказов исправило каждое правило с момента старта.
+func (n *Normalizer) Stats() map[string]uint64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	out := make(map[string]uint64, len(n.counts))
+	for k, v := range n.counts {
+		out[k] = v
+	}
+	return out
+}
+
+func stringFields(o *models.Order) []*string {
+	d, p := &o.Delivery, &o.Payment
+	fs := []*string{
+		&o.OrderUID, &o.TrackNumber, &o.Entry, &o.Locale, &o.InternalSignature,
+		&o.CustomerID, &o.DeliveryService, &o.ShardKey, &o.OofShard,
+		&d.Name, &d.Phone, &d.Zip, &d.City, &d.Address, &d.Region, &d.Email,
+		&p.Transaction, &p.RequestID, &p.Currency, &p.Provider, &p.Bank,
+	}
+	for i := range o.Items {
+		it := &o.Items[i]
+		fs = append(fs, &it.TrackNumber, &it.RID, &it.Name, &it.Size, &it.Brand)
+	}
+	return fs
+}
+
+func set(dst *string, v string) bool {
+	if *dst == v {
+		return false
+	}
+	*dst = v
+	return true
+}
+
+func trim(s *string) bool {
+	return set(s, strings.TrimSpace(*s))
+}
+
+// trunk8 — заказ из России или Казахстана (валюта или локаль): там
+// номер пишут через 8 вместо +7. У остальных 11 цифр с 8 в начале —
+// обычный международный номер без плюса (82… — Корея).
+func trunk8(o models.Order) bool {
+	switch strings.ToUpper(o.Payment.Currency) {
+	case "RUB", "KZT":
+		return true
+	}
+	lang, _, _ := strings.Cut(strings.ToLower(o.Locale), "-")
+	lang, _, _ = strings.Cut(lang, "_")
+	return lang == "ru" || lang == "kk"
+}
+
+// phoneE164: "+7 (999) 123-45-67", "0079991234567" → "+79991234567";
+// "89991234567" → "+79991234567", только если trunk8 (заказ из RU/KZ).
+// Если после чистки не получилось 8–15 цифр — оставляем как было.
+func phoneE164(s string, trunk8 bool) string {
+	if s == "" {
+		return s
+	}
+	var digits strings.Builder
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+	num := digits.String()
+	switch {
+	case strings.HasPrefix(s, "+"):
+	case strings.HasPrefix(num, "00"):
+		num = num[2:]
+	case trunk8 && len(num) == 11 && num[0] == '8':
+		// российский формат 8XXXXXXXXXX
+		num = "7" + num[1:]
+	}
+	if len(num) < 8 || len(num) > 15 || num[0] == '0' {
+		return s
+	}
+	return "+" + num
+}
+
+// canonicalCase: "KIRYAT  MOZKIN" / "kiryat mozkin" → "Kiryat Mozkin".
+// Смешанный регистр ("McAllen") считаем осознанным и не трогаем,
+// только схлопываем повторные пробелы.
+func canonicalCase(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if s != strings.ToLower(s) && s != strings.ToUpper(s) {
+		return s
+	}
+
+	rs := []rune(strings.ToLower(s))
+	start := true
+	for i, r := range rs {
+		if start && unicode.IsLetter(r) {
+			rs[i] = unicode.ToUpper(r)
+		}
+		start = r == ' ' || r == '-' || r == '.'
+	}
+	return string(rs)
+}
@@ -0,0 +1,132 @@
+package normalize
+
+import (
+	"slices"
+	"testing"
+
+	"wb-orders/internal/models"
+)
+
+func TestPhoneE164(t *testing.T) {
+	for _, tc := range []struct {
+		in     string
+		trunk8 bool
+		want   string
+	}{
+		{"+7 (999) 123-45-67", false, "+79991234567"},
+		{"89991234567", true, "+79991234567"},
+		{"8 (999) 123-45-67", true, "+79991234567"},
+		{"0079991234567", false, "+79991234567"},
+		{"00972501234567", false, "+972501234567"},
+		{"+972-50-123-4567", false, "+972501234567"},
+		// без RU/KZ 8 в начале — код страны, а не «восьмёрка»
+		{"82101234567", false, "+82101234567"},
+		{"89991234567", false, "+89991234567"},
+		{"+8 999 123 45 67", true, "+89991234567"}, // с плюсом — как есть
+		{"", true, ""},
+		{"1234567", false, "1234567"},                   // меньше 8 цифр
+		{"1234567890123456", false, "1234567890123456"}, // больше 15
+		{"0501234567", false, "0501234567"},             // местный номер без кода страны
+		{"n/a", false, "n/a"},
+	} {
+		if got := phoneE164(tc.in, tc.trunk8); got != tc.want {
+			t.Errorf("phoneE164(%q, %v) = %q, want %q", tc.in, tc.trunk8, got, tc.want)
+		}
+	}
+}
+
+func TestTrunk8(t *testing.T) {
+	for _, tc := range []struct {
+		currency, locale string
+		want             bool
+	}{
+		{"RUB", "en", true},
+		{"kzt", "", true},
+		{"USD", "ru", true},
+		{"USD", "ru-RU", true},
+		{"USD", "kk_KZ", true},
+		{"USD", "en", false},
+		{"KRW", "ko", false},
+		{"", "", false},
+	} {
+		o := models.Order{Locale: tc.locale, Payment: models.Payment{Currency: tc.currency}}
+		if got := trunk8(o); got != tc.want {
+			t.Errorf("trunk8(currency=%q locale=%q) = %v, want %v", tc.currency, tc.locale, got, tc.want)
+		}
+	}
+}
+
+func TestCanonicalCase(t *testing.T) {
+	for in, want := range map[string]string{
+		"KIRYAT  MOZKIN":      "Kiryat Mozkin",
+		"kiryat mozkin":       "Kiryat Mozkin",
+		"санкт-петербург":     "Санкт-Петербург",
+		"ST. PETERSBURG":      "St. Petersburg",
+		"McAllen":             "McAllen",
+		"  Нижний   Новгород": "Нижний Новгород",
+		"":                    "",
+	} {
+		if got := canonicalCase(in); got != want {
+			t.Errorf("canonicalCase(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	n := New()
+	in := models.Order{
+		OrderUID: " o1 ",
+		Locale:   "en",
+		Delivery: models.Delivery{
+			Phone:  "82101234567",
+			Email:  " Test@Gmail.COM",
+			City:   "SEOUL",
+			Region: "seoul",
+		},
+		Payment: models.Payment{Currency: "krw"},
+		Items:   []models.Item{{Brand: " Vivienne Sabo "}},
+	}
+	out, fixes := n.Apply(in)
+
+	if out.OrderUID != "o1" || out.Items[0].Brand != "Vivienne Sabo" {
+		t.Errorf("trim: %q %q", out.OrderUID, out.Items[0].Brand)
+	}
+	if out.Delivery.Email != "test@gmail.com" {
+		t.Errorf("email = %q", out.Delivery.Email)
+	}
+	if out.Delivery.Phone != "+82101234567" {
+		t.Errorf("phone = %q", out.Delivery.Phone)
+	}
+	if out.Payment.Currency != "KRW" {
+		t.Errorf("currency = %q", out.Payment.Currency)
+	}
+	if out.Delivery.City != "Seoul" || out.Delivery.Region != "Seoul" {
+		t.Errorf("city/region = %q/%q", out.Delivery.City, out.Delivery.Region)
+	}
+	want := []string{RuleTrimSpace, RuleLowerEmail, RulePhoneE164, RuleUpperCurrency, RuleRegionCase, RuleCityCase}
+	if !slices.Equal(fixes, want) {
+		t.Errorf("fixes = %v, want %v", fixes, want)
+	}
+	if in.Items[0].Brand != " Vivienne Sabo " {
+		t.Error("Apply changed the caller's items")
+	}
+
+	// уже каноничный заказ — без правок
+	if _, fixes := n.Apply(out); len(fixes) != 0 {
+		t.Errorf("second pass fixes = %v", fixes)
+	}
+	if st := n.Stats(); st[RuleTrimSpace] != 1 || st[RulePhoneE164] != 1 {
+		t.Errorf("stats = %v", st)
+	}
+}
+
+func TestApplyRussianTrunkPrefix(t *testing.T) {
+	o := models.Order{
+		Delivery: models.Delivery{Phone: "8 (999) 123-45-67"},
+		Payment:  models.Payment{Currency: "RUB"},
+	}
+	out, _ := New().Apply(o)
+	if out.Delivery.Phone != "+79991234567" {
+		t.Errorf("phone = %q", out.Delivery.Phone)
+	}
+}
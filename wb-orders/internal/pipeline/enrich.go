@@ -0,0 +1,109 @@
+// internal/pipeline/enrich.go
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"wb-orders/internal/ingest"
+	"wb-orders/internal/models"
+)
+
+// AttrEnrichment — ключ Item.Attrs, под которым звено enrich кладёт Enrichment.
+const AttrEnrichment = "enrichment"
+
+// Флаги проверок (Enrichment.Flags). Заказ с ошибками до enrich не доходит,
+// поэтому флаги — о том, что валидацией не отклоняется.
+const (
+	FlagNormalized    = "normalized"     // нормализация что-то поправила
+	FlagKnownCurrency = "known_currency" // валюта есть в реестре (иначе — 2 знака по умолчанию)
+	FlagHasEmail      = "has_email"
+	FlagHasPhone      = "has_phone"
+	FlagCustomFee     = "custom_fee"    // есть пошлина
+	FlagFreeDelivery  = "free_delivery" // доставка бесплатная
+)
+
+// Enrichment — вычисляемые поля заказа для нижестоящих сервисов.
+type Enrichment struct {
+	ItemCount   int               `json:"item_count"`
+	State       models.OrderState `json:"state"`
+	StatusNames []string          `json:"status_names"` // по товарам, в порядке items
+	Total       string            `json:"total"`        // amount в основных единицах: "18.17"
+	Currency    string            `json:"currency"`
+	Flags       map[string]bool   `json:"flags"`
+}
+
+// EnrichedOrder — то, что уходит в выходной топик: заказ как есть плюс
+// поле "enrichment".
+type EnrichedOrder struct {
+	models.Order
+	Enrichment Enrichment `json:"enrichment"`
+}
+
+// Publisher — куда звено publish отправляет обогащённый заказ (kafka.Output).
+type Publisher interface {
+	Publish(ctx context.Context, key string, value []byte, meta ingest.Meta) error
+}
+
+// Enrich считает поля Enrichment и кладёт их в Attrs. Ставится после
+// validate: суммы и статусы уже проверены.
+func Enrich() OrderProcessor {
+	return Func(StageEnrich, func(ctx context.Context, it *Item, next Handler) error {
+		it.Set(AttrEnrichment, enrich(it))
+		return next(ctx, it)
+	})
+}
+
+func enrich(it *Item) Enrichment {
+	o := it.Order
+	names := make([]string, len(o.Items))
+	for i, item := range o.Items {
+		names[i] = item.Status.Name()
+	}
+	_, knownCurrency := models.LookupCurrency(o.Payment.Currency)
+	return Enrichment{
+		ItemCount:   len(o.Items),
+		State:       o.State(),
+		StatusNames: names,
+		Total:       o.Payment.Amount.Major(),
+		Currency:    o.Payment.Currency,
+		Flags: map[string]bool{
+			FlagNormalized:    len(it.Fixes) > 0,
+			FlagKnownCurrency: knownCurrency,
+			FlagHasEmail:      o.Delivery.Email != "",
+			FlagHasPhone:      o.Delivery.Phone != "",
+			FlagCustomFee:     o.Payment.CustomFee.Minor > 0,
+			FlagFreeDelivery:  o.Payment.DeliveryCost.Minor == 0,
+		},
+	}
+}
+
+// EnrichmentOf — Enrichment заказа; если звена enrich в цепочке нет,
+// считается на месте.
+func EnrichmentOf(it *Item) Enrichment {
+	if e, ok := it.Attrs[AttrEnrichment].(Enrichment); ok {
+		return e
+	}
+	return enrich(it)
+}
+
+// Publish отправляет обогащённый заказ (ключ — order_uid) после записи
+// в БД. Повторы недоступного топика — на стороне Publisher (kafka.Output
+// ждёт, пока запись пройдёт). Если публикацию прервали (остановка), сообщение
+// не коммитится; при офсетах в Postgres запись при повторной доставке
+// пропускается как уже применённая, но звенья после записи консьюмер
+// прогоняет и тогда — заказ уйдёт снова (получатели видят его не меньше
+// одного раза).
+func Publish(pub Publisher) OrderProcessor {
+	return Func(StagePublish, func(ctx context.Context, it *Item, next Handler) error {
+		data, err := json.Marshal(EnrichedOrder{Order: it.Order, Enrichment: EnrichmentOf(it)})
+		if err != nil {
+			return fmt.Errorf("publish id=%s: %w", it.Order.OrderUID, err)
+		}
+		if err := pub.Publish(ctx, it.Order.OrderUID, data, it.Meta); err != nil {
+			return fmt.Errorf("publish id=%s: %w", it.Order.OrderUID, err)
+		}
+		return next(ctx, it)
+	})
+}
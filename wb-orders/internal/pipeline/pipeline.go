@@ -0,0 +1,260 @@
+// internal/pipeline/pipeline.go
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"wb-orders/internal/ingest"
+	"wb-orders/internal/models"
+)
+
+// Имена встроенных звеньев. Они же — стадии отказа (заголовок dlq-stage).
+const (
+	StageDecode     = "decode"
+	StageVersion    = "version" // только отказ: неизвестная версия схемы
+	StageNormalize  = "normalize"
+	StageKey        = "key"
+	StageValidate   = "validate"
+	StageEnrich     = "enrich"
+	StageTransition = "transition" // только отказ: недопустимая смена статуса
+	// StageStore — запись в БД, граница фаз. Её делает тот, кто гонит
+	// цепочку (консьюмер — с повторами, офсетами и пакетами), поэтому
+	// звена с таким именем нет, но к нему можно привязываться.
+	StageStore   = "store"
+	StageCache   = "cache"
+	StagePublish = "publish" // только если задан выходной топик (KAFKA_TOPIC_OUTPUT)
+	StageLog     = "log"
+)
+
+// Phase — где стоит звено относительно записи в БД.
+type Phase int
+
+const (
+	// BeforeStore — разбор, валидация, обогащение, фильтры.
+	BeforeStore Phase = iota
+	// AfterStore — кэш, дополнительные приёмники, лог.
+	AfterStore
+)
+
+var (
+	ErrUnknownStage   = errors.New("unknown pipeline stage")
+	ErrDuplicateStage = errors.New("duplicate pipeline stage")
+	// ErrBadStageName — пустое имя или зарезервированное "store".
+	ErrBadStageName = errors.New("bad pipeline stage name")
+)
+
+// Item — заказ, идущий по цепочке.
+type Item struct {
+	Raw   []byte      // исходное сообщение
+	Meta  ingest.Meta // откуда пришло
+	Order models.Order
+	Fixes []string       // что поправила нормализация
+	Attrs map[string]any // что добавили звенья (обогащение)
+}
+
+// Set кладёт атрибут заказа (для следующих звеньев и приёмников).
+func (it *Item) Set(key string, v any) {
+	if it.Attrs == nil {
+		it.Attrs = make(map[string]any)
+	}
+	it.Attrs[key] = v
+}
+
+// Handler — остаток цепочки после текущего звена.
+type Handler func(ctx context.Context, it *Item) error
+
+// OrderProcessor — звено цепочки. Делает своё до и/или после next.
+// Не вызвать next и вернуть nil — отфильтровать заказ (в BeforeStore
+// это значит «не записывать», см. Skip). Ошибка данных — Reject,
+// любая другая ошибка считается временной: сообщение не подтверждается.
+type OrderProcessor interface {
+	Name() string
+	Process(ctx context.Context, it *Item, next Handler) error
+}
+
+type funcProcessor struct {
+	name string
+	fn   func(ctx context.Context, it *Item, next Handler) error
+}
+
+func (p funcProcessor) Name() string { return p.name }
+
+func (p funcProcessor) Process(ctx context.Context, it *Item, next Handler) error {
+	return p.fn(ctx, it, next)
+}
+
+// Func — звено из функции.
+func Func(name string, fn func(ctx context.Context, it *Item, next Handler) error) OrderProcessor {
+	return funcProcessor{name: name, fn: fn}
+}
+
+// RejectError — заказ не принят на стадии Stage: повтор без правки
+// не поможет (у консьюмера — DLQ и карантин).
+type RejectError struct {
+	Stage string
+	Err   error
+}
+
+func (e *RejectError) Error() string { return e.Err.Error() }
+func (e *RejectError) Unwrap() error { return e.Err }
+
+func Reject(stage string, err error) error {
+	return &RejectError{Stage: stage, Err: err}
+}
+
+// SkipError — заказ отфильтрован: не записывается, но и ошибкой не считается.
+type SkipError struct {
+	Reason string
+}
+
+func (e *SkipError) Error() string { return "skipped: " + e.Reason }
+
+// Skip — для фильтров, которым важна причина в метриках. Звено, просто
+// не вызвавшее next, даёт причину "filtered".
+func Skip(reason string) error {
+	return &SkipError{Reason: reason}
+}
+
+// Chain — цепочка звеньев двух фаз. Регистрировать звенья можно в любой
+// момент: каждый прогон берёт снимок цепочки.
+type Chain struct {
+	mu     sync.RWMutex
+	phases [2][]OrderProcessor
+}
+
+func New() *Chain {
+	return &Chain{}
+}
+
+// Use добавляет звено в конец фазы.
+func (c *Chain) Use(phase Phase, p OrderProcessor) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.checkName(p.Name()); err != nil {
+		return err
+	}
+	c.phases[phase] = append(c.phases[phase], p)
+	return nil
+}
+
+// InsertBefore ставит звено перед звеном anchor. Перед "store" — в конец
+// BeforeStore.
+func (c *Chain) InsertBefore(anchor string, p OrderProcessor) error {
+	return c.insert(anchor, p, 0)
+}
+
+// InsertAfter ставит звено после звена anchor. После "store" — в начало
+// AfterStore.
+func (c *Chain) InsertAfter(anchor string, p OrderProcessor) error {
+	return c.insert(anchor, p, 1)
+}
+
+func (c *Chain) insert(anchor string, p OrderProcessor, shift int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.checkName(p.Name()); err != nil {
+		return err
+	}
+	if anchor == StageStore {
+		if shift == 0 {
+			c.phases[BeforeStore] = append(c.phases[BeforeStore], p)
+		} else {
+			c.phases[AfterStore] = slices.Insert(c.phases[AfterStore], 0, p)
+		}
+		return nil
+	}
+	for ph, procs := range c.phases {
+		for i, q := range procs {
+			if q.Name() == anchor {
+				c.phases[ph] = slices.Insert(procs, i+shift, p)
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w: %q", ErrUnknownStage, anchor)
+}
+
+// Remove убирает звено (например, встроенное, чтобы заменить своим).
+func (c *Chain) Remove(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for ph, procs := range c.phases {
+		for i, q := range procs {
+			if q.Name() == name {
+				c.phases[ph] = slices.Delete(procs, i, i+1)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *Chain) checkName(name string) error {
+	if name == "" || name == StageStore {
+		return fmt.Errorf("%w: %q", ErrBadStageName, name)
+	}
+	for _, procs := range c.phases {
+		for _, q := range procs {
+			if q.Name() == name {
+				return fmt.Errorf("%w: %q", ErrDuplicateStage, name)
+			}
+		}
+	}
+	return nil
+}
+
+// Stages — имена звеньев по порядку, "store" — на месте записи в БД.
+func (c *Chain) Stages() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var out []string
+	for _, p := range c.phases[BeforeStore] {
+		out = append(out, p.Name())
+	}
+	out = append(out, StageStore)
+	for _, p := range c.phases[AfterStore] {
+		out = append(out, p.Name())
+	}
+	return out
+}
+
+// Prepare прогоняет BeforeStore. nil — заказ можно записывать;
+// *RejectError, *SkipError или временная ошибка — нельзя.
+func (c *Chain) Prepare(ctx context.Context, it *Item) error {
+	reached, err := c.run(ctx, BeforeStore, it)
+	if err == nil && !reached {
+		return Skip("filtered")
+	}
+	return err
+}
+
+// Stored прогоняет AfterStore — после успешной записи в БД.
+func (c *Chain) Stored(ctx context.Context, it *Item) error {
+	_, err := c.run(ctx, AfterStore, it)
+	return err
+}
+
+// run собирает снимок фазы в одну функцию и вызывает её. reached — дошли
+// ли до конца фазы (никто не отфильтровал).
+func (c *Chain) run(ctx context.Context, phase Phase, it *Item) (reached bool, err error) {
+	c.mu.RLock()
+	procs := slices.Clone(c.phases[phase])
+	c.mu.RUnlock()
+
+	h := Handler(func(context.Context, *Item) error {
+		reached = true
+		return nil
+	})
+	for i := len(procs) - 1; i >= 0; i-- {
+		p, next := procs[i], h
+		h = func(ctx context.Context, it *Item) error {
+			return p.Process(ctx, it, next)
+		}
+	}
+	err = h(ctx, it)
+	return reached, err
+}
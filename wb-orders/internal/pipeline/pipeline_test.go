@@ -0,0 +1,180 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// trace — звено, записывающее своё имя до и после next.
+func trace(name string, log *[]string) OrderProcessor {
+	return Func(name, func(ctx context.Context, it *Item, next Handler) error {
+		*log = append(*log, name)
+		err := next(ctx, it)
+		*log = append(*log, "/"+name)
+		return err
+	})
+}
+
+func testChain(log *[]string) *Chain {
+	c := New()
+	for _, name := range []string{"a", "b"} {
+		if err := c.Use(BeforeStore, trace(name, log)); err != nil {
+			panic(err)
+		}
+	}
+	if err := c.Use(AfterStore, trace("c", log)); err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func TestChainRegistration(t *testing.T) {
+	var log []string
+	c := testChain(&log)
+	steps := []struct {
+		name string
+		do   func() error
+	}{
+		{"before a", func() error { return c.InsertBefore("a", trace("a0", &log)) }},
+		{"after a", func() error { return c.InsertAfter("a", trace("a1", &log)) }},
+		{"before store", func() error { return c.InsertBefore(StageStore, trace("s0", &log)) }},
+		{"after store", func() error { return c.InsertAfter(StageStore, trace("s1", &log)) }},
+		{"after c", func() error { return c.InsertAfter("c", trace("c1", &log)) }},
+	}
+	for _, s := range steps {
+		if err := s.do(); err != nil {
+			t.Fatalf("%s: %v", s.name, err)
+		}
+	}
+	want := []string{"a0", "a", "a1", "b", "s0", StageStore, "s1", "c", "c1"}
+	if got := c.Stages(); !slices.Equal(got, want) {
+		t.Fatalf("Stages = %v, want %v", got, want)
+	}
+
+	if !c.Remove("a1") || c.Remove("a1") {
+		t.Error("Remove must succeed once")
+	}
+	want = slices.DeleteFunc(want, func(s string) bool { return s == "a1" })
+	if got := c.Stages(); !slices.Equal(got, want) {
+		t.Errorf("after Remove: Stages = %v, want %v", got, want)
+	}
+	// Имя освободилось — звено можно поставить заново
+	if err := c.Use(AfterStore, trace("a1", &log)); err != nil {
+		t.Errorf("Use after Remove: %v", err)
+	}
+}
+
+func TestChainRegistrationErrors(t *testing.T) {
+	var log []string
+	c := testChain(&log)
+	cases := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"duplicate", c.Use(AfterStore, trace("a", &log)), ErrDuplicateStage},
+		{"duplicate insert", c.InsertAfter("c", trace("b", &log)), ErrDuplicateStage},
+		{"empty", c.Use(BeforeStore, trace("", &log)), ErrBadStageName},
+		{"store", c.InsertBefore("a", trace(StageStore, &log)), ErrBadStageName},
+		{"unknown anchor", c.InsertBefore("nope", trace("x", &log)), ErrUnknownStage},
+	}
+	for _, tc := range cases {
+		if !errors.Is(tc.err, tc.want) {
+			t.Errorf("%s: err = %v, want %v", tc.name, tc.err, tc.want)
+		}
+	}
+	if got, want := c.Stages(), []string{"a", "b", StageStore, "c"}; !slices.Equal(got, want) {
+		t.Errorf("failed registration changed the chain: %v", got)
+	}
+}
+
+func TestChainRunsPhasesInOrder(t *testing.T) {
+	var log []string
+	c := testChain(&log)
+	it := &Item{}
+	if err := c.Prepare(context.Background(), it); err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	if err := c.Stored(context.Background(), it); err != nil {
+		t.Fatalf("Stored: %v", err)
+	}
+	want := []string{"a", "b", "/b", "/a", "c", "/c"}
+	if !slices.Equal(log, want) {
+		t.Errorf("run order = %v, want %v", log, want)
+	}
+}
+
+func TestChainFilter(t *testing.T) {
+	var log []string
+	drop := Func("drop", func(context.Context, *Item, Handler) error { return nil })
+	reason := Func("reason", func(context.Context, *Item, Handler) error { return Skip("test order") })
+
+	for _, tc := range []struct {
+		p    OrderProcessor
+		want string
+	}{{drop, "filtered"}, {reason, "test order"}} {
+		log = nil
+		c := testChain(&log)
+		if err := c.InsertAfter("a", tc.p); err != nil {
+			t.Fatal(err)
+		}
+		err := c.Prepare(context.Background(), &Item{})
+		if got, ok := IsSkip(err); !ok || got != tc.want {
+			t.Errorf("%s: Prepare = %v, want skip %q", tc.p.Name(), err, tc.want)
+		}
+		if _, ok := IsReject(err); ok {
+			t.Errorf("%s: skip reported as reject", tc.p.Name())
+		}
+		if want := []string{"a", "/a"}; !slices.Equal(log, want) {
+			t.Errorf("%s: run = %v, want %v", tc.p.Name(), log, want)
+		}
+	}
+
+	// Фильтр после записи — не ошибка
+	log = nil
+	c := testChain(&log)
+	_ = c.InsertBefore("c", drop)
+	if err := c.Stored(context.Background(), &Item{}); err != nil {
+		t.Errorf("Stored with filter: %v", err)
+	}
+}
+
+func TestChainReject(t *testing.T) {
+	var log []string
+	c := testChain(&log)
+	bad := errors.New("amount mismatch")
+	_ = c.InsertAfter("a", Func("check", func(context.Context, *Item, Handler) error {
+		return Reject("check", bad)
+	}))
+	// Звено выше по цепочке может обернуть ошибку — стадия сохраняется
+	_ = c.InsertBefore("a", Func("wrap", func(ctx context.Context, it *Item, next Handler) error {
+		if err := next(ctx, it); err != nil {
+			return fmt.Errorf("wrap: %w", err)
+		}
+		return nil
+	}))
+
+	err := c.Prepare(context.Background(), &Item{})
+	stage, ok := IsReject(err)
+	if !ok || stage != "check" || !errors.Is(err, bad) {
+		t.Fatalf("Prepare = %v (stage %q), want reject at check", err, stage)
+	}
+	if want := []string{"a", "/a"}; !slices.Equal(log, want) {
+		t.Errorf("run = %v, want %v", log, want)
+	}
+
+	// Временная ошибка — ни отказ, ни фильтр
+	c.Remove("check")
+	tmp := errors.New("db down")
+	_ = c.InsertBefore("b", Func("tmp", func(context.Context, *Item, Handler) error { return tmp }))
+	err = c.Prepare(context.Background(), &Item{})
+	if _, ok := IsReject(err); ok || !errors.Is(err, tmp) {
+		t.Errorf("transient: Prepare = %v", err)
+	}
+	if _, ok := IsSkip(err); ok {
+		t.Error("transient error reported as skip")
+	}
+}
@@ -0,0 +1,126 @@
+// internal/pipeline/stages.go
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"wb-orders/internal/cache"
+	"wb-orders/internal/decode"
+	"wb-orders/internal/ingest"
+	"wb-orders/internal/normalize"
+	"wb-orders/internal/storage"
+)
+
+// Default — встроенная цепочка:
+//
+//	decode → normalize → key → validate → enrich → [store] → cache → log
+//
+// Аудит (Item.Audit) пишется в [store], той же транзакцией, что и заказ.
+// Публикация обогащённого заказа (Publish) — по желанию, после cache.
+func Default(dec *decode.Decoder, norm *normalize.Normalizer, c *cache.LRU) *Chain {
+	ch := New()
+	for _, p := range []OrderProcessor{Decode(dec), Normalize(norm), KeyCheck(), Validate(), Enrich()} {
+		_ = ch.Use(BeforeStore, p)
+	}
+	for _, p := range []OrderProcessor{Cache(c), Log()} {
+		_ = ch.Use(AfterStore, p)
+	}
+	return ch
+}
+
+// Decode — тип содержимого и разбор JSON в заказ (strict/lenient, версия
+// схемы из Meta).
+func Decode(dec *decode.Decoder) OrderProcessor {
+	return Func(StageDecode, func(ctx context.Context, it *Item, next Handler) error {
+		if !ingest.IsJSON(it.Meta.ContentType) {
+			return Reject(StageDecode, fmt.Errorf("unsupported content-type %q", it.Meta.ContentType))
+		}
+		ord, err := dec.Decode(it.Raw, it.Meta.SchemaVersion)
+		if err != nil {
+			stage := StageDecode
+			if errors.Is(err, decode.ErrUnknownVersion) {
+				stage = StageVersion
+			}
+			return Reject(stage, err)
+		}
+		it.Order = ord
+		return next(ctx, it)
+	})
+}
+
+// Normalize — trim, email, телефон, валюта, регион/город; валюта
+// привязывается к суммам.
+func Normalize(norm *normalize.Normalizer) OrderProcessor {
+	return Func(StageNormalize, func(ctx context.Context, it *Item, next Handler) error {
+		var fixes []string
+		it.Order, fixes = norm.Apply(it.Order)
+		it.Order.BindCurrency()
+		it.Fixes = append(it.Fixes, fixes...)
+		return next(ctx, it)
+	})
+}
+
+// KeyCheck — ключ сообщения равен order_uid: по нему идёт
+// партиционирование, расхождение значит, что заказ мог обгонять свои же
+// обновления в другой партиции. Пустой ключ допустим (старые продюсеры).
+func KeyCheck() OrderProcessor {
+	return Func(StageKey, func(ctx context.Context, it *Item, next Handler) error {
+		if key := strings.TrimSpace(it.Meta.Key); key != "" && key != it.Order.OrderUID {
+			return Reject(StageKey, fmt.Errorf("message key %q != order_uid %q", key, it.Order.OrderUID))
+		}
+		return next(ctx, it)
+	})
+}
+
+func Validate() OrderProcessor {
+	return Func(StageValidate, func(ctx context.Context, it *Item, next Handler) error {
+		if err := storage.ValidateOrder(it.Order); err != nil {
+			return Reject(StageValidate, err)
+		}
+		return next(ctx, it)
+	})
+}
+
+// Audit — исходник, правки нормализации и метаданные приёма для записи
+// вместе с заказом (UpsertOrder и соседи).
+func (it *Item) Audit() storage.Audit {
+	return storage.Audit{Raw: it.Raw, Fixes: it.Fixes, Meta: it.Meta}
+}
+
+func Cache(c *cache.LRU) OrderProcessor {
+	return Func(StageCache, func(ctx context.Context, it *Item, next Handler) error {
+		c.Set(it.Order.OrderUID, it.Order)
+		return next(ctx, it)
+	})
+}
+
+// Log — краткий лог сохранённого заказа.
+func Log() OrderProcessor {
+	return Func(StageLog, func(ctx context.Context, it *Item, next Handler) error {
+		log.Printf("[pipeline] stored order: id=%s items=%d topic=%s offset=%d fixes=%v %s",
+			it.Order.OrderUID, len(it.Order.Items), it.Meta.Topic, it.Meta.Offset, it.Fixes, it.Meta)
+		return next(ctx, it)
+	})
+}
+
+// IsReject — ошибка данных (а не временная) и её стадия.
+func IsReject(err error) (string, bool) {
+	var re *RejectError
+	if errors.As(err, &re) {
+		return re.Stage, true
+	}
+	return "", false
+}
+
+// IsSkip — заказ отфильтрован, и причина.
+func IsSkip(err error) (string, bool) {
+	var se *SkipError
+	if errors.As(err, &se) {
+		return se.Reason, true
+	}
+	return "", false
+}
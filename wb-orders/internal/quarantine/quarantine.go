@@ -0,0 +1,125 @@
+// internal/quarantine/quarantine.go
+package quarantine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"wb-orders/internal/ingest"
+	"wb-orders/internal/models"
+	"wb-orders/internal/pipeline"
+	"wb-orders/internal/storage"
+)
+
+// ErrRetryFailed — исправленное (или исходное) сообщение снова не прошло
+// разбор, валидацию или запись. Запись остаётся в карантине.
+var ErrRetryFailed = errors.New("retry failed")
+
+// quarantineStore — то, что нужно Service от storage.Repo.
+type quarantineStore interface {
+	ListQuarantine(ctx context.Context, status string, limit, offset int) ([]storage.QuarantineEntry, error)
+	GetQuarantine(ctx context.Context, id int64) (storage.QuarantineEntry, error)
+	ClaimQuarantine(ctx context.Context, id int64) (storage.QuarantineEntry, error)
+	ReleaseQuarantine(ctx context.Context, id int64, edited []byte) error
+	QuarantineAttempt(ctx context.Context, id int64, edited []byte, retryErr error) error
+	DiscardQuarantine(ctx context.Context, id int64) error
+	UpsertOrder(ctx context.Context, o models.Order, a storage.Audit) error
+}
+
+// Service — работа поддержки с карантином: просмотр, правка и повтор, отброс.
+// Повтор проходит ту же цепочку, что и сообщение из Kafka (pipeline.Chain):
+// звенья до записи, UpsertOrder, звенья после.
+type Service struct {
+	repo  quarantineStore
+	chain *pipeline.Chain
+}
+
+func New(repo *storage.Repo, chain *pipeline.Chain) *Service {
+	return &Service{repo: repo, chain: chain}
+}
+
+func (s *Service) List(ctx context.Context, status string, limit, offset int) ([]storage.QuarantineEntry, error) {
+	return s.repo.ListQuarantine(ctx, status, limit, offset)
+}
+
+func (s *Service) Get(ctx context.Context, id int64) (storage.QuarantineEntry, error) {
+	return s.repo.GetQuarantine(ctx, id)
+}
+
+func (s *Service) Discard(ctx context.Context, id int64) error {
+	if err := s.repo.DiscardQuarantine(ctx, id); err != nil {
+		return err
+	}
+	log.Printf("[quarantine] discarded id=%d", id)
+	return nil
+}
+
+// Retry повторяет сообщение из карантина; edited != nil — правка поддержки,
+// она сохраняется в записи, даже если повтор снова не удался.
+// Ошибка данных — ErrRetryFailed, ошибка БД возвращается как есть.
+//
+// Запись сначала захватывается (ClaimQuarantine), и только потом заказ
+// применяется: два одновременных повтора не запишут его дважды, второй
+// получит storage.ErrNotPending.
+func (s *Service) Retry(ctx context.Context, id int64, edited []byte) (models.Order, error) {
+	e, err := s.repo.ClaimQuarantine(ctx, id)
+	if err != nil {
+		return models.Order{}, err
+	}
+	if edited != nil {
+		e.Edited = edited
+	}
+
+	// Ключ и тип содержимого исходного сообщения не проверяем: поддержка
+	// могла исправить order_uid, а правка всегда JSON.
+	meta := e.Meta
+	meta.Key, meta.ContentType = "", ""
+	ctx = ingest.WithMeta(ctx, meta)
+
+	// Исходник для аудита — то, что реально применили (с правкой)
+	it := &pipeline.Item{Raw: e.Payload(), Meta: meta}
+	dataErr, err := s.apply(ctx, it)
+
+	// Захват снимаем и при отменённом запросе, иначе запись ждала бы ClaimTimeout.
+	done := context.WithoutCancel(ctx)
+	if err != nil {
+		// Временная ошибка попыткой не считается
+		if rErr := s.repo.ReleaseQuarantine(done, id, edited); rErr != nil {
+			return models.Order{}, errors.Join(err, rErr)
+		}
+		return models.Order{}, err
+	}
+	if aErr := s.repo.QuarantineAttempt(done, id, edited, dataErr); aErr != nil {
+		return models.Order{}, errors.Join(dataErr, aErr)
+	}
+	if dataErr != nil {
+		log.Printf("[quarantine] retry id=%d failed: %v", id, dataErr)
+		return models.Order{}, fmt.Errorf("%w: %v", ErrRetryFailed, dataErr)
+	}
+
+	log.Printf("[quarantine] retried id=%d order=%s edited=%t", id, it.Order.OrderUID, e.Edited != nil)
+	return it.Order, nil
+}
+
+// apply — цепочка до записи, UpsertOrder, цепочка после. dataErr — заказ
+// не принят (запись остаётся в карантине), err — временная ошибка.
+func (s *Service) apply(ctx context.Context, it *pipeline.Item) (dataErr, err error) {
+	if err := s.chain.Prepare(ctx, it); err != nil {
+		if stage, ok := pipeline.IsReject(err); ok {
+			return fmt.Errorf("%s: %w", stage, err), nil
+		}
+		if reason, ok := pipeline.IsSkip(err); ok {
+			return fmt.Errorf("skipped: %s", reason), nil
+		}
+		return nil, err
+	}
+	if err := s.repo.UpsertOrder(ctx, it.Order, it.Audit()); err != nil {
+		if storage.IsTransient(err) {
+			return nil, err
+		}
+		return fmt.Errorf("store: %w", err), nil
+	}
+	return nil, s.chain.Stored(ctx, it)
+}
@@ -0,0 +1,245 @@
+package quarantine
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"wb-orders/internal/cache"
+	"wb-orders/internal/decode"
+	"wb-orders/internal/models"
+	"wb-orders/internal/normalize"
+	"wb-orders/internal/pipeline"
+	"wb-orders/internal/storage"
+)
+
+const testOrder = `{
+	"order_uid": "b563feb7b2b84b6test",
+	"track_number": "WBILMTESTTRACK",
+	"entry": "WBIL",
+	"delivery": {"name": "Test Testov", "phone": "+9720000000", "zip": "2639809",
+		"city": "Kiryat Mozkin", "address": "Ploshad Mira 15", "region": "Kraiot", "email": "test@gmail.com"},
+	"payment": {"transaction": "b563feb7b2b84b6test", "request_id": "", "currency": "USD",
+		"provider": "wbpay", "amount": 1817, "payment_dt": 1637907727, "bank": "alpha",
+		"delivery_cost": 1500, "goods_total": 317, "custom_fee": 0},
+	"items": [{"chrt_id": 9934930, "track_number": "WBILMTESTTRACK", "price": 453,
+		"rid": "ab4219087a764ae0btest", "name": "Mascaras", "sale": 30, "size": "0",
+		"total_price": 317, "nm_id": 2389212, "brand": "Vivienne Sabo", "status": 202}],
+	"locale": "en",
+	"internal_signature": "",
+	"customer_id": "test",
+	"delivery_service": "meest",
+	"shardkey": "9",
+	"sm_id": 99,
+	"date_created": "2021-11-26T06:22:19Z",
+	"oof_shard": "1"
+}`
+
+// memStore — карантин в памяти с теми же переходами статусов, что и в БД.
+type memStore struct {
+	mu        sync.Mutex
+	entries   map[int64]*storage.QuarantineEntry
+	upserts   int
+	upsertErr error
+	block     chan struct{} // не nil — UpsertOrder ждёт закрытия
+}
+
+func newMemStore(raw string) *memStore {
+	return &memStore{entries: map[int64]*storage.QuarantineEntry{
+		1: {ID: 1, Stage: "validate", Raw: []byte(raw), Status: storage.QuarantinePending},
+	}}
+}
+
+func (s *memStore) entry(id int64) storage.QuarantineEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *s.entries[id]
+}
+
+func (s *memStore) ListQuarantine(context.Context, string, int, int) ([]storage.QuarantineEntry, error) {
+	return nil, nil
+}
+
+func (s *memStore) GetQuarantine(_ context.Context, id int64) (storage.QuarantineEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[id]
+	if !ok {
+		return storage.QuarantineEntry{}, fmt.Errorf("%w: %d", storage.ErrQuarantineNotFound, id)
+	}
+	return *e, nil
+}
+
+func (s *memStore) ClaimQuarantine(_ context.Context, id int64) (storage.QuarantineEntry, error) {
+	return s.update(id, storage.QuarantinePending, func(e *storage.QuarantineEntry) {
+		e.Status = storage.QuarantineRetrying
+	})
+}
+
+func (s *memStore) ReleaseQuarantine(_ context.Context, id int64, edited []byte) error {
+	_, err := s.update(id, storage.QuarantineRetrying, func(e *storage.QuarantineEntry) {
+		if edited != nil {
+			e.Edited = edited
+		}
+		e.Status = storage.QuarantinePending
+	})
+	return err
+}
+
+func (s *memStore) QuarantineAttempt(_ context.Context, id int64, edited []byte, retryErr error) error {
+	_, err := s.update(id, storage.QuarantineRetrying, func(e *storage.QuarantineEntry) {
+		if edited != nil {
+			e.Edited = edited
+		}
+		e.Attempts++
+		e.Status, e.LastError = storage.QuarantineRetried, ""
+		if retryErr != nil {
+			e.Status, e.LastError = storage.QuarantinePending, retryErr.Error()
+		}
+	})
+	return err
+}
+
+func (s *memStore) DiscardQuarantine(_ context.Context, id int64) error {
+	_, err := s.update(id, storage.QuarantinePending, func(e *storage.QuarantineEntry) {
+		e.Status = storage.QuarantineDiscarded
+	})
+	return err
+}
+
+func (s *memStore) update(id int64, from string, fn func(*storage.QuarantineEntry)) (storage.QuarantineEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[id]
+	if !ok {
+		return storage.QuarantineEntry{}, fmt.Errorf("%w: %d", storage.ErrQuarantineNotFound, id)
+	}
+	if e.Status != from {
+		return storage.QuarantineEntry{}, fmt.Errorf("%w: %d", storage.ErrNotPending, id)
+	}
+	fn(e)
+	return *e, nil
+}
+
+func (s *memStore) UpsertOrder(context.Context, models.Order, storage.Audit) error {
+	if s.block != nil {
+		<-s.block
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.upserts++
+	return s.upsertErr
+}
+
+func newTestService(s *memStore) *Service {
+	chain := pipeline.Default(decode.New(decode.ModeStrict, 0), normalize.New(), cache.NewLRU(10))
+	return &Service{repo: s, chain: chain}
+}
+
+func TestRetryAppliesOrder(t *testing.T) {
+	s := newMemStore(testOrder)
+	ord, err := newTestService(s).Retry(context.Background(), 1, nil)
+	if err != nil {
+		t.Fatalf("Retry: %v", err)
+	}
+	if ord.OrderUID != "b563feb7b2b84b6test" {
+		t.Errorf("order_uid = %q", ord.OrderUID)
+	}
+	e := s.entry(1)
+	if e.Status != storage.QuarantineRetried || e.Attempts != 1 || s.upserts != 1 {
+		t.Errorf("status=%s attempts=%d upserts=%d, want retried/1/1", e.Status, e.Attempts, s.upserts)
+	}
+}
+
+// Второй повтор, пришедший, пока первый пишет заказ, не должен применить
+// его ещё раз.
+func TestConcurrentRetryAppliesOnce(t *testing.T) {
+	s := newMemStore(testOrder)
+	s.block = make(chan struct{})
+	svc := newTestService(s)
+
+	first := make(chan error, 1)
+	go func() {
+		_, err := svc.Retry(context.Background(), 1, nil)
+		first <- err
+	}()
+	deadline := time.After(2 * time.Second)
+	for s.entry(1).Status != storage.QuarantineRetrying {
+		select {
+		case <-deadline:
+			t.Fatal("entry was not claimed")
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	if _, err := svc.Retry(context.Background(), 1, nil); !errors.Is(err, storage.ErrNotPending) {
+		t.Errorf("second Retry err = %v, want ErrNotPending", err)
+	}
+	close(s.block)
+	if err := <-first; err != nil {
+		t.Fatalf("first Retry: %v", err)
+	}
+	if s.upserts != 1 {
+		t.Errorf("upserts = %d, want 1", s.upserts)
+	}
+	if e := s.entry(1); e.Status != storage.QuarantineRetried || e.Attempts != 1 {
+		t.Errorf("status=%s attempts=%d, want retried/1", e.Status, e.Attempts)
+	}
+}
+
+func TestRetryDataErrorKeepsEntryPending(t *testing.T) {
+	s := newMemStore(`{"order_uid": ""}`)
+	svc := newTestService(s)
+
+	if _, err := svc.Retry(context.Background(), 1, nil); !errors.Is(err, ErrRetryFailed) {
+		t.Fatalf("err = %v, want ErrRetryFailed", err)
+	}
+	e := s.entry(1)
+	if e.Status != storage.QuarantinePending || e.Attempts != 1 || e.LastError == "" {
+		t.Errorf("status=%s attempts=%d last_error=%q, want pending/1/non-empty", e.Status, e.Attempts, e.LastError)
+	}
+	if s.upserts != 0 {
+		t.Errorf("upserts = %d, want 0", s.upserts)
+	}
+
+	// Правка поддержки применяется и остаётся в записи
+	if _, err := svc.Retry(context.Background(), 1, []byte(testOrder)); err != nil {
+		t.Fatalf("Retry with edit: %v", err)
+	}
+	e = s.entry(1)
+	if e.Status != storage.QuarantineRetried || e.Attempts != 2 || string(e.Edited) != testOrder {
+		t.Errorf("status=%s attempts=%d edited=%t, want retried/2/true", e.Status, e.Attempts, e.Edited != nil)
+	}
+}
+
+func TestRetryTransientErrorReleasesClaim(t *testing.T) {
+	s := newMemStore(testOrder)
+	s.upsertErr = driver.ErrBadConn
+
+	_, err := newTestService(s).Retry(context.Background(), 1, []byte(testOrder))
+	if !errors.Is(err, driver.ErrBadConn) || errors.Is(err, ErrRetryFailed) {
+		t.Fatalf("err = %v, want the store error", err)
+	}
+	e := s.entry(1)
+	if e.Status != storage.QuarantinePending || e.Attempts != 0 || e.Edited == nil {
+		t.Errorf("status=%s attempts=%d edited=%t, want pending/0/true", e.Status, e.Attempts, e.Edited != nil)
+	}
+}
+
+func TestRetryNotPending(t *testing.T) {
+	s := newMemStore(testOrder)
+	svc := newTestService(s)
+	if err := svc.Discard(context.Background(), 1); err != nil {
+		t.Fatalf("Discard: %v", err)
+	}
+	if _, err := svc.Retry(context.Background(), 1, nil); !errors.Is(err, storage.ErrNotPending) {
+		t.Errorf("Retry discarded: err = %v, want ErrNotPending", err)
+	}
+	if _, err := svc.Retry(context.Background(), 2, nil); !errors.Is(err, storage.ErrQuarantineNotFound) {
+		t.Errorf("Retry missing: err = %v, want ErrQuarantineNotFound", err)
+	}
+}
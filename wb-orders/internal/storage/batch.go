@@ -0,0 +1,293 @@
+// internal/storage/batch.go
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"wb-orders/internal/models"
+)
+
+// maxParams — лимит параметров одного запроса в протоколе Postgres.
+const maxParams = 65535
+
+// -------------------- WRITE: UpsertOrders --------------------
+// Пакетная запись: все заказы одной транзакцией, каждая таблица —
+// многострочными INSERT ... ON CONFLICT. Если один и тот же order_uid
+// встречается в пакете несколько раз, побеждает последний, но переходы
+// проверяются по каждому сообщению по порядку (checkSequence) — как если
+// бы они писались по одному.
+// audits — аудит по каждому заказу пакета (той же длины, что orders,
+// или nil); пишется весь, включая перекрытые дубли: это разные сообщения.
+// positions (может быть nil) — офсеты, которые надо сдвинуть в той же
+// транзакции; ErrAlreadyApplied, если хоть один из них уже применён.
+// Любая ошибка откатывает весь пакет — искать виноватого должен вызывающий.
+func (r *Repo) UpsertOrders(ctx context.Context, orders []models.Order, audits []Audit, positions []Position) error {
+	auditRows := make([][]any, len(audits))
+	for i, a := range audits {
+		auditRows[i] = auditRow(orders[i].OrderUID, a)
+	}
+	all := orders
+	orders = lastByUID(orders)
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		for _, pos := range positions {
+			if err := claimOffset(ctx, tx, pos); err != nil {
+				return err
+			}
+		}
+		if len(orders) == 0 {
+			return nil
+		}
+
+		ids := make([]string, len(orders))
+		for i, o := range orders {
+			ids[i] = o.OrderUID
+		}
+
+		// ----- 0) жизненный цикл
+		prev, err := currentStates(ctx, tx, ids)
+		if err != nil {
+			return fmt.Errorf("current states: %w", err)
+		}
+		if err := checkSequence(prev, all); err != nil {
+			return err
+		}
+
+		// ----- 1) orders
+		rows := make([][]any, len(orders))
+		for i, o := range orders {
+			rows[i] = []any{
+				o.OrderUID, o.TrackNumber, o.Entry, o.Locale, o.InternalSignature,
+				o.CustomerID, o.DeliveryService, o.ShardKey, o.SmID, o.DateCreated, o.OofShard,
+			}
+		}
+		if err := insertRows(ctx, tx,
+			`INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature,
+				customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard)`,
+			rows,
+			`ON CONFLICT (order_uid) DO UPDATE SET
+				track_number       = EXCLUDED.track_number,
+				entry              = EXCLUDED.entry,
+				locale             = EXCLUDED.locale,
+				internal_signature = EXCLUDED.internal_signature,
+				customer_id        = EXCLUDED.customer_id,
+				delivery_service   = EXCLUDED.delivery_service,
+				shardkey           = EXCLUDED.shardkey,
+				sm_id              = EXCLUDED.sm_id,
+				date_created       = EXCLUDED.date_created,
+				oof_shard          = EXCLUDED.oof_shard`,
+		); err != nil {
+			return fmt.Errorf("upsert orders: %w", err)
+		}
+
+		// ----- 2) delivery
+		for i, o := range orders {
+			d := o.Delivery
+			rows[i] = []any{o.OrderUID, d.Name, d.Phone, d.Zip, d.City, d.Address, d.Region, d.Email}
+		}
+		if err := insertRows(ctx, tx,
+			`INSERT INTO delivery (order_uid, name, phone, zip, city, address, region, email)`,
+			rows,
+			`ON CONFLICT (order_uid) DO UPDATE SET
+				name    = EXCLUDED.name,
+				phone   = EXCLUDED.phone,
+				zip     = EXCLUDED.zip,
+				city    = EXCLUDED.city,
+				address = EXCLUDED.address,
+				region  = EXCLUDED.region,
+				email   = EXCLUDED.email`,
+		); err != nil {
+			return fmt.Errorf("upsert delivery: %w", err)
+		}
+
+		// ----- 3) payment
+		for i, o := range orders {
+			p := o.Payment
+			rows[i] = []any{
+				o.OrderUID, p.Transaction, p.RequestID, p.Currency, p.Provider, p.Amount,
+				p.PaymentDT, p.Bank, p.DeliveryCost, p.GoodsTotal, p.CustomFee,
+			}
+		}
+		if err := insertRows(ctx, tx,
+			`INSERT INTO payment (order_uid, transaction, request_id, currency, provider, amount,
+				payment_dt, bank, delivery_cost, goods_total, custom_fee)`,
+			rows,
+			`ON CONFLICT (order_uid) DO UPDATE SET
+				transaction   = EXCLUDED.transaction,
+				request_id    = EXCLUDED.request_id,
+				currency      = EXCLUDED.currency,
+				provider      = EXCLUDED.provider,
+				amount        = EXCLUDED.amount,
+				payment_dt    = EXCLUDED.payment_dt,
+				bank          = EXCLUDED.bank,
+				delivery_cost = EXCLUDED.delivery_cost,
+				goods_total   = EXCLUDED.goods_total,
+				custom_fee    = EXCLUDED.custom_fee`,
+		); err != nil {
+			return fmt.Errorf("upsert payment: %w", err)
+		}
+
+		// ----- 4) items: удаляем старые у всех заказов пакета, вставляем заново
+		// (status_updated_at переносится, см. deleteItems)
+		times, err := deleteItems(ctx, tx, ids)
+		if err != nil {
+			return fmt.Errorf("delete items: %w", err)
+		}
+		var itemRows [][]any
+		for _, o := range orders {
+			for _, r := range statusRows(o, times) {
+				it := r.item
+				itemRows = append(itemRows, []any{
+					o.OrderUID, it.ChrtID, it.TrackNumber, it.Price, it.RID, it.Name,
+					it.Sale, it.Size, it.TotalPrice, it.NmID, it.Brand, it.Status, r.updated,
+				})
+			}
+		}
+		if err := insertRows(ctx, tx,
+			`INSERT INTO items (order_uid, chrt_id, track_number, price, rid, name,
+				sale, size, total_price, nm_id, brand, status, status_updated_at)`,
+			itemRows, "",
+		); err != nil {
+			return fmt.Errorf("insert items: %w", err)
+		}
+
+		// ----- 5) аудит
+		return insertAudit(ctx, tx, auditRows)
+	})
+}
+
+// insertRows — INSERT head VALUES (...),(...) tail, порезанный на куски
+// так, чтобы не превысить лимит параметров.
+func insertRows(ctx context.Context, tx *sql.Tx, head string, rows [][]any, tail string) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	cols := len(rows[0])
+	perStmt := maxParams / cols
+
+	for start := 0; start < len(rows); start += perStmt {
+		end := min(start+perStmt, len(rows))
+
+		var (
+			b    strings.Builder
+			args = make([]any, 0, (end-start)*cols)
+		)
+		b.WriteString(head)
+		b.WriteString(" VALUES ")
+		for i, row := range rows[start:end] {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteByte('(')
+			for j := range row {
+				if j > 0 {
+					b.WriteByte(',')
+				}
+				fmt.Fprintf(&b, "$%d", len(args)+j+1)
+			}
+			b.WriteByte(')')
+			args = append(args, row...)
+		}
+		b.WriteByte(' ')
+		b.WriteString(tail)
+
+		if _, err := tx.ExecContext(ctx, b.String(), args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// currentStates — пакетная версия currentState: блокирует строки заказов
+// и выводит их состояние из статусов товаров. Новых заказов в карте нет.
+func currentStates(ctx context.Context, tx *sql.Tx, ids []string) (map[string]models.OrderState, error) {
+	rows, err := tx.QueryContext(ctx,
+		`SELECT order_uid FROM orders WHERE order_uid = ANY($1) ORDER BY order_uid FOR UPDATE`, ids)
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]*models.Order)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		existing[id] = &models.Order{}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(existing) == 0 {
+		return map[string]models.OrderState{}, nil
+	}
+
+	rows, err = tx.QueryContext(ctx, `SELECT order_uid, status FROM items WHERE order_uid = ANY($1)`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			id string
+			it models.Item
+		)
+		if err := rows.Scan(&id, &it.Status); err != nil {
+			return nil, err
+		}
+		if o := existing[id]; o != nil {
+			o.Items = append(o.Items, it)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]models.OrderState, len(existing))
+	for id, o := range existing {
+		out[id] = o.State()
+	}
+	return out, nil
+}
+
+// checkSequence проверяет переходы всех заказов пакета по порядку: каждый
+// — от состояния, оставленного предыдущим с тем же order_uid (или от
+// состояния в БД). Иначе created→cancelled→paid в одном пакете прошёл бы,
+// хотя по одному третье сообщение отклонено.
+func checkSequence(prev map[string]models.OrderState, orders []models.Order) error {
+	state := make(map[string]models.OrderState, len(orders))
+	for _, o := range orders {
+		from, ok := state[o.OrderUID]
+		if !ok {
+			from = prev[o.OrderUID]
+		}
+		to := o.State()
+		if err := models.CheckTransition(from, to); err != nil {
+			return fmt.Errorf("order %s: %w", o.OrderUID, err)
+		}
+		state[o.OrderUID] = to
+	}
+	return nil
+}
+
+// lastByUID оставляет по одному заказу на order_uid (последний в пакете),
+// сохраняя порядок: ON CONFLICT не умеет обновлять строку дважды за запрос.
+func lastByUID(orders []models.Order) []models.Order {
+	last := make(map[string]int, len(orders))
+	for i, o := range orders {
+		last[o.OrderUID] = i
+	}
+	if len(last) == len(orders) {
+		return orders
+	}
+	out := make([]models.Order, 0, len(last))
+	for i, o := range orders {
+		if last[o.OrderUID] == i {
+			out = append(out, o)
+		}
+	}
+	return out
+}
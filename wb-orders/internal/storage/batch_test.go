@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"wb-orders/internal/models"
+)
+
+func TestCheckSequence(t *testing.T) {
+	order := func(uid string, status models.ItemStatus) models.Order {
+		return models.Order{OrderUID: uid, Items: []models.Item{{Status: status}}}
+	}
+	cases := []struct {
+		name   string
+		prev   map[string]models.OrderState
+		orders []models.Order
+		ok     bool
+	}{
+		{"new order moves forward", nil,
+			[]models.Order{order("a", 100), order("a", 200), order("a", 300)}, true},
+		{"illegal step inside the batch", nil,
+			[]models.Order{order("a", 100), order("a", 500), order("a", 200)}, false},
+		{"last message alone would pass", map[string]models.OrderState{"a": models.StateCreated},
+			[]models.Order{order("a", 500), order("a", 200)}, false},
+		{"checked against the stored state", map[string]models.OrderState{"a": models.StateCancelled},
+			[]models.Order{order("a", 500)}, true},
+		{"stored state forbids the first step", map[string]models.OrderState{"a": models.StateCancelled},
+			[]models.Order{order("a", 200)}, false},
+		{"orders do not affect each other", map[string]models.OrderState{"b": models.StateCancelled},
+			[]models.Order{order("a", 500), order("b", 500), order("a", 500)}, true},
+	}
+	for _, tc := range cases {
+		err := checkSequence(tc.prev, tc.orders)
+		if tc.ok && err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+		if !tc.ok && !errors.Is(err, models.ErrIllegalTransition) {
+			t.Errorf("%s: err = %v, want ErrIllegalTransition", tc.name, err)
+		}
+	}
+}
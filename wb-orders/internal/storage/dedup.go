@@ -0,0 +1,55 @@
+// internal/storage/dedup.go
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// -------------------- READ: DedupSeen --------------------
+// Есть ли непросроченная отметка о сообщении с таким id.
+func (r *Repo) DedupSeen(ctx context.Context, id string) (bool, time.Time, error) {
+	var expires time.Time
+	err := r.DB.QueryRowContext(ctx,
+		`SELECT expires_at FROM message_dedup WHERE id = $1 AND expires_at > now()`, id).Scan(&expires)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, time.Time{}, nil
+	}
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	return true, expires, nil
+}
+
+// -------------------- WRITE: DedupMark --------------------
+// Отмечает сообщение применённым до момента expires. order — заказ
+// отпечатка содержимого ("" — id продюсера, колонка остаётся NULL).
+func (r *Repo) DedupMark(ctx context.Context, id, order string, expires time.Time) error {
+	const q = `
+		INSERT INTO message_dedup (id, order_uid, expires_at) VALUES ($1, NULLIF($2, ''), $3)
+		ON CONFLICT (id) DO UPDATE SET seen_at = now(), expires_at = EXCLUDED.expires_at
+	`
+	_, err := r.DB.ExecContext(ctx, q, id, order, expires)
+	return err
+}
+
+// -------------------- WRITE: DedupForget --------------------
+// Удаляет прежние отпечатки содержимого заказа, кроме keep. Идёт на каждую
+// отметку, поэтому — по индексу message_dedup_order_idx.
+func (r *Repo) DedupForget(ctx context.Context, order, keep string) error {
+	_, err := r.DB.ExecContext(ctx,
+		`DELETE FROM message_dedup WHERE order_uid = $1 AND id <> $2`, order, keep)
+	return err
+}
+
+// -------------------- WRITE: DedupPurge --------------------
+// Удаляет просроченные отметки, возвращает сколько удалено.
+func (r *Repo) DedupPurge(ctx context.Context) (int64, error) {
+	res, err := r.DB.ExecContext(ctx, `DELETE FROM message_dedup WHERE expires_at <= now()`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
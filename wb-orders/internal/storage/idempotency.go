@@ -0,0 +1,103 @@
+// internal/storage/idempotency.go
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrIdempotencyMismatch — ключ уже использован для другого запроса.
+	ErrIdempotencyMismatch = errors.New("idempotency key was used for a different request")
+	// ErrIdempotencyInProgress — запрос с этим ключом ещё выполняется.
+	ErrIdempotencyInProgress = errors.New("request with this idempotency key is in progress")
+)
+
+// StoredResponse — сохранённый ответ на запрос с Idempotency-Key.
+type StoredResponse struct {
+	StatusCode int
+	Body       []byte
+}
+
+// staleClaim — сколько ждать запрос без ответа, прежде чем считать, что
+// обработчик умер, и отдать ключ новому запросу.
+const staleClaim = 5 * time.Minute
+
+// -------------------- WRITE: ClaimIdempotencyKey --------------------
+// Занимает ключ под запрос с хэшем requestHash до момента expires.
+// nil, nil — ключ свободен (или просрочен), запрос надо выполнить и потом
+// сохранить ответ (SaveIdempotentResponse) или освободить ключ.
+// Ответ — запрос уже выполнен, его надо вернуть как есть.
+func (r *Repo) ClaimIdempotencyKey(ctx context.Context, key, requestHash string, expires time.Time) (*StoredResponse, error) {
+	const claim = `
+		INSERT INTO idempotency_keys (key, request_hash, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO UPDATE SET
+			request_hash = EXCLUDED.request_hash,
+			status_code  = NULL,
+			response     = NULL,
+			created_at   = now(),
+			expires_at   = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= now()
+		   OR (idempotency_keys.status_code IS NULL AND idempotency_keys.created_at < now() - $4::interval)
+		RETURNING key
+	`
+	var claimed string
+	err := r.DB.QueryRowContext(ctx, claim, key, requestHash, expires, staleClaim.String()).Scan(&claimed)
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("claim idempotency key: %w", err)
+	}
+
+	var (
+		hash   string
+		status sql.NullInt32
+		body   []byte
+	)
+	err = r.DB.QueryRowContext(ctx,
+		`SELECT request_hash, status_code, response FROM idempotency_keys WHERE key = $1`, key).
+		Scan(&hash, &status, &body)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		// ключ только что освободили — пусть клиент повторит
+		return nil, ErrIdempotencyInProgress
+	case err != nil:
+		return nil, fmt.Errorf("read idempotency key: %w", err)
+	case hash != requestHash:
+		return nil, ErrIdempotencyMismatch
+	case !status.Valid:
+		return nil, ErrIdempotencyInProgress
+	}
+	return &StoredResponse{StatusCode: int(status.Int32), Body: body}, nil
+}
+
+// -------------------- WRITE: SaveIdempotentResponse --------------------
+func (r *Repo) SaveIdempotentResponse(ctx context.Context, key string, resp StoredResponse) error {
+	_, err := r.DB.ExecContext(ctx,
+		`UPDATE idempotency_keys SET status_code = $2, response = $3 WHERE key = $1`,
+		key, resp.StatusCode, resp.Body)
+	return err
+}
+
+// -------------------- WRITE: ReleaseIdempotencyKey --------------------
+// Освобождает ключ, ответ на который сохранять нельзя (запрос не выполнен
+// из-за временной ошибки): повтор с тем же ключом выполнится заново.
+func (r *Repo) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	_, err := r.DB.ExecContext(ctx,
+		`DELETE FROM idempotency_keys WHERE key = $1 AND status_code IS NULL`, key)
+	return err
+}
+
+// -------------------- WRITE: PurgeIdempotencyKeys --------------------
+// Удаляет просроченные ключи, возвращает сколько удалено.
+func (r *Repo) PurgeIdempotencyKeys(ctx context.Context) (int64, error) {
+	res, err := r.DB.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= now()`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
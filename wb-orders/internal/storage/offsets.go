@@ -0,0 +1,127 @@
+// internal/storage/offsets.go
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"wb-orders/internal/models"
+)
+
+// ErrAlreadyApplied — сообщение с таким офсетом уже записано в БД
+// (повторная доставка после падения между транзакцией и коммитом в Kafka).
+var ErrAlreadyApplied = errors.New("offset already applied")
+
+// Position — место сообщения в Kafka для группы консьюмера.
+type Position struct {
+	Group     string
+	Topic     string
+	Partition int
+	Offset    int64
+}
+
+// -------------------- WRITE: UpsertOrderAt --------------------
+// То же, что UpsertOrder, но в той же транзакции сдвигает офсет группы.
+// Если pos.Offset уже применён — ErrAlreadyApplied, заказ (и аудит) не трогаем.
+func (r *Repo) UpsertOrderAt(ctx context.Context, o models.Order, a Audit, pos Position) error {
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		if err := claimOffset(ctx, tx, pos); err != nil {
+			return err
+		}
+		return upsertOrderTx(ctx, tx, o, a)
+	})
+}
+
+// -------------------- WRITE: SaveOffset --------------------
+// Сдвигает офсет без заказа — для сообщений, ушедших в DLQ.
+func (r *Repo) SaveOffset(ctx context.Context, pos Position) error {
+	err := r.withTx(ctx, func(tx *sql.Tx) error {
+		return claimOffset(ctx, tx, pos)
+	})
+	if errors.Is(err, ErrAlreadyApplied) {
+		return nil
+	}
+	return err
+}
+
+// -------------------- READ: StoredOffsets --------------------
+// Следующие к чтению офсеты группы по партициям топика.
+func (r *Repo) StoredOffsets(ctx context.Context, group, topic string) (map[int]int64, error) {
+	const q = `
+		SELECT partition, next_offset
+		FROM consumer_offsets
+		WHERE group_id = $1 AND topic = $2
+	`
+	rows, err := r.DB.QueryContext(ctx, q, group, topic)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[int]int64)
+	for rows.Next() {
+		var (
+			p    int
+			next int64
+		)
+		if err := rows.Scan(&p, &next); err != nil {
+			return nil, err
+		}
+		out[p] = next
+	}
+	return out, rows.Err()
+}
+
+// -------------------- WRITE: ResetOffsets --------------------
+// Перезаписывает офсеты группы (replay). Консьюмер в этот момент должен
+// быть остановлен, иначе он тут же сдвинет их обратно.
+func (r *Repo) ResetOffsets(ctx context.Context, group, topic string, offsets map[int]int64) error {
+	const upsert = `
+		INSERT INTO consumer_offsets (group_id, topic, partition, next_offset)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (group_id, topic, partition) DO UPDATE SET
+			next_offset = EXCLUDED.next_offset,
+			updated_at  = now()
+	`
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		for p, off := range offsets {
+			if _, err := tx.ExecContext(ctx, upsert, group, topic, p, off); err != nil {
+				return fmt.Errorf("reset offset %s/%d: %w", topic, p, err)
+			}
+		}
+		return nil
+	})
+}
+
+// claimOffset блокирует строку офсета партиции и сдвигает её на pos.Offset+1.
+func claimOffset(ctx context.Context, tx *sql.Tx, pos Position) error {
+	const sel = `
+		SELECT next_offset FROM consumer_offsets
+		WHERE group_id = $1 AND topic = $2 AND partition = $3
+		FOR UPDATE
+	`
+	var next int64
+	err := tx.QueryRowContext(ctx, sel, pos.Group, pos.Topic, pos.Partition).Scan(&next)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return fmt.Errorf("select offset: %w", err)
+	case pos.Offset < next:
+		return fmt.Errorf("%w: %s/%d offset=%d next=%d",
+			ErrAlreadyApplied, pos.Topic, pos.Partition, pos.Offset, next)
+	}
+
+	const upsert = `
+		INSERT INTO consumer_offsets (group_id, topic, partition, next_offset)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (group_id, topic, partition) DO UPDATE SET
+			next_offset = EXCLUDED.next_offset,
+			updated_at  = now()
+	`
+	if _, err := tx.ExecContext(ctx, upsert, pos.Group, pos.Topic, pos.Partition, pos.Offset+1); err != nil {
+		return fmt.Errorf("save offset: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+// internal/storage/quarantine.go
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"wb-orders/internal/ingest"
+)
+
+var (
+	ErrQuarantineNotFound = errors.New("quarantine entry not found")
+	// ErrNotPending — запись уже переотправлена, отброшена или её прямо
+	// сейчас повторяет другой запрос.
+	ErrNotPending = errors.New("quarantine entry is not pending")
+)
+
+// Статусы записи карантина.
+const (
+	QuarantinePending   = "pending"
+	QuarantineRetrying  = "retrying" // захвачена повтором (ClaimQuarantine)
+	QuarantineRetried   = "retried"
+	QuarantineDiscarded = "discarded"
+)
+
+// ClaimTimeout — через сколько захват повтора считается брошенным (процесс
+// упал между ClaimQuarantine и QuarantineAttempt) и запись можно захватить снова.
+const ClaimTimeout = 5 * time.Minute
+
+// QuarantineEntry — отклонённое сообщение с причиной и исходником.
+type QuarantineEntry struct {
+	ID        int64       `json:"id"`
+	OrderUID  string      `json:"order_uid,omitempty"`
+	Stage     string      `json:"stage"`
+	Reason    string      `json:"reason"`
+	Raw       []byte      `json:"-"`
+	Edited    []byte      `json:"-"` // правка поддержки; nil — не правили
+	Meta      ingest.Meta `json:"meta"`
+	Status    string      `json:"status"`
+	Attempts  int         `json:"attempts"`
+	LastError string      `json:"last_error,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// Payload — что отправлять при повторе: правка, если она есть, иначе исходник.
+func (e QuarantineEntry) Payload() []byte {
+	if e.Edited != nil {
+		return e.Edited
+	}
+	return e.Raw
+}
+
+// -------------------- WRITE: Quarantine --------------------
+// Кладёт отклонённое сообщение в карантин. Повторная доставка того же
+// сообщения (те же topic/partition/offset) новую строку не создаёт.
+func (r *Repo) Quarantine(ctx context.Context, e QuarantineEntry) error {
+	meta, err := json.Marshal(e.Meta)
+	if err != nil {
+		return fmt.Errorf("marshal meta: %w", err)
+	}
+	var (
+		topic     = sql.NullString{String: e.Meta.Topic, Valid: e.Meta.Topic != ""}
+		partition = sql.NullInt32{Int32: int32(e.Meta.Partition), Valid: topic.Valid}
+		offset    = sql.NullInt64{Int64: e.Meta.Offset, Valid: topic.Valid}
+	)
+	const q = `
+		INSERT INTO quarantine (order_uid, stage, reason, raw, meta, source_topic, source_partition, source_offset)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (source_topic, source_partition, source_offset) WHERE source_topic IS NOT NULL
+		DO NOTHING
+	`
+	if _, err := r.DB.ExecContext(ctx, q, e.OrderUID, e.Stage, e.Reason, e.Raw, meta, topic, partition, offset); err != nil {
+		return fmt.Errorf("insert quarantine: %w", err)
+	}
+	return nil
+}
+
+const quarantineColumns = `
+	id, order_uid, stage, reason, raw, edited, meta, status, attempts, last_error, created_at, updated_at
+`
+
+func scanQuarantine(row interface{ Scan(...any) error }) (QuarantineEntry, error) {
+	var (
+		e    QuarantineEntry
+		meta []byte
+	)
+	if err := row.Scan(&e.ID, &e.OrderUID, &e.Stage, &e.Reason, &e.Raw, &e.Edited, &meta,
+		&e.Status, &e.Attempts, &e.LastError, &e.CreatedAt, &e.UpdatedAt); err != nil {
+		return QuarantineEntry{}, err
+	}
+	if err := json.Unmarshal(meta, &e.Meta); err != nil {
+		return QuarantineEntry{}, fmt.Errorf("quarantine %d meta: %w", e.ID, err)
+	}
+	return e, nil
+}
+
+// -------------------- READ: ListQuarantine --------------------
+// Записи карантина, новые первыми. status "" — все.
+func (r *Repo) ListQuarantine(ctx context.Context, status string, limit, offset int) ([]QuarantineEntry, error) {
+	q := `SELECT ` + quarantineColumns + ` FROM quarantine
+		WHERE $1 = '' OR status = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2 OFFSET $3`
+	rows, err := r.DB.QueryContext(ctx, q, status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []QuarantineEntry{}
+	for rows.Next() {
+		e, err := scanQuarantine(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// -------------------- READ: GetQuarantine --------------------
+func (r *Repo) GetQuarantine(ctx context.Context, id int64) (QuarantineEntry, error) {
+	e, err := scanQuarantine(r.DB.QueryRowContext(ctx,
+		`SELECT `+quarantineColumns+` FROM quarantine WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return QuarantineEntry{}, fmt.Errorf("%w: %d", ErrQuarantineNotFound, id)
+	}
+	return e, err
+}
+
+// -------------------- WRITE: ClaimQuarantine --------------------
+// Захватывает pending-запись под повтор (pending → retrying) и возвращает её.
+// Захват — один UPDATE, поэтому из двух одновременных повторов запись
+// получит только один, второй — ErrNotPending. Брошенный захват (старше
+// ClaimTimeout) можно перехватить.
+func (r *Repo) ClaimQuarantine(ctx context.Context, id int64) (QuarantineEntry, error) {
+	q := `UPDATE quarantine SET status = 'retrying', updated_at = now()
+		WHERE id = $1 AND (status = 'pending' OR (status = 'retrying' AND updated_at < now() - make_interval(secs => $2)))
+		RETURNING ` + quarantineColumns
+	e, err := scanQuarantine(r.DB.QueryRowContext(ctx, q, id, ClaimTimeout.Seconds()))
+	if !errors.Is(err, sql.ErrNoRows) {
+		return e, err
+	}
+	if _, err := r.GetQuarantine(ctx, id); err != nil {
+		return QuarantineEntry{}, err
+	}
+	return QuarantineEntry{}, fmt.Errorf("%w: %d", ErrNotPending, id)
+}
+
+// -------------------- WRITE: ReleaseQuarantine --------------------
+// Возвращает захваченную запись в pending без попытки: повтор прервала
+// временная ошибка. Правка (если edited != nil) сохраняется.
+func (r *Repo) ReleaseQuarantine(ctx context.Context, id int64, edited []byte) error {
+	const q = `
+		UPDATE quarantine SET
+			edited     = COALESCE($2, edited),
+			status     = 'pending',
+			updated_at = now()
+		WHERE id = $1 AND status = 'retrying'
+	`
+	return r.updateStatus(ctx, id, q, id, edited)
+}
+
+// -------------------- WRITE: QuarantineAttempt --------------------
+// Записывает попытку повтора захваченной записи: правку (если edited != nil),
+// ошибку с возвратом в pending или, при retryErr == nil, перевод в retried.
+func (r *Repo) QuarantineAttempt(ctx context.Context, id int64, edited []byte, retryErr error) error {
+	status, lastErr := QuarantineRetried, ""
+	if retryErr != nil {
+		status, lastErr = QuarantinePending, retryErr.Error()
+	}
+	const q = `
+		UPDATE quarantine SET
+			edited     = COALESCE($2, edited),
+			status     = $3,
+			attempts   = attempts + 1,
+			last_error = $4,
+			updated_at = now()
+		WHERE id = $1 AND status = 'retrying'
+	`
+	return r.updateStatus(ctx, id, q, id, edited, status, lastErr)
+}
+
+// -------------------- WRITE: DiscardQuarantine --------------------
+func (r *Repo) DiscardQuarantine(ctx context.Context, id int64) error {
+	const q = `UPDATE quarantine SET status = 'discarded', updated_at = now() WHERE id = $1 AND status = 'pending'`
+	return r.updateStatus(ctx, id, q, id)
+}
+
+// updateStatus выполняет UPDATE над записью в ожидаемом статусе; ни одной
+// строки — ErrQuarantineNotFound или ErrNotPending.
+func (r *Repo) updateStatus(ctx context.Context, id int64, q string, args ...any) error {
+	res, err := r.DB.ExecContext(ctx, q, args...)
+	if err != nil {
+		return fmt.Errorf("update quarantine: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+	if _, err := r.GetQuarantine(ctx, id); err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %d", ErrNotPending, id)
+}
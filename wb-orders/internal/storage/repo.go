@@ -6,9 +6,12 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 
+	"wb-orders/internal/ingest"
 	"wb-orders/internal/models"
 )
 
@@ -18,6 +21,9 @@ type Repo struct {
 
 func New(db *sql.DB) *Repo { return &Repo{DB: db} }
 
+// Ping — доступна ли БД (для автопаузы консьюмера).
+func (r *Repo) Ping(ctx context.Context) error { return r.DB.PingContext(ctx) }
+
 // -------------------- READ: GetOrderByID --------------------
 // Читает заказ + delivery + payment + items.
 func (r *Repo) GetOrderByID(ctx context.Context, id string) (models.Order, error) {
@@ -80,14 +86,32 @@ func (r *Repo) GetOrderByID(ctx context.Context, id string) (models.Order, error
 		return models.Order{}, err
 	}
 
+	o.BindCurrency()
 	return o, nil
 }
 
+// Audit — исходное сообщение (до нормализации), применённые правила
+// и метаданные приёма. Пишется в order_audit той же транзакцией, что и
+// заказ: записанный заказ без аудита (и наоборот) не остаётся.
+type Audit struct {
+	Raw   []byte // nil — аудит не пишется
+	Fixes []string
+	Meta  ingest.Meta
+}
+
 // -------------------- WRITE: UpsertOrder --------------------
 // Идемпотентное сохранение заказа.
 // 1) upsert в orders, delivery, payment
 // 2) удаление старых items этого заказа + вставка новых
-func (r *Repo) UpsertOrder(ctx context.Context, o models.Order) error {
+// 3) строка order_audit
+func (r *Repo) UpsertOrder(ctx context.Context, o models.Order, a Audit) error {
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		return upsertOrderTx(ctx, tx, o, a)
+	})
+}
+
+// withTx выполняет fn в транзакции: ошибка или паника — откат, иначе commit.
+func (r *Repo) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
 	tx, err := r.DB.BeginTx(ctx, &sql.TxOptions{})
 	if err != nil {
 		return fmt.Errorf("begin tx: %w", err)
@@ -100,6 +124,29 @@ func (r *Repo) UpsertOrder(ctx context.Context, o models.Order) error {
 		}
 	}()
 
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+// upsertOrderTx — тело UpsertOrder; откат делает вызывающий.
+func upsertOrderTx(ctx context.Context, tx *sql.Tx, o models.Order, a Audit) error {
+	// ----- 0) жизненный цикл: переход из текущего состояния должен быть допустим
+	{
+		prev, err := currentState(ctx, tx, o.OrderUID)
+		if err != nil {
+			return fmt.Errorf("current state: %w", err)
+		}
+		if err := models.CheckTransition(prev, o.State()); err != nil {
+			return fmt.Errorf("order %s: %w", o.OrderUID, err)
+		}
+	}
+
 	{
 		const q = `
 			INSERT INTO orders (
@@ -140,7 +187,6 @@ func (r *Repo) UpsertOrder(ctx context.Context, o models.Order) error {
 			o.DateCreated,
 			o.OofShard,
 		); err != nil {
-			_ = tx.Rollback()
 			return fmt.Errorf("upsert orders: %w", err)
 		}
 	}
@@ -164,7 +210,6 @@ func (r *Repo) UpsertOrder(ctx context.Context, o models.Order) error {
 		if _, err := tx.ExecContext(ctx, q,
 			o.OrderUID, d.Name, d.Phone, d.Zip, d.City, d.Address, d.Region, d.Email,
 		); err != nil {
-			_ = tx.Rollback()
 			return fmt.Errorf("upsert delivery: %w", err)
 		}
 	}
@@ -191,39 +236,105 @@ func (r *Repo) UpsertOrder(ctx context.Context, o models.Order) error {
 		if _, err := tx.ExecContext(ctx, q,
 			o.OrderUID, p.Transaction, p.RequestID, p.Currency, p.Provider, p.Amount, p.PaymentDT, p.Bank, p.DeliveryCost, p.GoodsTotal, p.CustomFee,
 		); err != nil {
-			_ = tx.Rollback()
 			return fmt.Errorf("upsert payment: %w", err)
 		}
 	}
 
 	// ----- 4) items: сначала удаляем, затем вставляем заново
+	// (status_updated_at переносится, см. deleteItems)
 	{
-		if _, err := tx.ExecContext(ctx, `DELETE FROM items WHERE order_uid = $1`, o.OrderUID); err != nil {
-			_ = tx.Rollback()
+		times, err := deleteItems(ctx, tx, []string{o.OrderUID})
+		if err != nil {
 			return fmt.Errorf("delete items: %w", err)
 		}
 
 		if len(o.Items) > 0 {
 			const q = `
 				INSERT INTO items (
-					order_uid, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status
-				) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)
+					order_uid, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status, status_updated_at
+				) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13)
 			`
-			for _, it := range o.Items {
+			for _, r := range statusRows(o, times) {
+				it := r.item
 				if _, err := tx.ExecContext(ctx, q,
 					o.OrderUID, it.ChrtID, it.TrackNumber, it.Price, it.RID, it.Name,
 					it.Sale, it.Size, it.TotalPrice, it.NmID,
-					it.Brand, it.Status,
+					it.Brand, it.Status, r.updated,
 				); err != nil {
-					_ = tx.Rollback()
 					return fmt.Errorf("insert item chrt_id=%d: %w", it.ChrtID, err)
 				}
 			}
 		}
 	}
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("commit: %w", err)
+	// ----- 5) аудит
+	return insertAudit(ctx, tx, [][]any{auditRow(o.OrderUID, a)})
+}
+
+// currentState — состояние уже сохранённого заказа ("" если заказа нет).
+// Строка заказа блокируется до конца транзакции, чтобы параллельная
+// переотправка не проскочила проверку перехода.
+func currentState(ctx context.Context, tx *sql.Tx, id string) (models.OrderState, error) {
+	var one int
+	err := tx.QueryRowContext(ctx, `SELECT 1 FROM orders WHERE order_uid = $1 FOR UPDATE`, id).Scan(&one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT status FROM items WHERE order_uid = $1`, id)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var prev models.Order
+	for rows.Next() {
+		var it models.Item
+		if err := rows.Scan(&it.Status); err != nil {
+			return "", err
+		}
+		prev.Items = append(prev.Items, it)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	return prev.State(), nil
+}
+
+// auditRow — строка order_audit (nil, если аудита нет).
+func auditRow(orderUID string, a Audit) []any {
+	if a.Raw == nil {
+		return nil
+	}
+	fixes := a.Fixes
+	if fixes == nil {
+		fixes = []string{}
+	}
+	m := a.Meta
+	var (
+		topic     = sql.NullString{String: m.Topic, Valid: m.Topic != ""}
+		partition = sql.NullInt32{Int32: int32(m.Partition), Valid: topic.Valid}
+		offset    = sql.NullInt64{Int64: m.Offset, Valid: topic.Valid}
+		msgTime   = sql.NullTime{Time: m.Time, Valid: !m.Time.IsZero()}
+	)
+	return []any{orderUID, a.Raw, fixes,
+		m.TraceID, m.SpanID, m.Producer, m.ContentType, m.SchemaVersion,
+		m.Key, topic, partition, offset, msgTime}
+}
+
+// insertAudit пишет строки auditRow, пропуская пустые.
+func insertAudit(ctx context.Context, tx *sql.Tx, rows [][]any) error {
+	rows = slices.DeleteFunc(rows, func(row []any) bool { return row == nil })
+	if err := insertRows(ctx, tx,
+		`INSERT INTO order_audit (order_uid, raw, fixes,
+			trace_id, span_id, producer, content_type, schema_version,
+			msg_key, source_topic, source_partition, source_offset, msg_time)`,
+		rows, "",
+	); err != nil {
+		return fmt.Errorf("insert order_audit: %w", err)
 	}
 	return nil
 }
@@ -242,5 +353,73 @@ func ValidateOrder(o models.Order) error {
 		return errors.New("empty date_created")
 	}
 
+	if err := validateItems(o); err != nil {
+		return err
+	}
+	return validateMoney(o)
+}
+
+// validateItems: статусы товаров есть в реестре — иначе не вывести
+// состояние заказа и не проверить переход.
+func validateItems(o models.Order) error {
+	for _, it := range o.Items {
+		if !it.Status.Known() {
+			return fmt.Errorf("unknown status %d in item chrt_id=%d", it.Status, it.ChrtID)
+		}
+	}
+	return nil
+}
+
+// validateMoney: суммы неотрицательные, итоги сходятся с товарами.
+func validateMoney(o models.Order) error {
+	p := o.Payment
+	// регистр не важен, как и до Money: "usd" — тот же USD (LookupCurrency)
+	if !isCurrencyCode(strings.ToUpper(p.Currency)) {
+		return fmt.Errorf("bad currency %q", p.Currency)
+	}
+
+	for name, m := range map[string]models.Money{
+		"amount":        p.Amount,
+		"delivery_cost": p.DeliveryCost,
+		"goods_total":   p.GoodsTotal,
+		"custom_fee":    p.CustomFee,
+	} {
+		if m.IsNegative() {
+			return fmt.Errorf("negative %s: %d", name, m.Minor)
+		}
+	}
+	for _, it := range o.Items {
+		if it.Price.IsNegative() || it.TotalPrice.IsNegative() {
+			return fmt.Errorf("negative price in item chrt_id=%d", it.ChrtID)
+		}
+	}
+
+	goods, err := o.ItemsTotal()
+	if err != nil {
+		return fmt.Errorf("items total: %w", err)
+	}
+	if goods.Minor != p.GoodsTotal.Minor {
+		return fmt.Errorf("goods_total %d != sum of items %d", p.GoodsTotal.Minor, goods.Minor)
+	}
+
+	want, err := p.ExpectedAmount()
+	if err != nil {
+		return fmt.Errorf("payment total: %w", err)
+	}
+	if want.Minor != p.Amount.Minor {
+		return fmt.Errorf("amount %d != goods_total+delivery_cost+custom_fee %d", p.Amount.Minor, want.Minor)
+	}
 	return nil
 }
+
+func isCurrencyCode(s string) bool {
+	if len(s) != 3 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < 'A' || s[i] > 'Z' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"wb-orders/internal/ingest"
+	"wb-orders/internal/models"
+)
+
+// validOrder — минимальный заказ, проходящий ValidateOrder.
+func validOrder() models.Order {
+	o := models.Order{
+		OrderUID:    "b563feb7b2b84b6test",
+		TrackNumber: "WBILMTESTTRACK",
+		DateCreated: time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
+		Payment: models.Payment{
+			Currency:     "USD",
+			Amount:       models.NewMoney(1817, ""),
+			DeliveryCost: models.NewMoney(1500, ""),
+			GoodsTotal:   models.NewMoney(317, ""),
+		},
+		Items: []models.Item{{
+			ChrtID:     9934930,
+			RID:        "ab4219087a764ae0btest",
+			Price:      models.NewMoney(453, ""),
+			TotalPrice: models.NewMoney(317, ""),
+			Status:     202,
+		}},
+	}
+	o.BindCurrency()
+	return o
+}
+
+func TestValidateOrderCurrency(t *testing.T) {
+	for _, tc := range []struct {
+		currency string
+		ok       bool
+	}{
+		{"USD", true},
+		{"usd", true}, // как до Money: регистр не проверялся
+		{"Rub", true},
+		{"", false},
+		{"US", false},
+		{"US1", false},
+	} {
+		o := validOrder()
+		o.Payment.Currency = tc.currency
+		o.BindCurrency()
+		if err := ValidateOrder(o); (err == nil) != tc.ok {
+			t.Errorf("currency %q: err = %v, want ok=%v", tc.currency, err, tc.ok)
+		}
+	}
+}
+
+func TestValidateOrderItems(t *testing.T) {
+	o := validOrder()
+	o.Items[0].Status = 999
+	if err := ValidateOrder(o); err == nil {
+		t.Fatal("unknown item status accepted")
+	}
+}
+
+func TestAuditRow(t *testing.T) {
+	if row := auditRow("x", Audit{}); row != nil {
+		t.Errorf("no raw: row = %v, want nil", row)
+	}
+
+	at := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	row := auditRow("x", Audit{Raw: []byte("{}"), Meta: ingest.Meta{
+		TraceID: "t", Producer: "checkout", Key: "x", Topic: "orders", Partition: 0, Offset: 0, Time: at,
+	}})
+	if len(row) != 13 || row[0] != "x" || row[3] != "t" || row[5] != "checkout" || row[8] != "x" {
+		t.Fatalf("row = %v", row)
+	}
+	if fixes, ok := row[2].([]string); !ok || fixes == nil {
+		t.Errorf("fixes = %#v, want empty slice (NOT NULL)", row[2])
+	}
+	// Нулевые партиция и офсет — валидные координаты, если есть топик
+	if row[9] != (sql.NullString{String: "orders", Valid: true}) || row[10] != (sql.NullInt32{Valid: true}) ||
+		row[11] != (sql.NullInt64{Valid: true}) || row[12] != (sql.NullTime{Time: at, Valid: true}) {
+		t.Errorf("position = %v", row[9:])
+	}
+
+	// Не из Kafka (HTTP) — координат нет
+	row = auditRow("x", Audit{Raw: []byte("{}"), Fixes: []string{"phone"}})
+	if row[9] != (sql.NullString{}) || row[10] != (sql.NullInt32{}) || row[11] != (sql.NullInt64{}) || row[12] != (sql.NullTime{}) {
+		t.Errorf("position without topic = %v", row[9:])
+	}
+}
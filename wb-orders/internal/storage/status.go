@@ -0,0 +1,174 @@
+// internal/storage/status.go
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"wb-orders/internal/models"
+)
+
+var (
+	ErrOrderNotFound = errors.New("order not found")
+	ErrItemNotFound  = errors.New("item not found")
+	// ErrStaleStatus — событие старше последнего применённого для товара.
+	ErrStaleStatus = errors.New("stale status event")
+)
+
+// -------------------- WRITE: UpdateItemStatus --------------------
+// Меняет статус товара на месте, без пересылки заказа целиком.
+// Товар — по rid, если он задан, иначе все товары с этим chrt_id.
+// Проверяются и переход товара, и переход заказа в целом (как в UpsertOrder).
+// Повтор того же статуса — не ошибка, но и не запись.
+func (r *Repo) UpdateItemStatus(ctx context.Context, ev models.StatusEvent) error {
+	return r.withTx(ctx, func(tx *sql.Tx) error {
+		var one int
+		err := tx.QueryRowContext(ctx, `SELECT 1 FROM orders WHERE order_uid = $1 FOR UPDATE`, ev.OrderUID).Scan(&one)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: %s", ErrOrderNotFound, ev.OrderUID)
+		}
+		if err != nil {
+			return fmt.Errorf("lock order: %w", err)
+		}
+
+		prev, next, err := patchStatus(ctx, tx, ev)
+		if err != nil {
+			return err
+		}
+		if err := models.CheckTransition(prev.State(), next.State()); err != nil {
+			return fmt.Errorf("order %s: %w", ev.OrderUID, err)
+		}
+
+		// те же товары, что проверил patchStatus (matches); устаревшие
+		// (если по chrt_id их несколько) не трогаем
+		const q = `
+			UPDATE items SET status = $4, status_updated_at = $5
+			WHERE order_uid = $1 AND (($2 <> '' AND rid = $2) OR ($2 = '' AND chrt_id = $3))
+				AND (status_updated_at IS NULL OR status_updated_at <= $5)
+		`
+		if _, err := tx.ExecContext(ctx, q, ev.OrderUID, ev.RID, ev.ChrtID, ev.Status, ev.Timestamp); err != nil {
+			return fmt.Errorf("update item status: %w", err)
+		}
+		return nil
+	})
+}
+
+// statusRow — товар заказа и время его последней смены статуса.
+type statusRow struct {
+	item    models.Item
+	updated sql.NullTime
+}
+
+// patchStatus читает товары заказа и возвращает их до и после события.
+func patchStatus(ctx context.Context, tx *sql.Tx, ev models.StatusEvent) (prev, next models.Order, err error) {
+	rows, err := tx.QueryContext(ctx,
+		`SELECT chrt_id, rid, status, status_updated_at FROM items WHERE order_uid = $1`, ev.OrderUID)
+	if err != nil {
+		return prev, next, fmt.Errorf("select items: %w", err)
+	}
+	defer rows.Close()
+
+	var items []statusRow
+	for rows.Next() {
+		var r statusRow
+		if err := rows.Scan(&r.item.ChrtID, &r.item.RID, &r.item.Status, &r.updated); err != nil {
+			return prev, next, err
+		}
+		items = append(items, r)
+	}
+	if err := rows.Err(); err != nil {
+		return prev, next, err
+	}
+	return applyStatus(items, ev)
+}
+
+// itemKey — товар заказа, чьё status_updated_at переживает перезапись заказа.
+type itemKey struct {
+	order string
+	rid   string
+	chrt  int
+}
+
+// deleteItems удаляет товары заказов ids и возвращает время последней смены
+// статуса тех, у кого оно было. Полная перезапись заказа не знает, когда
+// менялись статусы: без переноса этого времени более старое событие статуса
+// применилось бы поверх уже учтённого.
+func deleteItems(ctx context.Context, tx *sql.Tx, ids []string) (map[itemKey]sql.NullTime, error) {
+	rows, err := tx.QueryContext(ctx,
+		`DELETE FROM items WHERE order_uid = ANY($1) RETURNING order_uid, rid, chrt_id, status_updated_at`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	times := make(map[itemKey]sql.NullTime)
+	for rows.Next() {
+		var (
+			k  itemKey
+			at sql.NullTime
+		)
+		if err := rows.Scan(&k.order, &k.rid, &k.chrt, &at); err != nil {
+			return nil, err
+		}
+		if at.Valid {
+			times[k] = at
+		}
+	}
+	return times, rows.Err()
+}
+
+// statusRows — товары заказа o с перенесённым из times временем смены
+// статуса (товар тот же, если совпали rid и chrt_id).
+func statusRows(o models.Order, times map[itemKey]sql.NullTime) []statusRow {
+	out := make([]statusRow, len(o.Items))
+	for i, it := range o.Items {
+		out[i] = statusRow{item: it, updated: times[itemKey{o.OrderUID, it.RID, it.ChrtID}]}
+	}
+	return out
+}
+
+// matches — событие относится к товару: по rid, если он задан, иначе по
+// chrt_id. Условие то же, что в UPDATE в UpdateItemStatus.
+func matches(it models.Item, ev models.StatusEvent) bool {
+	if ev.RID != "" {
+		return it.RID == ev.RID
+	}
+	return it.ChrtID == ev.ChrtID
+}
+
+// applyStatus применяет событие к товарам заказа.
+// Ошибки: товара нет, событие устарело, переход товара недопустим.
+func applyStatus(items []statusRow, ev models.StatusEvent) (prev, next models.Order, err error) {
+	matched, stale := 0, 0
+	for _, r := range items {
+		it, updated := r.item, r.updated
+		prev.Items = append(prev.Items, it)
+
+		if !matches(it, ev) {
+			next.Items = append(next.Items, it)
+			continue
+		}
+		matched++
+		if updated.Valid && ev.Timestamp.Before(updated.Time) {
+			stale++
+			next.Items = append(next.Items, it)
+			continue
+		}
+		if err := models.CheckTransition(it.Status.State(), ev.Status.State()); err != nil {
+			return prev, next, fmt.Errorf("item rid=%s chrt_id=%d %s -> %s: %w",
+				it.RID, it.ChrtID, it.Status.Name(), ev.Status.Name(), err)
+		}
+		it.Status = ev.Status
+		next.Items = append(next.Items, it)
+	}
+
+	switch {
+	case matched == 0:
+		return prev, next, fmt.Errorf("%w: order %s rid=%q chrt_id=%d", ErrItemNotFound, ev.OrderUID, ev.RID, ev.ChrtID)
+	case stale == matched:
+		return prev, next, fmt.Errorf("%w: order %s at %s", ErrStaleStatus, ev.OrderUID, ev.Timestamp)
+	}
+	return prev, next, nil
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"wb-orders/internal/models"
+)
+
+func TestApplyStatus(t *testing.T) {
+	t0 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	at := func(t time.Time) sql.NullTime { return sql.NullTime{Time: t, Valid: true} }
+	row := func(chrt int, rid string, status models.ItemStatus, updated sql.NullTime) statusRow {
+		return statusRow{item: models.Item{ChrtID: chrt, RID: rid, Status: status}, updated: updated}
+	}
+	ev := func(chrt int, rid string, status models.ItemStatus, ts time.Time) models.StatusEvent {
+		return models.StatusEvent{OrderUID: "o1", ChrtID: chrt, RID: rid, Status: status, Timestamp: ts}
+	}
+
+	for _, tc := range []struct {
+		name  string
+		items []statusRow
+		ev    models.StatusEvent
+		err   error
+		want  []models.ItemStatus // статусы товаров после события
+	}{
+		{
+			name:  "by rid",
+			items: []statusRow{row(1, "r1", 202, at(t0)), row(1, "r2", 202, at(t0))},
+			ev:    ev(1, "r2", 300, t0.Add(time.Hour)),
+			want:  []models.ItemStatus{202, 300},
+		},
+		{
+			name:  "by chrt_id updates every matching item",
+			items: []statusRow{row(1, "r1", 202, sql.NullTime{}), row(2, "r2", 202, sql.NullTime{}), row(1, "r3", 202, sql.NullTime{})},
+			ev:    ev(1, "", 300, t0),
+			want:  []models.ItemStatus{300, 202, 300},
+		},
+		{
+			// rid пустой у товара и у события с другим chrt_id — не совпадение
+			name:  "empty rid does not match other chrt_id",
+			items: []statusRow{row(1, "", 202, sql.NullTime{}), row(2, "", 202, sql.NullTime{})},
+			ev:    ev(2, "", 300, t0),
+			want:  []models.ItemStatus{202, 300},
+		},
+		{
+			name:  "not found",
+			items: []statusRow{row(1, "r1", 202, sql.NullTime{})},
+			ev:    ev(0, "nope", 300, t0),
+			err:   ErrItemNotFound,
+		},
+		{
+			name:  "stale",
+			items: []statusRow{row(1, "r1", 300, at(t0))},
+			ev:    ev(1, "r1", 202, t0.Add(-time.Minute)),
+			err:   ErrStaleStatus,
+		},
+		{
+			// из двух товаров по chrt_id устарело одно событие — второй меняется
+			name:  "stale for some items",
+			items: []statusRow{row(1, "r1", 300, at(t0)), row(1, "r2", 202, at(t0.Add(-time.Hour)))},
+			ev:    ev(1, "", 300, t0.Add(-time.Minute)),
+			want:  []models.ItemStatus{300, 300},
+		},
+		{
+			name:  "illegal transition",
+			items: []statusRow{row(1, "r1", 400, at(t0))},
+			ev:    ev(1, "r1", 202, t0.Add(time.Hour)),
+			err:   models.ErrIllegalTransition,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			prev, next, err := applyStatus(tc.items, tc.ev)
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("err = %v, want %v", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(prev.Items) != len(tc.items) || len(next.Items) != len(tc.want) {
+				t.Fatalf("prev=%d next=%d items, want %d", len(prev.Items), len(next.Items), len(tc.want))
+			}
+			for i, it := range next.Items {
+				if it.Status != tc.want[i] {
+					t.Errorf("item %d status = %d, want %d", i, it.Status, tc.want[i])
+				}
+				if prev.Items[i].Status != tc.items[i].item.Status {
+					t.Errorf("prev item %d changed", i)
+				}
+			}
+		})
+	}
+}
+
+// Событие → полная перезапись заказа → более старое событие: время смены
+// статуса переносится на тот же товар, старое событие не применяется.
+func TestStatusTimeSurvivesUpsert(t *testing.T) {
+	t0 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	// после события в 12:00 у r1 статус 300 (как вернул бы deleteItems)
+	times := map[itemKey]sql.NullTime{
+		{"o1", "r1", 1}: {Time: t0, Valid: true},
+		{"o2", "r2", 2}: {Time: t0, Valid: true}, // чужой заказ
+	}
+	o := models.Order{OrderUID: "o1", Items: []models.Item{
+		{ChrtID: 1, RID: "r1", Status: 300},
+		{ChrtID: 2, RID: "r2", Status: 202}, // новый для o1 товар
+	}}
+	rows := statusRows(o, times)
+	if !rows[0].updated.Valid || !rows[0].updated.Time.Equal(t0) || rows[1].updated.Valid {
+		t.Fatalf("carried times = %v, %v", rows[0].updated, rows[1].updated)
+	}
+
+	older := models.StatusEvent{OrderUID: "o1", RID: "r1", Status: 202, Timestamp: t0.Add(-time.Minute)}
+	if _, _, err := applyStatus(rows, older); !errors.Is(err, ErrStaleStatus) {
+		t.Errorf("older event after upsert: err = %v, want ErrStaleStatus", err)
+	}
+	// у нового товара времени нет — событие применяется
+	fresh := models.StatusEvent{OrderUID: "o1", RID: "r2", Status: 300, Timestamp: t0.Add(-time.Minute)}
+	if _, next, err := applyStatus(rows, fresh); err != nil || next.Items[1].Status != 300 {
+		t.Errorf("event for new item: err = %v", err)
+	}
+}
@@ -0,0 +1,10 @@
+-- Исходные (до нормализации) сообщения с заказами и список применённых правил.
+CREATE TABLE IF NOT EXISTS order_audit (
+	id          BIGSERIAL PRIMARY KEY,
+	order_uid   TEXT        NOT NULL,
+	raw         BYTEA       NOT NULL,
+	fixes       TEXT[]      NOT NULL DEFAULT '{}',
+	received_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS order_audit_order_uid_idx ON order_audit (order_uid, received_at DESC);
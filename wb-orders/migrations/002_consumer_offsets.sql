@@ -0,0 +1,10 @@
+-- Офсеты консьюмера, записанные в той же транзакции, что и заказ.
+-- next_offset — следующий офсет к чтению (последний обработанный + 1).
+CREATE TABLE IF NOT EXISTS consumer_offsets (
+	group_id    TEXT        NOT NULL,
+	topic       TEXT        NOT NULL,
+	partition   INT         NOT NULL,
+	next_offset BIGINT      NOT NULL,
+	updated_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (group_id, topic, partition)
+);
@@ -0,0 +1,14 @@
+-- Метаданные приёма заказа: заголовки сообщения и его место в Kafka.
+ALTER TABLE order_audit
+	ADD COLUMN IF NOT EXISTS trace_id         TEXT NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS span_id          TEXT NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS producer         TEXT NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS content_type     TEXT NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS schema_version   TEXT NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS msg_key          TEXT NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS source_topic     TEXT,
+	ADD COLUMN IF NOT EXISTS source_partition INT,
+	ADD COLUMN IF NOT EXISTS source_offset    BIGINT,
+	ADD COLUMN IF NOT EXISTS msg_time         TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS order_audit_trace_id_idx ON order_audit (trace_id) WHERE trace_id <> '';
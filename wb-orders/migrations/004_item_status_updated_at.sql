@@ -0,0 +1,4 @@
+-- Когда статус товара последний раз менялся событием из order-status:
+-- более старые события (пришедшие не по порядку) не применяются.
+-- Полная перезапись заказа сбрасывает значение в NULL.
+ALTER TABLE items ADD COLUMN IF NOT EXISTS status_updated_at TIMESTAMPTZ;
@@ -0,0 +1,13 @@
+-- Идентификаторы уже применённых сообщений (заголовок message-id или хэш
+-- содержимого). Повтор в пределах TTL подтверждается, но не применяется.
+-- order_uid — заказ отпечатка содержимого (NULL для message-id): у заказа
+-- помнится только последний отпечаток, прежние удаляются по нему.
+CREATE TABLE IF NOT EXISTS message_dedup (
+	id         TEXT        PRIMARY KEY,
+	order_uid  TEXT,
+	seen_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+	expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS message_dedup_expires_idx ON message_dedup (expires_at);
+CREATE INDEX IF NOT EXISTS message_dedup_order_idx ON message_dedup (order_uid) WHERE order_uid IS NOT NULL;
@@ -0,0 +1,26 @@
+-- Отклонённые консьюмером сообщения: причина, исходник и (после правки
+-- поддержкой) исправленная версия. pending → retried | discarded.
+CREATE TABLE IF NOT EXISTS quarantine (
+	id               BIGSERIAL   PRIMARY KEY,
+	order_uid        TEXT        NOT NULL DEFAULT '',
+	stage            TEXT        NOT NULL,
+	reason           TEXT        NOT NULL,
+	raw              BYTEA       NOT NULL,
+	edited           BYTEA,
+	meta             JSONB       NOT NULL DEFAULT '{}',
+	source_topic     TEXT,
+	source_partition INT,
+	source_offset    BIGINT,
+	status           TEXT        NOT NULL DEFAULT 'pending',
+	attempts         INT         NOT NULL DEFAULT 0,
+	last_error       TEXT        NOT NULL DEFAULT '',
+	created_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at       TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Повторная доставка того же сообщения не плодит строки
+CREATE UNIQUE INDEX IF NOT EXISTS quarantine_source_idx
+	ON quarantine (source_topic, source_partition, source_offset)
+	WHERE source_topic IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS quarantine_status_idx ON quarantine (status, created_at DESC);
@@ -0,0 +1,14 @@
+-- Ключи Idempotency-Key приёма заказов по HTTP. Пока запрос выполняется,
+-- status_code пуст; после — хранится ответ, повтор запроса с тем же ключом
+-- получает его же. request_hash — чтобы ключ не переиспользовали
+-- для другого запроса.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	key          TEXT        PRIMARY KEY,
+	request_hash TEXT        NOT NULL,
+	status_code  INT,
+	response     BYTEA,
+	created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+	expires_at   TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_idx ON idempotency_keys (expires_at);